@@ -22,12 +22,55 @@ function App() {
         }
     }, [setJwtToken]);
 
+    // Access tokens are short-lived, so they are exchanged for fresh ones well
+    // before they expire while the user is logged in.
+    useEffect(() => {
+        if (jwtToken === '') {
+            return;
+        }
+
+        const refresh = async () => {
+            try {
+                const response = await fetch('https://cinebase.erkindilekci.me/token/refresh', {
+                    method: 'POST',
+                    headers: {'Content-Type': 'application/json'},
+                    body: JSON.stringify({refresh_token: localStorage.getItem('refresh_token') ?? ''})
+                });
+                if (!response.ok) {
+                    throw new Error('refresh failed');
+                }
+                const data: { token: string; refresh_token: string } = await response.json();
+                localStorage.setItem('token', data.token);
+                localStorage.setItem('refresh_token', data.refresh_token);
+                setJwtToken(data.token);
+            } catch {
+                localStorage.removeItem('token');
+                localStorage.removeItem('refresh_token');
+                setJwtToken('');
+                navigate('/login');
+            }
+        };
+
+        const interval = setInterval(refresh, 10 * 60 * 1000);
+        return () => clearInterval(interval);
+    }, [jwtToken, navigate]);
+
     const handleLinkClick = (path: string) => {
         setSelectedLink(() => path);
     };
 
     const handleLogout = async () => {
+        try {
+            await fetch('https://cinebase.erkindilekci.me/logout', {
+                method: 'POST',
+                headers: {'Content-Type': 'application/json', 'Authorization': 'Bearer ' + jwtToken},
+                body: JSON.stringify({refresh_token: localStorage.getItem('refresh_token') ?? ''})
+            });
+        } catch {
+            // The local session is cleared regardless.
+        }
         localStorage.removeItem("token");
+        localStorage.removeItem("refresh_token");
         setJwtToken('');
         navigate('/login');
     };
@@ -13,7 +13,7 @@ export interface OutletContextType {
     setJwtToken: React.Dispatch<React.SetStateAction<string>>;
 }
 
-type FetchDataType = { error_message: string } | { token: string };
+type FetchDataType = { error_message: string } | { token: string; refresh_token: string };
 
 const Login = () => {
     const [isLoading, setIsLoading] = useState<boolean>(false);
@@ -47,6 +47,7 @@ const Login = () => {
             } else if ('token' in data) {
                 setJwtToken(data.token);
                 localStorage.setItem('token', data.token);
+                localStorage.setItem('refresh_token', data.refresh_token);
                 navigate('/');
             }
         } catch (error) {
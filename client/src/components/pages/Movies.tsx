@@ -28,11 +28,12 @@ const fetchMovies = async (): Promise<Movie[]> => {
 
     const requestOptions: RequestInit = {method: 'GET', headers: headers};
 
-    const response = await fetch('https://cinebase.erkindilekci.me/movies', requestOptions);
+    const response = await fetch('https://cinebase.erkindilekci.me/movies?limit=100', requestOptions);
     if (!response.ok) {
         throw new Error('Network response was not ok');
     }
-    return response.json();
+    const page = await response.json();
+    return page.data;
 };
 
 export const movieColumns: ColumnDef<Movie>[] = [
@@ -30,7 +30,7 @@ const fetchMovies = async (genreId: number): Promise<Movie[]> => {
 
     const requestOptions: RequestInit = {method: 'GET', headers: headers};
 
-    const response = await fetch(`https://cinebase.erkindilekci.me/movies?genre=${genreId}`, requestOptions);
+    const response = await fetch(`https://cinebase.erkindilekci.me/movies?genre=${genreId}&limit=100`, requestOptions);
 
     const contentType = response.headers.get('content-type');
     if (!contentType || !contentType.includes('application/json')) {
@@ -42,7 +42,8 @@ const fetchMovies = async (genreId: number): Promise<Movie[]> => {
         throw new Error('Network response was not ok');
     }
 
-    return response.json();
+    const page = await response.json();
+    return page.data;
 };
 
 const OneGenreMovies = () => {
@@ -2,50 +2,271 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/erkindilekci/cinebase/server/pkg/commmon/app"
+	"github.com/erkindilekci/cinebase/server/pkg/commmon/hashing"
+	"github.com/erkindilekci/cinebase/server/pkg/commmon/mail"
+	"github.com/erkindilekci/cinebase/server/pkg/commmon/migration"
+	"github.com/erkindilekci/cinebase/server/pkg/commmon/oidc"
 	"github.com/erkindilekci/cinebase/server/pkg/commmon/postgresql"
+	"github.com/erkindilekci/cinebase/server/pkg/commmon/signing"
 	"github.com/erkindilekci/cinebase/server/pkg/controller"
+	"github.com/erkindilekci/cinebase/server/pkg/domain"
+	"github.com/erkindilekci/cinebase/server/pkg/graph"
+	"github.com/erkindilekci/cinebase/server/pkg/middleware"
 	"github.com/erkindilekci/cinebase/server/pkg/repository"
 	"github.com/erkindilekci/cinebase/server/pkg/service"
 	"github.com/labstack/echo/v4"
 	echoMiddleware "github.com/labstack/echo/v4/middleware"
 )
 
+// shutdownTimeout bounds how long in-flight requests and queued mail are
+// waited for when the server is stopped.
+const shutdownTimeout = 30 * time.Second
+
 func main() {
 	ctx := context.Background()
 	configurationManager := app.NewConfigurationManager()
+
+	if len(os.Args) > 1 && os.Args[1] == "generate-key" {
+		if err := runGenerateKeyCommand(configurationManager.SigningKeyDir, os.Args[2:]); err != nil {
+			log.Fatalf("Key generation failed: %v", err)
+		}
+		return
+	}
+
 	dbPool := postgresql.GetConnectionPool(ctx, configurationManager.PostgresqlConfig)
 	defer dbPool.Close()
 
+	migrator, err := migration.NewMigrator(dbPool)
+	if err != nil {
+		log.Fatalf("Failed to load migrations: %v", err)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrateCommand(ctx, migrator, os.Args[2:]); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	}
+
+	if configurationManager.AutoMigrate {
+		if err := migrator.Up(ctx); err != nil {
+			log.Fatalf("Failed to apply migrations: %v", err)
+		}
+	}
+
+	keySet, err := loadSigningKeys(configurationManager)
+	if err != nil {
+		log.Fatalf("Failed to load signing keys: %v", err)
+	}
+
+	verificationPolicy := configurationManager.EmailVerification.Policy
+	if !verificationPolicy.IsValid() {
+		log.Fatalf("Invalid EMAIL_VERIFICATION_POLICY %q: %v", verificationPolicy, domain.ErrInvalidVerificationPolicy)
+	}
+
+	passwordPolicy, err := service.NewPasswordPolicy(configurationManager.PasswordPolicy)
+	if err != nil {
+		log.Fatalf("Invalid password policy: %v", err)
+	}
+	passwordHasher, err := hashing.New(configurationManager.PasswordHashing)
+	if err != nil {
+		log.Fatalf("Invalid password hashing settings: %v", err)
+	}
+
+	mailConfig := configurationManager.Mail
+	mailQueue := mail.NewQueue(mail.New(mailConfig), mailConfig.QueueWorkers, mailConfig.QueueSize, mailConfig.SendTimeout)
 	userRepository := repository.NewUserRepository(dbPool)
-	userService := service.NewUserService(userRepository)
-	userController := controller.NewUserController(userService)
+	tokenRepository := repository.NewTokenRepository(dbPool)
+	tokenService := service.NewTokenService(tokenRepository, userRepository, keySet, configurationManager.Tokens)
+	accessPolicy := middleware.AccessPolicy{
+		Verification:                 verificationPolicy,
+		RequireMfaForPrivilegedRoles: configurationManager.Mfa.RequiredForPrivilegedRoles,
+	}
+	apiKeyService := service.NewApiKeyService(repository.NewApiKeyRepository(dbPool), configurationManager.ApiKeys)
+	auth, err := middleware.NewAuth(keySet, configurationManager.TokenValidation, accessPolicy, tokenService, apiKeyService)
+	if err != nil {
+		log.Fatalf("Invalid token validation settings: %v", err)
+	}
+	emailVerificationService := service.NewEmailVerificationService(userRepository, keySet, mailQueue, configurationManager.EmailVerification)
+	loginThrottle := service.NewLoginThrottle(repository.NewLoginThrottleRepository(dbPool), configurationManager.LoginThrottle)
+	mfaService := service.NewMfaService(repository.NewMfaRepository(dbPool), userRepository, tokenService, loginThrottle, keySet, configurationManager.Mfa)
+	userService := service.NewUserService(userRepository, tokenService, emailVerificationService, loginThrottle, mfaService, passwordPolicy, passwordHasher, configurationManager.BootstrapAdminEmail)
+	if err := userService.BootstrapAdmin(); err != nil {
+		log.Fatalf("Failed to bootstrap the first admin: %v", err)
+	}
+	userController := controller.NewUserController(userService, tokenService, auth)
+
+	emailVerificationController := controller.NewEmailVerificationController(emailVerificationService)
+	mfaController := controller.NewMfaController(mfaService, auth)
+	apiKeyController := controller.NewApiKeyController(apiKeyService, auth)
+
+	var oidcController *controller.OidcController
+	if oidcConfig := configurationManager.Oidc; oidcConfig.Provider.IssuerURL != "" {
+		provider := oidc.NewProvider(oidcConfig.Provider, nil)
+		oidcService, err := service.NewOidcService(provider, repository.NewIdentityRepository(dbPool), userRepository, tokenService, emailVerificationService, mfaService, keySet, oidcConfig)
+		if err != nil {
+			log.Fatalf("Invalid OIDC_ROLE_MAPPING: %v", err)
+		}
+		oidcController = controller.NewOidcController(oidcService, configurationManager.OidcClientRedirectURL, oidcConfig.Provider.RedirectURL, oidcConfig.StateTTL)
+	}
+
+	passwordResetRepository := repository.NewPasswordResetRepository(dbPool)
+	passwordResetService := service.NewPasswordResetService(passwordResetRepository, userRepository, mailQueue, passwordPolicy, passwordHasher, configurationManager.PasswordReset)
+	passwordController := controller.NewPasswordController(passwordResetService)
 
 	movieRepository := repository.NewMovieRepository(dbPool)
-	movieService := service.NewMovieService(movieRepository)
-	movieController := controller.NewMovieController(movieService)
+	movieService := service.NewMovieService(movieRepository, configurationManager.AutocompleteCacheSize)
+	persistedQueries, err := graph.NewPersistedQueries(configurationManager.PersistedQueries)
+	if err != nil {
+		log.Fatalf("Failed to load GraphQL persisted queries: %v", err)
+	}
+	movieGraph, err := graph.New(movieService, auth, configurationManager.GraphqlLimits, persistedQueries)
+	if err != nil {
+		log.Fatalf("Failed to build GraphQL schema: %v", err)
+	}
+	movieController := controller.NewMovieController(movieService, movieGraph, auth)
+
+	genreRepository := repository.NewGenreRepository(dbPool)
+	genreService := service.NewGenreService(genreRepository)
+	genreController := controller.NewGenreController(genreService, auth)
+
+	jwksController := controller.NewJwksController(keySet)
 
 	e := echo.New()
+	// Client IPs feed the login throttle, so forwarding headers are only
+	// believed when a proxy in front of the server sets them.
+	if configurationManager.TrustProxyHeaders {
+		e.IPExtractor = echo.ExtractIPFromXFFHeader()
+	} else {
+		e.IPExtractor = echo.ExtractIPDirect()
+	}
 	e.Use(echoMiddleware.Recover())
 	e.Use(echoMiddleware.CORSWithConfig(echoMiddleware.CORSConfig{
 		AllowOrigins:     []string{"https://erkindilekci-cinebase.netlify.app"},
 		AllowMethods:     []string{echo.GET, echo.POST, echo.PUT, echo.DELETE, echo.PATCH, echo.OPTIONS},
-		AllowHeaders:     []string{"Accept", "Content-Type", "X-CSRF-Token", "Authorization"},
+		AllowHeaders:     []string{"Accept", "Content-Type", "X-CSRF-Token", "Authorization", middleware.ApiKeyHeader},
+		ExposeHeaders:    []string{"Link"},
 		AllowCredentials: true,
 	}))
 	userController.RegisterUserRoutes(e)
+	passwordController.RegisterPasswordRoutes(e)
+	emailVerificationController.RegisterEmailVerificationRoutes(e)
+	mfaController.RegisterMfaRoutes(e)
+	apiKeyController.RegisterApiKeyRoutes(e)
+	if oidcController != nil {
+		oidcController.RegisterOidcRoutes(e)
+	}
 	movieController.RegisterMovieRoutes(e)
+	genreController.RegisterGenreRoutes(e)
+	jwksController.RegisterJwksRoutes(e)
 
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
 
-	log.Println("Server is running on port", port)
-	if err := e.Start(":" + port); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	stopCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		log.Println("Server is running on port", port)
+		if err := e.Start(":" + port); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+	<-stopCtx.Done()
+
+	log.Println("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(ctx, shutdownTimeout)
+	defer cancel()
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Failed to finish open requests: %v", err)
+	}
+	// Requests can't queue mail anymore, so what's queued can be drained.
+	if err := mailQueue.Close(shutdownCtx); err != nil {
+		log.Printf("Failed to send queued mail: %v", err)
+	}
+}
+
+// runMigrateCommand handles `cinebaseapi migrate [up | down [steps] | status]`.
+func runMigrateCommand(ctx context.Context, migrator *migration.Migrator, args []string) error {
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		return migrator.Up(ctx)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			var err error
+			steps, err = strconv.Atoi(args[1])
+			if err != nil {
+				return fmt.Errorf("invalid number of steps: %s", args[1])
+			}
+		}
+		return migrator.Down(ctx, steps)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if errors.Is(err, migration.ErrNoMigrationsTable) {
+			fmt.Println("no migrations table, the database has no migrations applied")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%06d_%-40s %s\n", status.Version, status.Name, appliedAt)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command: %s (expected up, down or status)", command)
+	}
+}
+
+// loadSigningKeys reads the token signing keys from the configured directory,
+// or generates a throwaway key for local development when there is none.
+func loadSigningKeys(configurationManager *app.ConfigurationManager) (*signing.KeySet, error) {
+	if configurationManager.SigningKeyDir == "" {
+		log.Println("JWT_KEY_DIR is not set, signing tokens with an ephemeral key that won't survive a restart")
+		return signing.NewEphemeralKeySet()
+	}
+	return signing.LoadKeySet(configurationManager.SigningKeyDir, configurationManager.SigningKeyId)
+}
+
+// runGenerateKeyCommand handles `cinebaseapi generate-key [EdDSA | RS256]`.
+func runGenerateKeyCommand(dir string, args []string) error {
+	if dir == "" {
+		return fmt.Errorf("JWT_KEY_DIR must be set")
+	}
+
+	algorithm := "EdDSA"
+	if len(args) > 0 {
+		algorithm = args[0]
 	}
+
+	keyId, err := signing.GenerateKeyFile(dir, algorithm)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Generated %s key %s, set JWT_SIGNING_KEY_ID=%s to sign with it\n", algorithm, keyId, keyId)
+	return nil
 }
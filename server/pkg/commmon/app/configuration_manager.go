@@ -1,12 +1,53 @@
 package app
 
 import (
+	"github.com/erkindilekci/cinebase/server/pkg/commmon/hashing"
+	"github.com/erkindilekci/cinebase/server/pkg/commmon/mail"
+	"github.com/erkindilekci/cinebase/server/pkg/commmon/oidc"
 	"github.com/erkindilekci/cinebase/server/pkg/commmon/postgresql"
+	"github.com/erkindilekci/cinebase/server/pkg/domain"
+	"github.com/erkindilekci/cinebase/server/pkg/graph"
+	"github.com/erkindilekci/cinebase/server/pkg/middleware"
+	"github.com/erkindilekci/cinebase/server/pkg/service"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type ConfigurationManager struct {
 	PostgresqlConfig postgresql.Config
+	AutoMigrate      bool
+	GraphqlLimits    graph.Limits
+	PersistedQueries graph.PersistedQueryConfig
+	// AutocompleteCacheSize bounds the in-process title prefix cache, 0 disables it.
+	AutocompleteCacheSize int
+	Tokens                service.TokenConfig
+	// SigningKeyDir holds the PEM keys access tokens are signed with, see
+	// signing.LoadKeySet. Without it an ephemeral key is generated.
+	SigningKeyDir string
+	SigningKeyId  string
+	// TokenValidation is what access tokens are checked against; its issuer
+	// and audience are also the ones new tokens are issued with.
+	TokenValidation middleware.TokenValidation
+	PasswordReset   service.PasswordResetConfig
+	PasswordPolicy  service.PasswordPolicyConfig
+	PasswordHashing hashing.Config
+	Mail            mail.Config
+	// EmailVerification.Policy is also enforced by the auth middleware.
+	EmailVerification service.EmailVerificationConfig
+	LoginThrottle     service.LoginThrottleConfig
+	Mfa               service.MfaConfig
+	ApiKeys           service.ApiKeyConfig
+	// Oidc enables single sign-on when Oidc.Provider.IssuerURL is set.
+	Oidc service.OidcConfig
+	// OidcClientRedirectURL is the client page single sign-on ends on.
+	OidcClientRedirectURL string
+	// TrustProxyHeaders takes the client IP from X-Forwarded-For and
+	// X-Real-IP, which is only safe behind a proxy that sets them.
+	TrustProxyHeaders bool
+	// BootstrapAdminEmail names the account promoted to admin while none exists.
+	BootstrapAdminEmail string
 }
 
 func NewConfigurationManager() *ConfigurationManager {
@@ -25,5 +66,186 @@ func NewConfigurationManager() *ConfigurationManager {
 		MaxConnections:        "10",
 		MaxConnectionIdleTime: "30s",
 	}
-	return &ConfigurationManager{postgresqlConfig}
+	autoMigrate, _ := strconv.ParseBool(os.Getenv("DB_AUTO_MIGRATE"))
+
+	graphqlLimits := graph.Limits{
+		MaxDepth:        getEnvInt("GRAPHQL_MAX_DEPTH", 8),
+		MaxComplexity:   getEnvInt("GRAPHQL_MAX_COMPLEXITY", 1000),
+		MaxAliases:      getEnvInt("GRAPHQL_MAX_ALIASES", 15),
+		DefaultListSize: getEnvInt("GRAPHQL_DEFAULT_LIST_SIZE", 20),
+	}
+
+	persistedQueriesEnabled, err := strconv.ParseBool(os.Getenv("GRAPHQL_APQ_ENABLED"))
+	if err != nil {
+		persistedQueriesEnabled = true
+	}
+	strictAllowList, _ := strconv.ParseBool(os.Getenv("GRAPHQL_STRICT_ALLOWLIST"))
+
+	persistedQueryConfig := graph.PersistedQueryConfig{
+		Enabled:       persistedQueriesEnabled,
+		CacheSize:     getEnvInt("GRAPHQL_APQ_CACHE_SIZE", 1000),
+		AllowListFile: os.Getenv("GRAPHQL_ALLOWLIST_FILE"),
+		Strict:        strictAllowList,
+	}
+
+	mfaRequired, _ := strconv.ParseBool(os.Getenv("MFA_REQUIRED_FOR_PRIVILEGED_ROLES"))
+	trustProxyHeaders, _ := strconv.ParseBool(os.Getenv("TRUST_PROXY_HEADERS"))
+
+	loginThrottleConfig := service.LoginThrottleConfig{
+		Account: service.ThrottleRule{
+			FreeAttempts:     3,
+			BaseDelay:        time.Second,
+			MaxDelay:         5 * time.Minute,
+			LockoutThreshold: getEnvInt("LOGIN_MAX_ATTEMPTS", 10),
+			LockoutDuration:  getEnvDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		},
+		IP: service.ThrottleRule{
+			FreeAttempts:     20,
+			BaseDelay:        time.Second,
+			MaxDelay:         5 * time.Minute,
+			LockoutThreshold: getEnvInt("LOGIN_IP_MAX_ATTEMPTS", 100),
+			LockoutDuration:  getEnvDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		},
+		ResetAfter: getEnvDuration("LOGIN_FAILURE_WINDOW", time.Hour),
+	}
+
+	tokenValidation := middleware.TokenValidation{
+		Issuer:     getEnv("JWT_ISSUER", "cinebase"),
+		Audience:   getEnv("JWT_AUDIENCE", "cinebase-api"),
+		Algorithms: getEnvList("JWT_ALGORITHMS"),
+		Leeway:     getEnvDuration("JWT_LEEWAY", 30*time.Second),
+	}
+
+	return &ConfigurationManager{
+		PostgresqlConfig: postgresqlConfig,
+		AutoMigrate:      autoMigrate,
+		GraphqlLimits:    graphqlLimits,
+		PersistedQueries: persistedQueryConfig,
+
+		AutocompleteCacheSize: getEnvInt("AUTOCOMPLETE_CACHE_SIZE", 500),
+		BootstrapAdminEmail:   os.Getenv("BOOTSTRAP_ADMIN_EMAIL"),
+		SigningKeyDir:         os.Getenv("JWT_KEY_DIR"),
+		SigningKeyId:          os.Getenv("JWT_SIGNING_KEY_ID"),
+		TokenValidation:       tokenValidation,
+		LoginThrottle:         loginThrottleConfig,
+		Mfa: service.MfaConfig{
+			TotpIssuer:                 getEnv("MFA_TOTP_ISSUER", "Cinebase"),
+			ChallengeTTL:               getEnvDuration("MFA_CHALLENGE_TTL", 5*time.Minute),
+			RequiredForPrivilegedRoles: mfaRequired,
+			Issuer:                     tokenValidation.Issuer,
+		},
+		ApiKeys: service.ApiKeyConfig{
+			MaxPerUser: getEnvInt("API_KEYS_MAX_PER_USER", 10),
+		},
+		PasswordPolicy: service.PasswordPolicyConfig{
+			MinLength:        getEnvInt("PASSWORD_MIN_LENGTH", 8),
+			MaxLength:        getEnvInt("PASSWORD_MAX_LENGTH", 72),
+			MinStrength:      getEnvInt("PASSWORD_MIN_STRENGTH", 2),
+			BreachedHashFile: os.Getenv("PASSWORD_BREACHED_HASH_FILE"),
+		},
+		PasswordHashing: hashing.Config{
+			Algorithm:         hashing.Algorithm(getEnv("PASSWORD_HASH_ALGORITHM", string(hashing.AlgorithmArgon2id))),
+			BcryptCost:        getEnvInt("PASSWORD_BCRYPT_COST", 10),
+			Argon2Memory:      getEnvInt("PASSWORD_ARGON2_MEMORY", 19*1024),
+			Argon2Iterations:  getEnvInt("PASSWORD_ARGON2_ITERATIONS", 2),
+			Argon2Parallelism: getEnvInt("PASSWORD_ARGON2_PARALLELISM", 1),
+		},
+		Oidc: service.OidcConfig{
+			Provider: oidc.Config{
+				IssuerURL:    os.Getenv("OIDC_ISSUER_URL"),
+				ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+				ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+				RedirectURL:  getEnv("OIDC_REDIRECT_URL", "http://localhost:8080/oidc/callback"),
+				Scopes:       strings.Fields(getEnv("OIDC_SCOPES", "openid email profile")),
+				Leeway:       tokenValidation.Leeway,
+			},
+			RoleClaim:   os.Getenv("OIDC_ROLE_CLAIM"),
+			RoleMapping: getEnvRoleMapping("OIDC_ROLE_MAPPING"),
+			StateTTL:    getEnvDuration("OIDC_STATE_TTL", 10*time.Minute),
+			Issuer:      tokenValidation.Issuer,
+		},
+		OidcClientRedirectURL: getEnv("OIDC_CLIENT_REDIRECT_URL", "http://localhost:5173/sso"),
+		TrustProxyHeaders:     trustProxyHeaders,
+		PasswordReset: service.PasswordResetConfig{
+			TokenTTL:        getEnvDuration("PASSWORD_RESET_TTL", time.Hour),
+			RequestCooldown: getEnvDuration("PASSWORD_RESET_COOLDOWN", 5*time.Minute),
+			ResetURL:        getEnv("PASSWORD_RESET_URL", "http://localhost:5173/reset-password"),
+		},
+		EmailVerification: service.EmailVerificationConfig{
+			Policy:              domain.VerificationPolicy(getEnv("EMAIL_VERIFICATION_POLICY", string(domain.VerificationPolicyWrite))),
+			TokenTTL:            getEnvDuration("EMAIL_VERIFICATION_TTL", 48*time.Hour),
+			ResendCooldown:      getEnvDuration("EMAIL_VERIFICATION_COOLDOWN", 5*time.Minute),
+			VerifyURL:           getEnv("EMAIL_VERIFICATION_URL", "http://localhost:5173/verify-email"),
+			Issuer:              tokenValidation.Issuer,
+			BootstrapAdminEmail: os.Getenv("BOOTSTRAP_ADMIN_EMAIL"),
+		},
+		Mail: mail.Config{
+			From:         getEnv("MAIL_FROM", "Cinebase <no-reply@cinebase.local>"),
+			SMTPHost:     os.Getenv("SMTP_HOST"),
+			SMTPPort:     os.Getenv("SMTP_PORT"),
+			SMTPUsername: os.Getenv("SMTP_USERNAME"),
+			SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+			Dir:          os.Getenv("MAIL_DIR"),
+			QueueSize:    getEnvInt("MAIL_QUEUE_SIZE", 100),
+			QueueWorkers: getEnvInt("MAIL_WORKERS", 2),
+			SendTimeout:  getEnvDuration("MAIL_SEND_TIMEOUT", 30*time.Second),
+		},
+		Tokens: service.TokenConfig{
+			AccessTokenTTL:  getEnvDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+			RefreshTokenTTL: getEnvDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+			Issuer:          tokenValidation.Issuer,
+			Audience:        tokenValidation.Audience,
+		},
+	}
+}
+
+// getEnv reads a string environment variable, falling back to defaultValue
+// when it is unset.
+func getEnv(key string, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvList reads a comma separated list such as "EdDSA,RS256".
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getEnvRoleMapping reads claim values mapped to roles, such as
+// "cinebase-admins=admin,cinebase-editors=editor".
+func getEnvRoleMapping(key string) map[string]domain.Role {
+	mapping := make(map[string]domain.Role)
+	for _, entry := range getEnvList(key) {
+		value, role, _ := strings.Cut(entry, "=")
+		mapping[strings.TrimSpace(value)] = domain.Role(strings.TrimSpace(role))
+	}
+	return mapping
+}
+
+// getEnvInt reads an integer environment variable, falling back to defaultValue
+// when it is unset or malformed.
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvDuration reads a duration such as "15m" from the environment, falling
+// back to defaultValue when it is unset or malformed.
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || value <= 0 {
+		return defaultValue
+	}
+	return value
 }
@@ -0,0 +1,159 @@
+// Package breach checks passwords against the SHA-1 hashes of passwords
+// leaked in data breaches, as published by Have I Been Pwned.
+//
+// Lookups use the k-anonymity model of the Pwned Passwords range API: only
+// the first five hex characters of a hash select a range of candidates, and
+// the rest of the hash is compared locally. The hashes are read from a local
+// copy of the list, so passwords never leave the server.
+package breach
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// PrefixLength is how many hex characters of a hash select its range.
+const PrefixLength = 5
+
+// RangeSource returns the hash suffixes of a range and how often each
+// password was seen.
+type RangeSource interface {
+	Range(prefix string) (map[string]int, error)
+}
+
+// Count tells how often password appears in the breaches of source.
+func Count(source RangeSource, password string) (int, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	suffixes, err := source.Range(hash[:PrefixLength])
+	if err != nil {
+		return 0, err
+	}
+	return suffixes[hash[PrefixLength:]], nil
+}
+
+// HashFile reads ranges from a file of "HASH:COUNT" lines sorted by hash,
+// such as the ordered-by-hash SHA-1 download of Pwned Passwords. The file is
+// searched in place, so its size doesn't matter, and can be read by several
+// requests at once.
+type HashFile struct {
+	file *os.File
+	size int64
+}
+
+func OpenHashFile(path string) (*HashFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &HashFile{file: file, size: info.Size()}, nil
+}
+
+func (hashFile *HashFile) Close() error {
+	return hashFile.file.Close()
+}
+
+// Range returns the suffixes of the hashes starting with prefix.
+func (hashFile *HashFile) Range(prefix string) (map[string]int, error) {
+	prefix = strings.ToUpper(prefix)
+	if len(prefix) != PrefixLength {
+		return nil, fmt.Errorf("hash prefix must have %d characters", PrefixLength)
+	}
+
+	offset, err := hashFile.rangeStart(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	suffixes := make(map[string]int)
+	scanner := bufio.NewScanner(io.NewSectionReader(hashFile.file, offset, hashFile.size-offset))
+	for scanner.Scan() {
+		hash, count, ok := parseLine(scanner.Bytes())
+		if !ok {
+			continue
+		}
+		if !strings.HasPrefix(hash, prefix) {
+			break
+		}
+		suffixes[hash[PrefixLength:]] = count
+	}
+	return suffixes, scanner.Err()
+}
+
+// rangeStart binary searches the offset of the first line whose hash isn't
+// below prefix. Each probe reads the first line starting at the probed offset
+// or after it.
+func (hashFile *HashFile) rangeStart(prefix string) (int64, error) {
+	low, high := int64(0), hashFile.size
+	for low < high {
+		middle := low + (high-low)/2
+		lineStart, hash, err := hashFile.lineAfter(middle)
+		if err != nil {
+			return 0, err
+		}
+		if lineStart >= hashFile.size || hash >= prefix {
+			high = middle
+		} else {
+			low = lineStart + 1
+		}
+	}
+	lineStart, _, err := hashFile.lineAfter(low)
+	return lineStart, err
+}
+
+// lineAfter returns the start and hash of the first line starting at offset
+// or after it, or the file size when there is none.
+func (hashFile *HashFile) lineAfter(offset int64) (int64, string, error) {
+	buffer := make([]byte, 256)
+	lineStart := offset
+	if offset > 0 {
+		n, err := hashFile.file.ReadAt(buffer, offset-1)
+		if err != nil && err != io.EOF {
+			return 0, "", err
+		}
+		newline := bytes.IndexByte(buffer[:n], '\n')
+		if newline < 0 {
+			return hashFile.size, "", nil
+		}
+		lineStart = offset + int64(newline)
+	}
+	if lineStart >= hashFile.size {
+		return hashFile.size, "", nil
+	}
+
+	n, err := hashFile.file.ReadAt(buffer, lineStart)
+	if err != nil && err != io.EOF {
+		return 0, "", err
+	}
+	line := buffer[:n]
+	if end := bytes.IndexByte(line, '\n'); end >= 0 {
+		line = line[:end]
+	}
+	hash, _, _ := parseLine(line)
+	return lineStart, hash, nil
+}
+
+func parseLine(line []byte) (string, int, bool) {
+	hash, count, ok := bytes.Cut(bytes.TrimSpace(line), []byte(":"))
+	if !ok {
+		return "", 0, false
+	}
+	n, err := strconv.Atoi(string(count))
+	if err != nil {
+		return "", 0, false
+	}
+	return strings.ToUpper(string(hash)), n, true
+}
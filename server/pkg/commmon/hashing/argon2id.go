@@ -0,0 +1,113 @@
+package hashing
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"math"
+	"strings"
+)
+
+const (
+	argon2idPrefix = "$argon2id$"
+	argon2SaltSize = 16
+	argon2KeySize  = 32
+)
+
+var errMalformedArgon2id = errors.New("malformed argon2id hash")
+
+// Argon2id hashes with argon2id into the PHC string format,
+// $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<key>,
+// so every hash carries the settings it was made with.
+type Argon2id struct {
+	params argon2Params
+}
+
+type argon2Params struct {
+	// memory is in KiB.
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+}
+
+func NewArgon2id(memory, iterations, parallelism int) (*Argon2id, error) {
+	if parallelism < 1 || parallelism > math.MaxUint8 {
+		return nil, fmt.Errorf("the argon2id parallelism must be between 1 and %d", math.MaxUint8)
+	}
+	if memory < 8*parallelism || int64(memory) > math.MaxUint32 {
+		return nil, errors.New("the argon2id memory must be at least 8 KiB per degree of parallelism")
+	}
+	if iterations < 1 || int64(iterations) > math.MaxUint32 {
+		return nil, errors.New("the argon2id iterations must be at least 1")
+	}
+	return &Argon2id{argon2Params{uint32(memory), uint32(iterations), uint8(parallelism)}}, nil
+}
+
+func (scheme *Argon2id) Recognizes(hash string) bool {
+	return strings.HasPrefix(hash, argon2idPrefix)
+}
+
+func (scheme *Argon2id) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", errors.New("error while generating a password salt")
+	}
+
+	params := scheme.params
+	key := argon2.IDKey([]byte(password), salt, params.iterations, params.memory, params.parallelism, argon2KeySize)
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version, params.memory, params.iterations, params.parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (scheme *Argon2id) Verify(hash, password string) (bool, error) {
+	params, salt, key, err := parseArgon2id(hash)
+	if err != nil {
+		return false, err
+	}
+
+	candidate := argon2.IDKey([]byte(password), salt, params.iterations, params.memory, params.parallelism, uint32(len(key)))
+	return subtle.ConstantTimeCompare(candidate, key) == 1, nil
+}
+
+func (scheme *Argon2id) NeedsRehash(hash string) bool {
+	params, _, key, err := parseArgon2id(hash)
+	return err != nil || params != scheme.params || len(key) != argon2KeySize
+}
+
+func parseArgon2id(hash string) (argon2Params, []byte, []byte, error) {
+	var params argon2Params
+
+	parts := strings.Split(strings.TrimPrefix(hash, argon2idPrefix), "$")
+	if len(parts) != 4 {
+		return params, nil, nil, errMalformedArgon2id
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[0], "v=%d", &version); err != nil {
+		return params, nil, nil, errMalformedArgon2id
+	}
+	if version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2id version %d", version)
+	}
+	if _, err := fmt.Sscanf(parts[1], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism); err != nil {
+		return params, nil, nil, errMalformedArgon2id
+	}
+	if params.iterations < 1 || params.parallelism < 1 {
+		return params, nil, nil, errMalformedArgon2id
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return params, nil, nil, errMalformedArgon2id
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, errMalformedArgon2id
+	}
+
+	return params, salt, key, nil
+}
@@ -0,0 +1,46 @@
+package hashing
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+)
+
+// Bcrypt hashes with bcrypt, which only uses the first 72 bytes of a password.
+type Bcrypt struct {
+	cost int
+}
+
+func NewBcrypt(cost int) (*Bcrypt, error) {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return nil, fmt.Errorf("the bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	return &Bcrypt{cost}, nil
+}
+
+// Recognizes accepts the $2a$, $2b$ and $2y$ prefixes of bcrypt hashes.
+func (scheme *Bcrypt) Recognizes(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func (scheme *Bcrypt) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), scheme.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (scheme *Bcrypt) Verify(hash, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (scheme *Bcrypt) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != scheme.cost
+}
@@ -0,0 +1,98 @@
+// Package hashing hashes passwords for storage and checks them again.
+//
+// Each Scheme recognizes its own hashes, so a Hasher can verify passwords
+// hashed by any scheme it knows while hashing new ones with the preferred
+// scheme and settings. Verify reports hashes made otherwise, so they can be
+// replaced while the plain password is at hand.
+package hashing
+
+import (
+	"errors"
+	"fmt"
+)
+
+type Algorithm string
+
+const (
+	AlgorithmArgon2id Algorithm = "argon2id"
+	AlgorithmBcrypt   Algorithm = "bcrypt"
+)
+
+var ErrUnknownHash = errors.New("password hash has an unknown format")
+
+// Scheme is one way of hashing passwords.
+type Scheme interface {
+	// Recognizes tells whether hash was made by the scheme.
+	Recognizes(hash string) bool
+	Hash(password string) (string, error)
+	// Verify tells whether password matches a hash the scheme recognizes.
+	Verify(hash, password string) (bool, error)
+	// NeedsRehash tells whether a recognized hash was made with settings
+	// other than the scheme's current ones.
+	NeedsRehash(hash string) bool
+}
+
+type Config struct {
+	// Algorithm hashes new passwords; hashes of the other ones still verify.
+	Algorithm  Algorithm
+	BcryptCost int
+	// Argon2Memory is in KiB.
+	Argon2Memory      int
+	Argon2Iterations  int
+	Argon2Parallelism int
+}
+
+// Hasher hashes with its preferred scheme and verifies with all of them.
+type Hasher struct {
+	preferred Scheme
+	schemes   []Scheme
+}
+
+// NewHasher returns a Hasher hashing with preferred that also verifies the
+// hashes of legacy.
+func NewHasher(preferred Scheme, legacy ...Scheme) *Hasher {
+	return &Hasher{preferred, append([]Scheme{preferred}, legacy...)}
+}
+
+// New returns a Hasher for the algorithm of config that verifies argon2id
+// and bcrypt hashes.
+func New(config Config) (*Hasher, error) {
+	argon2id, err := NewArgon2id(config.Argon2Memory, config.Argon2Iterations, config.Argon2Parallelism)
+	if err != nil {
+		return nil, err
+	}
+	bcrypt, err := NewBcrypt(config.BcryptCost)
+	if err != nil {
+		return nil, err
+	}
+
+	switch config.Algorithm {
+	case AlgorithmArgon2id:
+		return NewHasher(argon2id, bcrypt), nil
+	case AlgorithmBcrypt:
+		return NewHasher(bcrypt, argon2id), nil
+	}
+	return nil, fmt.Errorf("unknown password hash algorithm %q, must be argon2id or bcrypt", config.Algorithm)
+}
+
+// Hash hashes password with the preferred scheme.
+func (hasher *Hasher) Hash(password string) (string, error) {
+	return hasher.preferred.Hash(password)
+}
+
+// Verify tells whether password matches hash and, if so, whether hash should
+// be replaced by a new Hash of it. Hashes no scheme recognizes fail with
+// ErrUnknownHash.
+func (hasher *Hasher) Verify(hash, password string) (matches bool, rehash bool, err error) {
+	for _, scheme := range hasher.schemes {
+		if !scheme.Recognizes(hash) {
+			continue
+		}
+		matches, err = scheme.Verify(hash, password)
+		if err != nil || !matches {
+			return false, false, err
+		}
+		return true, scheme != hasher.preferred || scheme.NeedsRehash(hash), nil
+	}
+	return false, false, ErrUnknownHash
+}
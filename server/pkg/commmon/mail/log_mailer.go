@@ -0,0 +1,47 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"github.com/labstack/gommon/log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// LogMailer is meant for local development. It writes every message to its own
+// .eml file in dir, or to the log when dir is empty, instead of sending it.
+type LogMailer struct {
+	dir     string
+	from    string
+	counter atomic.Int64
+}
+
+func NewLogMailer(dir string, from string) *LogMailer {
+	return &LogMailer{dir: dir, from: from}
+}
+
+func (mailer *LogMailer) Send(_ context.Context, message Message) error {
+	content, err := format(mailer.from, message)
+	if err != nil {
+		return err
+	}
+
+	if mailer.dir == "" {
+		log.Infof("mail to %s:\n%s", message.To, content)
+		return nil
+	}
+
+	if err = os.MkdirAll(mailer.dir, 0o700); err != nil {
+		return fmt.Errorf("error while creating the mail directory: %w", err)
+	}
+
+	name := fmt.Sprintf("%s-%d.eml", time.Now().UTC().Format("20060102-150405"), mailer.counter.Add(1))
+	if err = os.WriteFile(filepath.Join(mailer.dir, name), content, 0o600); err != nil {
+		return fmt.Errorf("error while writing mail: %w", err)
+	}
+
+	log.Infof("mail to %s written to %s", message.To, name)
+	return nil
+}
@@ -0,0 +1,75 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var ErrInvalidHeader = errors.New("mail headers can't contain line breaks")
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages, giving up once ctx is done. Implementations must
+// be safe for concurrent use.
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
+}
+
+// Config picks and configures the Mailer built by New.
+type Config struct {
+	From string
+	// SMTP settings, messages are sent through SMTPHost when it is set.
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	// Dir is where the development mailer writes messages, they are only
+	// logged when it is empty.
+	Dir string
+	// Queue settings, see NewQueue.
+	QueueSize    int
+	QueueWorkers int
+	SendTimeout  time.Duration
+}
+
+// New returns an SMTP mailer when an SMTP host is configured and the
+// development mailer otherwise.
+func New(config Config) Mailer {
+	if config.SMTPHost != "" {
+		return NewSMTPMailer(config.SMTPHost, config.SMTPPort, config.SMTPUsername, config.SMTPPassword, config.From)
+	}
+	return NewLogMailer(config.Dir, config.From)
+}
+
+// format renders message as an RFC 5322 document with CRLF line endings.
+func format(from string, message Message) ([]byte, error) {
+	for _, header := range []string{from, message.To, message.Subject} {
+		if strings.ContainsAny(header, "\r\n") {
+			return nil, ErrInvalidHeader
+		}
+	}
+
+	var buffer bytes.Buffer
+	fmt.Fprintf(&buffer, "From: %s\r\n", from)
+	fmt.Fprintf(&buffer, "To: %s\r\n", message.To)
+	fmt.Fprintf(&buffer, "Subject: %s\r\n", message.Subject)
+	fmt.Fprintf(&buffer, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buffer.WriteString("MIME-Version: 1.0\r\n")
+	buffer.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buffer.WriteString("\r\n")
+
+	body := strings.ReplaceAll(message.Body, "\r\n", "\n")
+	buffer.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	buffer.WriteString("\r\n")
+
+	return buffer.Bytes(), nil
+}
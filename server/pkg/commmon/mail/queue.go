@@ -0,0 +1,116 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"github.com/labstack/gommon/log"
+	"sync"
+	"time"
+)
+
+var (
+	ErrQueueFull   = errors.New("the mail queue is full")
+	ErrQueueClosed = errors.New("the mail queue is closed")
+)
+
+// Queue sends messages in the background, so a request answers just as fast
+// whether or not it mails someone. It holds a bounded number of messages,
+// gives each one a limited time to be delivered and is drained by Close when
+// the server shuts down.
+type Queue struct {
+	mailer  Mailer
+	timeout time.Duration
+	jobs    chan queuedMessage
+	workers sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+type queuedMessage struct {
+	message   Message
+	onFailure func(error)
+}
+
+// NewQueue starts workers that send queued messages through mailer, holding
+// at most size messages that aren't being sent yet and giving up on a message
+// after timeout.
+func NewQueue(mailer Mailer, workers int, size int, timeout time.Duration) *Queue {
+	queue := &Queue{mailer: mailer, timeout: timeout, jobs: make(chan queuedMessage, max(size, 0))}
+
+	for range max(workers, 1) {
+		queue.workers.Add(1)
+		go queue.work()
+	}
+	return queue
+}
+
+// Enqueue queues message for delivery. onFailure, which may be nil, is called
+// with the error if the message can't be sent, including when the queue is
+// full or closed.
+func (queue *Queue) Enqueue(message Message, onFailure func(error)) {
+	job := queuedMessage{message, onFailure}
+	if err := queue.push(job); err != nil {
+		job.fail(err)
+	}
+}
+
+func (queue *Queue) push(job queuedMessage) error {
+	queue.mu.RLock()
+	defer queue.mu.RUnlock()
+
+	if queue.closed {
+		return ErrQueueClosed
+	}
+	select {
+	case queue.jobs <- job:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Close stops taking messages and waits until the queued ones are sent or ctx
+// is done, in which case the rest are dropped.
+func (queue *Queue) Close(ctx context.Context) error {
+	queue.mu.Lock()
+	if !queue.closed {
+		queue.closed = true
+		close(queue.jobs)
+	}
+	queue.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		queue.workers.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (queue *Queue) work() {
+	defer queue.workers.Done()
+
+	for job := range queue.jobs {
+		ctx, cancel := context.WithTimeout(context.Background(), queue.timeout)
+		err := queue.mailer.Send(ctx, job.message)
+		cancel()
+
+		if err != nil {
+			job.fail(err)
+		}
+	}
+}
+
+func (job queuedMessage) fail(err error) {
+	log.Errorf("mail to %s wasn't sent: %v", job.message.To, err)
+	if job.onFailure != nil {
+		job.onFailure(err)
+	}
+}
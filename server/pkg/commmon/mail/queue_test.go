@@ -0,0 +1,83 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingMailer holds every message until release is closed.
+type blockingMailer struct {
+	release chan struct{}
+
+	mu   sync.Mutex
+	sent []Message
+}
+
+func (mailer *blockingMailer) Send(ctx context.Context, message Message) error {
+	select {
+	case <-mailer.release:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	mailer.mu.Lock()
+	defer mailer.mu.Unlock()
+	mailer.sent = append(mailer.sent, message)
+	return nil
+}
+
+func TestQueueCloseDrainsQueuedMessages(t *testing.T) {
+	mailer := &blockingMailer{release: make(chan struct{})}
+	queue := NewQueue(mailer, 1, 10, time.Second)
+
+	for range 3 {
+		queue.Enqueue(Message{To: "jane@example.com"}, func(err error) { t.Errorf("sending failed: %v", err) })
+	}
+	close(mailer.release)
+
+	if err := queue.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(mailer.sent) != 3 {
+		t.Errorf("%d messages sent before Close returned, want 3", len(mailer.sent))
+	}
+
+	var failure error
+	queue.Enqueue(Message{To: "jane@example.com"}, func(err error) { failure = err })
+	if failure != ErrQueueClosed {
+		t.Errorf("enqueueing after Close failed with %v, want ErrQueueClosed", failure)
+	}
+}
+
+func TestQueueReportsFailures(t *testing.T) {
+	mailer := &blockingMailer{release: make(chan struct{})}
+	queue := NewQueue(mailer, 1, 1, 20*time.Millisecond)
+
+	failures := make(chan error, 3)
+	for range 3 {
+		queue.Enqueue(Message{To: "jane@example.com"}, func(err error) { failures <- err })
+	}
+	if err := queue.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	close(failures)
+
+	var full, timedOut int
+	for err := range failures {
+		switch {
+		case err == ErrQueueFull:
+			full++
+		case errors.Is(err, context.DeadlineExceeded):
+			timedOut++
+		default:
+			t.Errorf("unexpected failure %v", err)
+		}
+	}
+	// One message is being sent, one waits and the third doesn't fit.
+	if full < 1 || full+timedOut != 3 {
+		t.Errorf("%d messages didn't fit and %d timed out, want 3 failures with at least one full queue", full, timedOut)
+	}
+}
@@ -0,0 +1,111 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+)
+
+// SMTPMailer sends messages through an SMTP server, upgrading the connection
+// with STARTTLS when the server offers it. Without a username no
+// authentication is attempted, which suits local relays and fake servers.
+type SMTPMailer struct {
+	host    string
+	address string
+	auth    smtp.Auth
+	from    string
+}
+
+func NewSMTPMailer(host, port, username, password, from string) *SMTPMailer {
+	if port == "" {
+		port = "587"
+	}
+
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return &SMTPMailer{host: host, address: net.JoinHostPort(host, port), auth: auth, from: from}
+}
+
+func (mailer *SMTPMailer) Send(ctx context.Context, message Message) error {
+	content, err := format(mailer.from, message)
+	if err != nil {
+		return err
+	}
+
+	// The envelope takes bare addresses, the headers may carry display names.
+	sender, err := netmail.ParseAddress(mailer.from)
+	if err != nil {
+		return fmt.Errorf("invalid sender address %s: %w", mailer.from, err)
+	}
+	recipient, err := netmail.ParseAddress(message.To)
+	if err != nil {
+		return fmt.Errorf("invalid recipient address %s: %w", message.To, err)
+	}
+
+	if err = mailer.send(ctx, sender.Address, recipient.Address, content); err != nil {
+		return fmt.Errorf("error while sending mail to %s: %w", message.To, err)
+	}
+	return nil
+}
+
+// send does what smtp.SendMail does, but on a connection that is closed once
+// ctx is done, so a stalled server can't hold on to the caller.
+func (mailer *SMTPMailer) send(ctx context.Context, from, to string, content []byte) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", mailer.address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, mailer.host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err = client.StartTLS(&tls.Config{ServerName: mailer.host}); err != nil {
+			return err
+		}
+	}
+	if mailer.auth != nil {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return errors.New("the server doesn't support AUTH")
+		}
+		if err = client.Auth(mailer.auth); err != nil {
+			return err
+		}
+	}
+
+	if err = client.Mail(from); err != nil {
+		return err
+	}
+	if err = client.Rcpt(to); err != nil {
+		return err
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = writer.Write(content); err != nil {
+		return err
+	}
+	if err = writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
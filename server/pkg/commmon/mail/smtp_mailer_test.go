@@ -0,0 +1,194 @@
+package mail
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// receivedMail is what a fakeSMTPServer received in one transaction.
+type receivedMail struct {
+	from string
+	to   []string
+	data string
+}
+
+// fakeSMTPServer accepts one message per connection without TLS or
+// authentication and hands it to the test.
+type fakeSMTPServer struct {
+	listener net.Listener
+	received chan receivedMail
+}
+
+func startFakeSMTPServer(t *testing.T) *fakeSMTPServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &fakeSMTPServer{listener: listener, received: make(chan receivedMail, 1)}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (server *fakeSMTPServer) serve(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+
+	var mail receivedMail
+	text.PrintfLine("220 fake.test ESMTP")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		command, argument, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(command) {
+		case "EHLO", "HELO":
+			text.PrintfLine("250 fake.test")
+		case "MAIL":
+			mail.from = argument
+			text.PrintfLine("250 OK")
+		case "RCPT":
+			mail.to = append(mail.to, argument)
+			text.PrintfLine("250 OK")
+		case "DATA":
+			text.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := readData(text.R)
+			if err != nil {
+				return
+			}
+			mail.data = data
+			text.PrintfLine("250 OK")
+			server.received <- mail
+		case "QUIT":
+			text.PrintfLine("221 Bye")
+			return
+		default:
+			text.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+// readData reads a DATA section up to its final dot without undoing dot
+// stuffing or line endings, so the test sees exactly what was sent.
+func readData(reader *bufio.Reader) (string, error) {
+	var data strings.Builder
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		if line == ".\r\n" {
+			return data.String(), nil
+		}
+		data.WriteString(line)
+	}
+}
+
+func TestSMTPMailerSendsEnvelopeHeadersAndBody(t *testing.T) {
+	server := startFakeSMTPServer(t)
+	host, port, _ := net.SplitHostPort(server.listener.Addr().String())
+
+	mailer := NewSMTPMailer(host, port, "", "", "Cinebase <no-reply@cinebase.test>")
+	err := mailer.Send(context.Background(), Message{
+		To:      "Jane Doe <jane@example.com>",
+		Subject: "Reset your Cinebase password",
+		Body:    "First line\nSecond line",
+	})
+	if err != nil {
+		t.Fatalf("Send() = %v", err)
+	}
+
+	mail := <-server.received
+	if mail.from != "FROM:<no-reply@cinebase.test>" {
+		t.Errorf("MAIL %s, want the bare sender address", mail.from)
+	}
+	if len(mail.to) != 1 || mail.to[0] != "TO:<jane@example.com>" {
+		t.Errorf("RCPT %v, want only the bare recipient address", mail.to)
+	}
+
+	headers, body, found := strings.Cut(mail.data, "\r\n\r\n")
+	if !found {
+		t.Fatalf("no blank line between headers and body in %q", mail.data)
+	}
+	for _, header := range []string{
+		"From: Cinebase <no-reply@cinebase.test>",
+		"To: Jane Doe <jane@example.com>",
+		"Subject: Reset your Cinebase password",
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+	} {
+		if !strings.Contains(headers+"\r\n", header+"\r\n") {
+			t.Errorf("header %q missing from %q", header, headers)
+		}
+	}
+	if !strings.Contains(headers, "\r\nDate: ") {
+		t.Errorf("Date header missing from %q", headers)
+	}
+	if body != "First line\r\nSecond line\r\n" {
+		t.Errorf("body = %q, want the lines with CRLF endings", body)
+	}
+}
+
+func TestSMTPMailerRefusesHeaderInjection(t *testing.T) {
+	server := startFakeSMTPServer(t)
+	host, port, _ := net.SplitHostPort(server.listener.Addr().String())
+
+	mailer := NewSMTPMailer(host, port, "", "", "no-reply@cinebase.test")
+	err := mailer.Send(context.Background(), Message{To: "jane@example.com", Subject: "Hi\r\nBcc: everyone@example.com", Body: "Hello"})
+	if err != ErrInvalidHeader {
+		t.Errorf("Send() = %v, want ErrInvalidHeader", err)
+	}
+}
+
+func TestSMTPMailerGivesUpOnAStalledServer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	// Accepts connections but never greets.
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	mailer := NewSMTPMailer(host, port, "", "", "no-reply@cinebase.test")
+	done := make(chan error, 1)
+	go func() { done <- mailer.Send(ctx, Message{To: "jane@example.com", Subject: "Hi", Body: "Hello"}) }()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("Send() to a stalled server succeeded")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Send() didn't give up when its context was done")
+	}
+}
@@ -0,0 +1,287 @@
+package migration
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/labstack/gommon/log"
+)
+
+//go:embed sql/*.sql
+var migrationFiles embed.FS
+
+// advisoryLockKey is shared by every replica so that only one of them applies
+// migrations at a time; the others block until the lock is released.
+const advisoryLockKey int64 = 7_243_612_001
+
+const migrationTimeout = time.Minute * 5
+
+// ErrNoMigrationsTable means no migration was ever applied to the database.
+var ErrNoMigrationsTable = errors.New("no migrations table")
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+}
+
+type Migrator struct {
+	dbPool     *pgxpool.Pool
+	migrations []*Migration
+}
+
+func NewMigrator(dbPool *pgxpool.Pool) (*Migrator, error) {
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{dbPool: dbPool, migrations: migrations}, nil
+}
+
+// Up applies every pending migration in version order, each one in its own transaction.
+func (migrator *Migrator) Up(ctx context.Context) error {
+	return migrator.withLock(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range migrator.migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+
+			log.Infof("applying migration %06d_%s", migration.Version, migration.Name)
+			err = runInTransaction(ctx, conn, migration.Up,
+				"INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, NOW())",
+				migration.Version, migration.Name)
+			if err != nil {
+				return fmt.Errorf("migration %06d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// Down reverts the last steps applied migrations, newest first.
+func (migrator *Migrator) Down(ctx context.Context, steps int) error {
+	if steps < 1 {
+		return errors.New("number of steps to roll back must be positive")
+	}
+
+	return migrator.withLock(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(migrator.migrations) - 1; i >= 0 && steps > 0; i-- {
+			migration := migrator.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if migration.Down == "" {
+				return fmt.Errorf("migration %06d_%s has no down script", migration.Version, migration.Name)
+			}
+
+			log.Infof("reverting migration %06d_%s", migration.Version, migration.Name)
+			err = runInTransaction(ctx, conn, migration.Down,
+				"DELETE FROM schema_migrations WHERE version = $1", migration.Version)
+			if err != nil {
+				return fmt.Errorf("reverting migration %06d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			steps--
+		}
+		return nil
+	})
+}
+
+// Status lists every known migration together with the time it was applied, if it was.
+// It only reads, so it neither waits for a running migration nor creates the
+// schema_migrations table; without that table it fails with ErrNoMigrationsTable.
+func (migrator *Migrator) Status(ctx context.Context) ([]*MigrationStatus, error) {
+	ctx, cancel := context.WithTimeout(ctx, migrationTimeout)
+	defer cancel()
+
+	conn, err := migrator.dbPool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	var tableExists bool
+	if err = conn.QueryRow(ctx, "SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&tableExists); err != nil {
+		return nil, err
+	}
+	if !tableExists {
+		return nil, ErrNoMigrationsTable
+	}
+
+	applied, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []*MigrationStatus
+	for _, migration := range migrator.migrations {
+		status := &MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if appliedAt, ok := applied[migration.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+func (migrator *Migrator) withLock(ctx context.Context, fn func(conn *pgxpool.Conn) error) error {
+	ctx, cancel := context.WithTimeout(ctx, migrationTimeout)
+	defer cancel()
+
+	conn, err := migrator.dbPool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err = conn.Exec(ctx, "SELECT pg_advisory_lock($1)", advisoryLockKey); err != nil {
+		return fmt.Errorf("error while acquiring migration lock: %w", err)
+	}
+	defer func() {
+		if _, unlockErr := conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", advisoryLockKey); unlockErr != nil {
+			log.Errorf("error while releasing migration lock: %v", unlockErr)
+		}
+	}()
+
+	createTableQuery := `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    BIGINT PRIMARY KEY,
+		name       VARCHAR(255) NOT NULL,
+		applied_at TIMESTAMP NOT NULL DEFAULT NOW()
+	)`
+	if _, err = conn.Exec(ctx, createTableQuery); err != nil {
+		return fmt.Errorf("error while creating schema_migrations table: %w", err)
+	}
+
+	return fn(conn)
+}
+
+func appliedVersions(ctx context.Context, conn *pgxpool.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.Query(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		if err = rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+func runInTransaction(ctx context.Context, conn *pgxpool.Conn, script string, bookkeeping string, args ...interface{}) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err = tx.Exec(ctx, script); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(ctx, bookkeeping, args...); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// loadMigrations reads files named <version>_<name>.up.sql / <version>_<name>.down.sql
+// and returns them sorted by version.
+func loadMigrations(fileSystem fs.FS) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fileSystem, "sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		fileName := entry.Name()
+
+		var direction string
+		switch {
+		case strings.HasSuffix(fileName, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(fileName, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		base := strings.TrimSuffix(fileName, "."+direction+".sql")
+		versionPart, name, found := strings.Cut(base, "_")
+		if !found {
+			return nil, fmt.Errorf("invalid migration file name: %s", fileName)
+		}
+
+		version, err := strconv.ParseInt(versionPart, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %w", fileName, err)
+		}
+
+		content, err := fs.ReadFile(fileSystem, "sql/"+fileName)
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		} else if migration.Name != name {
+			return nil, fmt.Errorf("conflicting names for migration version %d: %s and %s", version, migration.Name, name)
+		}
+
+		if direction == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	var migrations []*Migration
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %06d_%s has no up script", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS genres (
+    id         SERIAL PRIMARY KEY,
+    genre      VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS movies (
+    id           SERIAL PRIMARY KEY,
+    title        VARCHAR(512) NOT NULL,
+    release_date DATE NOT NULL,
+    runtime      INTEGER NOT NULL,
+    mpaa_rating  VARCHAR(10) NOT NULL,
+    description  TEXT NOT NULL,
+    image        VARCHAR(255),
+    created_at   TIMESTAMP NULL DEFAULT NOW(),
+    updated_at   TIMESTAMP NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS movies_genres (
+    id       SERIAL PRIMARY KEY,
+    movie_id INTEGER NOT NULL REFERENCES movies (id) ON DELETE CASCADE,
+    genre_id INTEGER NOT NULL REFERENCES genres (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS movies_genres_movie_id_idx ON movies_genres (movie_id);
+CREATE INDEX IF NOT EXISTS movies_genres_genre_id_idx ON movies_genres (genre_id);
+
+CREATE TABLE IF NOT EXISTS cinebase_users (
+    id         SERIAL PRIMARY KEY,
+    email      VARCHAR(255) NOT NULL UNIQUE,
+    password   VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS movies_created_at_id_idx;
+DROP INDEX IF EXISTS movies_runtime_id_idx;
+DROP INDEX IF EXISTS movies_release_date_id_idx;
+DROP INDEX IF EXISTS movies_title_id_idx;
@@ -0,0 +1,4 @@
+CREATE INDEX IF NOT EXISTS movies_title_id_idx ON movies (title, id);
+CREATE INDEX IF NOT EXISTS movies_release_date_id_idx ON movies (release_date, id);
+CREATE INDEX IF NOT EXISTS movies_runtime_id_idx ON movies (runtime, id);
+CREATE INDEX IF NOT EXISTS movies_created_at_id_idx ON movies ((COALESCE(created_at, 'epoch'::timestamp)), id);
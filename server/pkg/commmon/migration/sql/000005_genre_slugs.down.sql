@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS movies_genres_movie_id_genre_id_idx;
+DROP INDEX IF EXISTS genres_slug_idx;
+ALTER TABLE genres DROP COLUMN IF EXISTS slug;
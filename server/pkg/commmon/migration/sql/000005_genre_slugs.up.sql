@@ -0,0 +1,21 @@
+ALTER TABLE genres ADD COLUMN IF NOT EXISTS slug VARCHAR(255);
+
+UPDATE genres
+SET slug = COALESCE(NULLIF(TRIM(BOTH '-' FROM REGEXP_REPLACE(LOWER(genre), '[^a-z0-9]+', '-', 'g')), ''), 'genre')
+WHERE slug IS NULL;
+
+-- Genres whose names collapse to the same slug keep it only for the oldest one.
+UPDATE genres g
+SET slug = g.slug || '-' || g.id
+WHERE EXISTS (SELECT 1 FROM genres other WHERE other.slug = g.slug AND other.id < g.id);
+
+ALTER TABLE genres ALTER COLUMN slug SET NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS genres_slug_idx ON genres (slug);
+
+-- Merging genres must not leave a movie linked twice to the same genre.
+DELETE FROM movies_genres mg
+USING movies_genres duplicate
+WHERE duplicate.movie_id = mg.movie_id AND duplicate.genre_id = mg.genre_id AND duplicate.id < mg.id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS movies_genres_movie_id_genre_id_idx ON movies_genres (movie_id, genre_id);
@@ -0,0 +1,2 @@
+ALTER TABLE cinebase_users DROP CONSTRAINT IF EXISTS cinebase_users_role_check;
+ALTER TABLE cinebase_users DROP COLUMN IF EXISTS role;
@@ -0,0 +1,4 @@
+ALTER TABLE cinebase_users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'viewer';
+
+ALTER TABLE cinebase_users DROP CONSTRAINT IF EXISTS cinebase_users_role_check;
+ALTER TABLE cinebase_users ADD CONSTRAINT cinebase_users_role_check CHECK (role IN ('viewer', 'editor', 'admin'));
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id                SERIAL PRIMARY KEY,
+    user_id           INTEGER NOT NULL REFERENCES cinebase_users (id) ON DELETE CASCADE,
+    family_id         VARCHAR(64) NOT NULL,
+    token_hash        VARCHAR(64) NOT NULL UNIQUE,
+    access_jti        VARCHAR(64) NOT NULL,
+    access_expires_at TIMESTAMPTZ NOT NULL,
+    expires_at        TIMESTAMPTZ NOT NULL,
+    used_at           TIMESTAMPTZ NULL,
+    revoked_at        TIMESTAMPTZ NULL,
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+CREATE INDEX IF NOT EXISTS refresh_tokens_user_id_idx ON refresh_tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    jti        VARCHAR(64) PRIMARY KEY,
+    expires_at TIMESTAMPTZ NOT NULL
+);
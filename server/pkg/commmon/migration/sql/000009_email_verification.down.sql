@@ -0,0 +1,2 @@
+ALTER TABLE cinebase_users DROP COLUMN IF EXISTS verification_sent_at;
+ALTER TABLE cinebase_users DROP COLUMN IF EXISTS email_verified_at;
@@ -0,0 +1,5 @@
+ALTER TABLE cinebase_users ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMPTZ NULL;
+ALTER TABLE cinebase_users ADD COLUMN IF NOT EXISTS verification_sent_at TIMESTAMPTZ NULL;
+
+-- Accounts created before verification existed are trusted as they are.
+UPDATE cinebase_users SET email_verified_at = NOW() WHERE email_verified_at IS NULL;
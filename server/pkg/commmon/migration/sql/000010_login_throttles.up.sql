@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS login_throttles (
+    subject         VARCHAR(320) PRIMARY KEY,
+    failures        INTEGER NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    blocked_until   TIMESTAMPTZ NULL
+);
@@ -0,0 +1,7 @@
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS mfa;
+
+DROP TABLE IF EXISTS mfa_recovery_codes;
+
+ALTER TABLE cinebase_users DROP COLUMN IF EXISTS totp_last_step;
+ALTER TABLE cinebase_users DROP COLUMN IF EXISTS totp_confirmed_at;
+ALTER TABLE cinebase_users DROP COLUMN IF EXISTS totp_secret;
@@ -0,0 +1,14 @@
+ALTER TABLE cinebase_users ADD COLUMN IF NOT EXISTS totp_secret VARCHAR(64) NULL;
+ALTER TABLE cinebase_users ADD COLUMN IF NOT EXISTS totp_confirmed_at TIMESTAMPTZ NULL;
+ALTER TABLE cinebase_users ADD COLUMN IF NOT EXISTS totp_last_step BIGINT NULL;
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+    id         SERIAL PRIMARY KEY,
+    user_id    INTEGER NOT NULL REFERENCES cinebase_users (id) ON DELETE CASCADE,
+    code_hash  VARCHAR(64) NOT NULL,
+    used_at    TIMESTAMPTZ NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, code_hash)
+);
+
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS mfa BOOLEAN NOT NULL DEFAULT FALSE;
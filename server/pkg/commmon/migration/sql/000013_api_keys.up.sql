@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+    id           SERIAL PRIMARY KEY,
+    user_id      INTEGER NOT NULL REFERENCES cinebase_users (id) ON DELETE CASCADE,
+    name         VARCHAR(100) NOT NULL,
+    prefix       VARCHAR(16) NOT NULL UNIQUE,
+    key_hash     VARCHAR(64) NOT NULL,
+    scopes       TEXT[] NOT NULL,
+    mfa          BOOLEAN NOT NULL DEFAULT FALSE,
+    expires_at   TIMESTAMPTZ NULL,
+    last_used_at TIMESTAMPTZ NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_user_id_idx ON api_keys (user_id);
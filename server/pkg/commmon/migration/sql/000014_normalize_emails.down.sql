@@ -0,0 +1,2 @@
+-- The original spelling of the emails isn't kept, so only the index is undone.
+DROP INDEX IF EXISTS cinebase_users_lower_email_idx;
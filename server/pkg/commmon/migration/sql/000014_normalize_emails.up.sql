@@ -0,0 +1,29 @@
+-- Emails are stored trimmed and in lower case from now on. Accounts whose
+-- emails only differ in case or surrounding spaces would then clash; the
+-- migration refuses to pick one of them and lists them instead, to be merged
+-- or renamed by hand.
+DO $$
+DECLARE
+    collisions TEXT;
+BEGIN
+    SELECT string_agg(normalized_email || ' (ids ' || ids || ')', ', ' ORDER BY normalized_email)
+    INTO collisions
+    FROM (
+        SELECT LOWER(TRIM(email)) AS normalized_email, string_agg(id::TEXT, ', ' ORDER BY id) AS ids
+        FROM cinebase_users
+        GROUP BY LOWER(TRIM(email))
+        HAVING COUNT(*) > 1
+    ) clashing;
+
+    IF collisions IS NOT NULL THEN
+        RAISE EXCEPTION 'accounts share an email once it is normalized: %', collisions
+            USING HINT = 'Merge or rename these accounts, then run the migration again.';
+    END IF;
+END
+$$;
+
+UPDATE cinebase_users SET email = LOWER(TRIM(email)), updated_at = NOW() WHERE email <> LOWER(TRIM(email));
+
+-- Keeps emails unique however they are spelled, and serves case-insensitive
+-- lookups.
+CREATE UNIQUE INDEX IF NOT EXISTS cinebase_users_lower_email_idx ON cinebase_users (LOWER(email));
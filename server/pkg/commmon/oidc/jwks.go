@@ -0,0 +1,105 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"math/big"
+)
+
+// jsonWebKey is a provider's public key as described by RFC 7517.
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyId   string `json:"kid"`
+	Use     string `json:"use"`
+	// RSA keys
+	Modulus  string `json:"n"`
+	Exponent string `json:"e"`
+	// EC and OKP keys
+	Curve string `json:"crv"`
+	X     string `json:"x"`
+	Y     string `json:"y"`
+}
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+// publicKeys returns the signing keys of the set by kid. Encryption keys and
+// keys of unsupported types are left out.
+func (keySet *jsonWebKeySet) publicKeys() map[string]crypto.PublicKey {
+	keys := make(map[string]crypto.PublicKey)
+	for _, jwk := range keySet.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if key, err := jwk.publicKey(); err == nil {
+			keys[jwk.KeyId] = key
+		}
+	}
+	return keys
+}
+
+func (jwk *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch jwk.KeyType {
+	case "RSA":
+		modulus, err := decodeInt(jwk.Modulus)
+		if err != nil {
+			return nil, err
+		}
+		exponent, err := decodeInt(jwk.Exponent)
+		if err != nil {
+			return nil, err
+		}
+		if !exponent.IsInt64() || modulus.BitLen() < 2048 {
+			return nil, errors.New("unsupported RSA key")
+		}
+		return &rsa.PublicKey{N: modulus, E: int(exponent.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errors.New("unsupported curve " + jwk.Curve)
+		}
+		x, err := decodeInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("EC point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if jwk.Curve != "Ed25519" {
+			return nil, errors.New("unsupported curve " + jwk.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, errors.New("unsupported key type " + jwk.KeyType)
+}
+
+func decodeInt(value string) (*big.Int, error) {
+	bytes, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(bytes) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(bytes), nil
+}
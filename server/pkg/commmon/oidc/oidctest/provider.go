@@ -0,0 +1,178 @@
+// Package oidctest runs a minimal OpenID Connect provider for tests: it
+// serves discovery, keys and a token endpoint that enforces PKCE.
+package oidctest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/erkindilekci/cinebase/server/pkg/commmon/oidc"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const keyId = "oidctest"
+
+// Provider is a running test provider. Its issuer is the URL of its server.
+type Provider struct {
+	Issuer   string
+	ClientID string
+
+	server     *httptest.Server
+	privateKey ed25519.PrivateKey
+
+	mu     sync.Mutex
+	grants map[string]grant
+}
+
+// grant is an authorization code waiting to be redeemed.
+type grant struct {
+	codeChallenge string
+	redirectURL   string
+	claims        jwt.MapClaims
+}
+
+// NewProvider starts a provider for clientID that is stopped when the test
+// ends.
+func NewProvider(t *testing.T, clientID string) *Provider {
+	t.Helper()
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider := &Provider{ClientID: clientID, privateKey: privateKey, grants: make(map[string]grant)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, oidc.Metadata{
+			Issuer:                provider.Issuer,
+			AuthorizationEndpoint: provider.Issuer + "/authorize",
+			TokenEndpoint:         provider.Issuer + "/token",
+			JwksUri:               provider.Issuer + "/keys",
+		})
+	})
+	mux.HandleFunc("GET /keys", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"keys": []map[string]string{{
+			"kty": "OKP", "crv": "Ed25519", "use": "sig", "kid": keyId,
+			"x": base64.RawURLEncoding.EncodeToString(publicKey),
+		}}})
+	})
+	mux.HandleFunc("POST /token", provider.token)
+
+	provider.server = httptest.NewServer(mux)
+	provider.Issuer = provider.server.URL
+	t.Cleanup(provider.server.Close)
+	return provider
+}
+
+// Config returns the client settings for logging in through the provider.
+func (provider *Provider) Config(redirectURL string) oidc.Config {
+	return oidc.Config{
+		IssuerURL:   provider.Issuer,
+		ClientID:    provider.ClientID,
+		RedirectURL: redirectURL,
+		Scopes:      []string{"openid", "email"},
+	}
+}
+
+// Authorize plays a user logging in at authURL, which AuthCodeURL built. It
+// returns the state and code the provider redirects back with; redeeming the
+// code yields an ID token with claims on top of the standard ones.
+func (provider *Provider) Authorize(t *testing.T, authURL string, claims jwt.MapClaims) (state, code string) {
+	t.Helper()
+
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	if query.Get("client_id") != provider.ClientID || query.Get("response_type") != "code" || query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("unexpected authorization request %s", authURL)
+	}
+
+	idClaims := jwt.MapClaims{"nonce": query.Get("nonce")}
+	for name, value := range claims {
+		idClaims[name] = value
+	}
+
+	code, err = oidc.RandomString(16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider.mu.Lock()
+	provider.grants[code] = grant{query.Get("code_challenge"), query.Get("redirect_uri"), idClaims}
+	provider.mu.Unlock()
+
+	return query.Get("state"), code
+}
+
+// SignIDToken signs an ID token for the client with claims on top of the
+// standard ones, which claims can override.
+func (provider *Provider) SignIDToken(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+
+	signed, err := provider.signIDToken(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// token redeems a code once, when the verifier matches its PKCE challenge.
+func (provider *Provider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+
+	code := r.PostForm.Get("code")
+	grant, ok := provider.grants[code]
+	delete(provider.grants, code)
+	if !ok || r.PostForm.Get("client_id") != provider.ClientID || r.PostForm.Get("redirect_uri") != grant.redirectURL ||
+		oidc.CodeChallenge(r.PostForm.Get("code_verifier")) != grant.codeChallenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	idToken, err := provider.signIDToken(grant.claims)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"id_token": idToken, "token_type": "Bearer"})
+}
+
+func (provider *Provider) signIDToken(claims jwt.MapClaims) (string, error) {
+	now := time.Now()
+	idClaims := jwt.MapClaims{
+		"iss": provider.Issuer,
+		"aud": provider.ClientID,
+		"sub": "subject",
+		"iat": now.Unix(),
+		"exp": now.Add(time.Minute).Unix(),
+	}
+	for name, value := range claims {
+		idClaims[name] = value
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, idClaims)
+	token.Header["kid"] = keyId
+	return token.SignedString(provider.privateKey)
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,341 @@
+// Package oidc is a client for OpenID Connect providers: it reads their
+// discovery document and keys, builds authorization code requests with PKCE
+// and validates the ID tokens they return.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidIDToken = errors.New("invalid ID token")
+	// keyRefreshInterval limits how often an unknown kid triggers a JWKS
+	// download, so forged tokens can't make us hammer the provider.
+	keyRefreshInterval = time.Minute
+	// idTokenMethods are the signing algorithms accepted for ID tokens.
+	idTokenMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+)
+
+type Config struct {
+	// IssuerURL is the provider's issuer, its discovery document is read from
+	// IssuerURL/.well-known/openid-configuration.
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is our callback registered with the provider.
+	RedirectURL string
+	Scopes      []string
+	// Leeway tolerates clock skew when checking exp and iat.
+	Leeway time.Duration
+}
+
+// Metadata is the part of the discovery document the login flow needs.
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksUri               string `json:"jwks_uri"`
+}
+
+// IDToken holds the validated claims of an ID token.
+type IDToken struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	// AuthMethods is the amr claim, such as pwd, otp or mfa.
+	AuthMethods []string
+	// Claims holds all claims, for ones the provider adds such as groups.
+	Claims jwt.MapClaims
+}
+
+// Provider talks to one OpenID Connect provider. The discovery document and
+// keys are fetched on first use and cached, so the application can start
+// while the provider is unreachable.
+type Provider struct {
+	config     Config
+	httpClient *http.Client
+
+	mutex         sync.Mutex
+	metadata      *Metadata
+	keys          map[string]crypto.PublicKey
+	keysFetchedAt time.Time
+}
+
+func NewProvider(config Config, httpClient *http.Client) *Provider {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Provider{config: config, httpClient: httpClient}
+}
+
+// AuthCodeURL builds the URL the user is sent to for logging in. The PKCE
+// challenge is derived from codeVerifier with S256.
+func (provider *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	metadata, err := provider.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := url.Parse(metadata.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid authorization endpoint: %w", err)
+	}
+
+	query := authURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", provider.config.ClientID)
+	query.Set("redirect_uri", provider.config.RedirectURL)
+	query.Set("scope", strings.Join(provider.config.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", CodeChallenge(codeVerifier))
+	query.Set("code_challenge_method", "S256")
+	authURL.RawQuery = query.Encode()
+
+	return authURL.String(), nil
+}
+
+// Exchange trades an authorization code for the raw ID token.
+func (provider *Provider) Exchange(ctx context.Context, code, codeVerifier string) (string, error) {
+	metadata, err := provider.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", provider.config.RedirectURL)
+	form.Set("client_id", provider.config.ClientID)
+	form.Set("code_verifier", codeVerifier)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	if provider.config.ClientSecret != "" {
+		request.SetBasicAuth(url.QueryEscape(provider.config.ClientID), url.QueryEscape(provider.config.ClientSecret))
+	}
+
+	var tokenResponse struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err = provider.doJSON(request, &tokenResponse); err != nil {
+		if tokenResponse.Error != "" {
+			return "", fmt.Errorf("token request failed: %s", strings.TrimSpace(tokenResponse.Error+" "+tokenResponse.ErrorDescription))
+		}
+		return "", err
+	}
+	if tokenResponse.IDToken == "" {
+		return "", errors.New("token response holds no id_token")
+	}
+
+	return tokenResponse.IDToken, nil
+}
+
+// VerifyIDToken checks the signature, issuer, audience, expiry and nonce of
+// an ID token as required by OpenID Connect Core section 3.1.3.7.
+func (provider *Provider) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (*IDToken, error) {
+	metadata, err := provider.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(rawIDToken, claims,
+		func(token *jwt.Token) (interface{}, error) {
+			kid, _ := token.Header["kid"].(string)
+			return provider.key(ctx, kid)
+		},
+		jwt.WithValidMethods(idTokenMethods),
+		jwt.WithIssuer(metadata.Issuer),
+		jwt.WithAudience(provider.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(provider.config.Leeway),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	if tokenNonce, _ := claims["nonce"].(string); tokenNonce == "" || tokenNonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	audience, _ := claims.GetAudience()
+	if azp, ok := claims["azp"].(string); (len(audience) > 1 || ok) && azp != provider.config.ClientID {
+		return nil, fmt.Errorf("%w: issued to another party", ErrInvalidIDToken)
+	}
+
+	subject, _ := claims.GetSubject()
+	if subject == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidIDToken)
+	}
+
+	idToken := &IDToken{
+		Issuer:      metadata.Issuer,
+		Subject:     subject,
+		AuthMethods: StringList(claims["amr"]),
+		Claims:      claims,
+	}
+	idToken.Email, _ = claims["email"].(string)
+	// Some providers send email_verified as a string.
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		idToken.EmailVerified = verified
+	case string:
+		idToken.EmailVerified = verified == "true"
+	}
+
+	return idToken, nil
+}
+
+// StringList reads a claim that may be a single string or a list of them.
+func StringList(claim interface{}) []string {
+	switch value := claim.(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// NewCodeVerifier returns a random PKCE code verifier, RFC 7636 section 4.1.
+func NewCodeVerifier() (string, error) {
+	return RandomString(32)
+}
+
+// CodeChallenge derives the S256 PKCE challenge from verifier.
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// RandomString returns size random bytes as unpadded base64url, for state
+// and nonce values.
+func RandomString(size int) (string, error) {
+	buffer := make([]byte, size)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buffer), nil
+}
+
+func (provider *Provider) discover(ctx context.Context) (*Metadata, error) {
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+
+	if provider.metadata != nil {
+		return provider.metadata, nil
+	}
+
+	discoveryURL := strings.TrimSuffix(provider.config.IssuerURL, "/") + "/.well-known/openid-configuration"
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, discoveryURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata Metadata
+	if err = provider.doJSON(request, &metadata); err != nil {
+		return nil, fmt.Errorf("error while reading the discovery document: %w", err)
+	}
+	// The issuer must be exactly the one configured, OpenID Connect
+	// Discovery section 4.3.
+	if metadata.Issuer != provider.config.IssuerURL {
+		return nil, fmt.Errorf("discovery document names issuer %s instead of %s", metadata.Issuer, provider.config.IssuerURL)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JwksUri == "" {
+		return nil, errors.New("discovery document lacks an endpoint")
+	}
+
+	provider.metadata = &metadata
+	return provider.metadata, nil
+}
+
+// key returns the provider's key with kid, downloading the keys again when
+// it is unknown, as providers rotate them.
+func (provider *Provider) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+
+	if key, ok := provider.lookupKey(kid); ok {
+		return key, nil
+	}
+	if time.Since(provider.keysFetchedAt) < keyRefreshInterval {
+		return nil, fmt.Errorf("unknown key %s", kid)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, provider.metadata.JwksUri, nil)
+	if err != nil {
+		return nil, err
+	}
+	var keySet jsonWebKeySet
+	if err = provider.doJSON(request, &keySet); err != nil {
+		return nil, fmt.Errorf("error while reading the provider keys: %w", err)
+	}
+
+	provider.keys = keySet.publicKeys()
+	provider.keysFetchedAt = time.Now()
+
+	if key, ok := provider.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key %s", kid)
+}
+
+// lookupKey finds the key with kid; tokens without a kid are accepted when
+// the provider has a single key.
+func (provider *Provider) lookupKey(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(provider.keys) == 1 {
+		for _, key := range provider.keys {
+			return key, true
+		}
+	}
+	key, ok := provider.keys[kid]
+	return key, ok
+}
+
+// doJSON sends request and decodes the JSON answer into target. Error
+// answers are decoded too, so callers can report OAuth error codes.
+func (provider *Provider) doJSON(request *http.Request, target interface{}) error {
+	response, err := provider.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	decodeErr := json.Unmarshal(body, target)
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered %s", request.URL.Redacted(), response.Status)
+	}
+	return decodeErr
+}
@@ -0,0 +1,109 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/erkindilekci/cinebase/server/pkg/commmon/oidc"
+	"github.com/erkindilekci/cinebase/server/pkg/commmon/oidc/oidctest"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const redirectURL = "http://api.test/oidc/callback"
+
+func TestExchangeSendsTheVerifierOfTheChallenge(t *testing.T) {
+	mockProvider := oidctest.NewProvider(t, "cinebase")
+	provider := oidc.NewProvider(mockProvider.Config(redirectURL), nil)
+	ctx := context.Background()
+
+	codeVerifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	authURL, err := provider.AuthCodeURL(ctx, "state", "nonce", codeVerifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if challenge := mustParseQuery(t, authURL).Get("code_challenge"); challenge != oidc.CodeChallenge(codeVerifier) {
+		t.Fatalf("code_challenge = %s, want the S256 challenge of the verifier", challenge)
+	}
+
+	_, code := mockProvider.Authorize(t, authURL, jwt.MapClaims{"sub": "jane"})
+	if _, err = provider.Exchange(ctx, code, "another verifier"); err == nil {
+		t.Fatal("Exchange() with the wrong verifier succeeded")
+	}
+
+	_, code = mockProvider.Authorize(t, authURL, jwt.MapClaims{"sub": "jane"})
+	rawIDToken, err := provider.Exchange(ctx, code, codeVerifier)
+	if err != nil {
+		t.Fatalf("Exchange() = %v", err)
+	}
+	idToken, err := provider.VerifyIDToken(ctx, rawIDToken, "nonce")
+	if err != nil {
+		t.Fatalf("VerifyIDToken() = %v", err)
+	}
+	if idToken.Subject != "jane" || idToken.Issuer != mockProvider.Issuer {
+		t.Errorf("got subject %s at %s, want jane at %s", idToken.Subject, idToken.Issuer, mockProvider.Issuer)
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	mockProvider := oidctest.NewProvider(t, "cinebase")
+	provider := oidc.NewProvider(mockProvider.Config(redirectURL), nil)
+
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		nonce  string
+		valid  bool
+	}{
+		{"valid", jwt.MapClaims{"nonce": "nonce"}, "nonce", true},
+		{"wrong nonce", jwt.MapClaims{"nonce": "other"}, "nonce", false},
+		{"missing nonce", jwt.MapClaims{}, "nonce", false},
+		{"wrong issuer", jwt.MapClaims{"nonce": "nonce", "iss": "https://evil.test"}, "nonce", false},
+		{"wrong audience", jwt.MapClaims{"nonce": "nonce", "aud": "another-client"}, "nonce", false},
+		{"other authorized party", jwt.MapClaims{"nonce": "nonce", "aud": []string{"cinebase", "another-client"}, "azp": "another-client"}, "nonce", false},
+		{"expired", jwt.MapClaims{"nonce": "nonce", "exp": 1}, "nonce", false},
+		{"missing subject", jwt.MapClaims{"nonce": "nonce", "sub": ""}, "nonce", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := provider.VerifyIDToken(context.Background(), mockProvider.SignIDToken(t, test.claims), test.nonce)
+			if test.valid && err != nil {
+				t.Errorf("VerifyIDToken() = %v, want it accepted", err)
+			}
+			if !test.valid && !errors.Is(err, oidc.ErrInvalidIDToken) {
+				t.Errorf("VerifyIDToken() = %v, want ErrInvalidIDToken", err)
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenReadsEmailVerified(t *testing.T) {
+	mockProvider := oidctest.NewProvider(t, "cinebase")
+	provider := oidc.NewProvider(mockProvider.Config(redirectURL), nil)
+
+	for _, verified := range []interface{}{true, "true"} {
+		rawIDToken := mockProvider.SignIDToken(t, jwt.MapClaims{"nonce": "nonce", "email": "jane@example.com", "email_verified": verified})
+		idToken, err := provider.VerifyIDToken(context.Background(), rawIDToken, "nonce")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if idToken.Email != "jane@example.com" || !idToken.EmailVerified {
+			t.Errorf("email_verified %#v read as %s verified %t", verified, idToken.Email, idToken.EmailVerified)
+		}
+	}
+}
+
+func mustParseQuery(t *testing.T, rawURL string) url.Values {
+	t.Helper()
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed.Query()
+}
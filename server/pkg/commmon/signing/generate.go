@@ -0,0 +1,58 @@
+package signing
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// GenerateKeyFile writes a new private key of the given algorithm ("EdDSA" or
+// "RS256") to dir and returns its key id, which is derived from the current
+// time so ids sort in creation order.
+func GenerateKeyFile(dir string, algorithm string) (string, error) {
+	var privateKey crypto.Signer
+	var err error
+
+	switch algorithm {
+	case "EdDSA":
+		_, privateKey, err = ed25519.GenerateKey(rand.Reader)
+	case "RS256":
+		privateKey, err = rsa.GenerateKey(rand.Reader, 3072)
+	default:
+		return "", fmt.Errorf("unsupported algorithm %s, use EdDSA or RS256", algorithm)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	encoded, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	if err = os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+
+	keyId := time.Now().UTC().Format("20060102-150405")
+	path := filepath.Join(dir, keyId+keyFileExtension)
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if err = pem.Encode(file, &pem.Block{Type: "PRIVATE KEY", Bytes: encoded}); err != nil {
+		return "", err
+	}
+
+	return keyId, nil
+}
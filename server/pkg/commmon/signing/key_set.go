@@ -0,0 +1,221 @@
+package signing
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	keyFileExtension     = ".pem"
+	retiredKeyFileSuffix = ".retired" + keyFileExtension
+)
+
+var ErrUnknownKey = errors.New("token was signed with an unknown key")
+
+// Key is one signing key. Keys loaded from a public key file can only verify.
+type Key struct {
+	Id         string
+	Method     jwt.SigningMethod
+	PrivateKey crypto.Signer
+	PublicKey  crypto.PublicKey
+}
+
+// KeySet holds the keys tokens are signed and verified with. One key signs new
+// tokens, all keys verify, so a key can be rotated out while the tokens it
+// signed are still valid.
+type KeySet struct {
+	signingKey *Key
+	keys       map[string]*Key
+	ids        []string
+}
+
+// LoadKeySet reads every <kid>.pem file in dir. Files may hold a PKCS#8 RSA or
+// Ed25519 private key, or just the public key of a key that no longer signs.
+// Files named <kid>.retired.pem are skipped: tokens signed with them are no
+// longer accepted. signingKeyId picks the key that signs new tokens and may be
+// empty when dir holds a single private key.
+func LoadKeySet(dir string, signingKeyId string) (*KeySet, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading the signing key directory: %w", err)
+	}
+
+	keySet := &KeySet{keys: make(map[string]*Key)}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, keyFileExtension) || strings.HasSuffix(name, retiredKeyFileSuffix) {
+			continue
+		}
+
+		content, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("error while reading signing key %s: %w", name, err)
+		}
+
+		key, err := parseKey(strings.TrimSuffix(name, keyFileExtension), content)
+		if err != nil {
+			return nil, fmt.Errorf("error while parsing signing key %s: %w", name, err)
+		}
+		keySet.add(key)
+	}
+
+	if signingKeyId == "" {
+		var privateKeyIds []string
+		for _, id := range keySet.ids {
+			if keySet.keys[id].PrivateKey != nil {
+				privateKeyIds = append(privateKeyIds, id)
+			}
+		}
+		if len(privateKeyIds) != 1 {
+			return nil, fmt.Errorf("the signing key directory holds %d private keys, set the id of the one to sign with", len(privateKeyIds))
+		}
+		signingKeyId = privateKeyIds[0]
+	}
+
+	signingKey, ok := keySet.keys[signingKeyId]
+	if !ok || signingKey.PrivateKey == nil {
+		return nil, fmt.Errorf("no private key with id %s in the signing key directory", signingKeyId)
+	}
+	keySet.signingKey = signingKey
+
+	return keySet, nil
+}
+
+// NewEphemeralKeySet creates a set with a single Ed25519 key that only lives
+// as long as the process. Meant for development: tokens don't survive a
+// restart and other instances can't verify them.
+func NewEphemeralKeySet() (*KeySet, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &Key{
+		Id:         "ephemeral-" + time.Now().UTC().Format("20060102150405"),
+		Method:     jwt.SigningMethodEdDSA,
+		PrivateKey: privateKey,
+		PublicKey:  publicKey,
+	}
+
+	keySet := &KeySet{keys: make(map[string]*Key)}
+	keySet.add(key)
+	keySet.signingKey = key
+	return keySet, nil
+}
+
+// Sign signs claims with the current signing key and names it in the kid header.
+func (keySet *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(keySet.signingKey.Method, claims)
+	token.Header["kid"] = keySet.signingKey.Id
+	return token.SignedString(keySet.signingKey.PrivateKey)
+}
+
+// Keyfunc resolves the key a token claims to be signed with for jwt.Parse. The
+// token's algorithm must be the one of that key.
+func (keySet *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := keySet.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s for key %s", token.Method.Alg(), kid)
+	}
+	return key.PublicKey, nil
+}
+
+// SigningMethod is the algorithm new tokens are signed with.
+func (keySet *KeySet) SigningMethod() string {
+	return keySet.signingKey.Method.Alg()
+}
+
+// Methods lists the algorithms of the keys in the set.
+func (keySet *KeySet) Methods() []string {
+	var methods []string
+	for _, id := range keySet.ids {
+		alg := keySet.keys[id].Method.Alg()
+		if !slices.Contains(methods, alg) {
+			methods = append(methods, alg)
+		}
+	}
+	return methods
+}
+
+// Keys returns the keys in the set ordered by id.
+func (keySet *KeySet) Keys() []*Key {
+	keys := make([]*Key, 0, len(keySet.ids))
+	for _, id := range keySet.ids {
+		keys = append(keys, keySet.keys[id])
+	}
+	return keys
+}
+
+func (keySet *KeySet) add(key *Key) {
+	keySet.keys[key.Id] = key
+	keySet.ids = append(keySet.ids, key.Id)
+	sort.Strings(keySet.ids)
+}
+
+func parseKey(id string, content []byte) (*Key, error) {
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	key := &Key{Id: id}
+	switch block.Type {
+	case "PRIVATE KEY":
+		privateKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := privateKey.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("unsupported private key type")
+		}
+		key.PrivateKey = signer
+		key.PublicKey = signer.Public()
+	case "RSA PRIVATE KEY":
+		privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key.PrivateKey = privateKey
+		key.PublicKey = privateKey.Public()
+	case "PUBLIC KEY":
+		publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key.PublicKey = publicKey
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %s", block.Type)
+	}
+
+	switch publicKey := key.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if publicKey.N.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must have at least 2048 bits")
+		}
+		key.Method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		key.Method = jwt.SigningMethodEdDSA
+	default:
+		return nil, errors.New("only RSA and Ed25519 keys are supported")
+	}
+
+	return key, nil
+}
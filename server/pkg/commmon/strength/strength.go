@@ -0,0 +1,413 @@
+// Package strength estimates how hard a password is to guess, following the
+// approach of Dropbox's zxcvbn: the password is split into the patterns an
+// attacker would try first, such as common passwords, keyboard walks,
+// sequences, repeats and years, and the cheapest way to guess all of its
+// parts decides the score.
+package strength
+
+import (
+	_ "embed"
+	"math"
+	"strings"
+	"unicode"
+)
+
+//go:embed common_passwords.txt
+var commonPasswordList string
+
+// commonPasswords ranks common passwords by popularity, starting at 1.
+var commonPasswords = rankedDictionary(strings.Fields(commonPasswordList))
+
+// Score thresholds in guesses, as used by zxcvbn.
+var scoreThresholds = []float64{1e3, 1e6, 1e8, 1e10}
+
+const (
+	// bruteforceCardinality is the guesses per character not part of any
+	// pattern.
+	bruteforceCardinality = 10
+	// minMatchGuesses keeps a pattern from making its part look free.
+	minMatchGuesses = 50
+	// referenceYear is what recent years are measured from.
+	referenceYear = 2026
+	minYearSpace  = 20
+)
+
+// Warnings tell users why their password scored low.
+const (
+	WarningCommon     = "this is a commonly used password"
+	WarningUserInput  = "avoid your name or email in the password"
+	WarningKeyboard   = "avoid keyboard patterns such as qwerty or asdf"
+	WarningSequence   = "avoid sequences such as abc or 6543"
+	WarningRepeat     = "avoid repeated characters and words"
+	WarningYear       = "avoid recent years"
+	WarningShortGuess = "add more words or uncommon characters"
+)
+
+// Result is the estimate for a password.
+type Result struct {
+	// Score ranges from 0, too guessable, to 4, very unguessable.
+	Score   int
+	Guesses float64
+	// Warning names the weakest pattern found, empty for scores of 3 and up.
+	Warning string
+}
+
+type match struct {
+	// start and end are rune indices, end is exclusive.
+	start, end int
+	guesses    float64
+	warning    string
+}
+
+// Estimate scores password. userInputs, such as the user's email, are
+// treated like the most common passwords.
+func Estimate(password string, userInputs ...string) Result {
+	runes := []rune(password)
+	if len(runes) == 0 {
+		return Result{Guesses: 1, Warning: WarningShortGuess}
+	}
+
+	var inputWords []string
+	for _, input := range userInputs {
+		inputWords = append(inputWords, strings.FieldsFunc(strings.ToLower(input), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})...)
+	}
+	userDictionary := rankedDictionary(inputWords)
+
+	var matches []match
+	matches = append(matches, dictionaryMatches(runes, commonPasswords, WarningCommon)...)
+	matches = append(matches, dictionaryMatches(runes, userDictionary, WarningUserInput)...)
+	matches = append(matches, spatialMatches(runes)...)
+	matches = append(matches, sequenceMatches(runes)...)
+	matches = append(matches, repeatMatches(runes)...)
+	matches = append(matches, yearMatches(runes)...)
+
+	guesses, weakest := mostGuessableCover(runes, matches)
+
+	result := Result{Guesses: guesses}
+	for result.Score < len(scoreThresholds) && guesses >= scoreThresholds[result.Score] {
+		result.Score++
+	}
+	if result.Score < 3 {
+		result.Warning = weakest
+		if result.Warning == "" {
+			result.Warning = WarningShortGuess
+		}
+	}
+	return result
+}
+
+// mostGuessableCover finds the cheapest way to guess the whole password from
+// the matches, with the characters no match covers guessed by brute force.
+// It returns the guesses and the warning of the weakest match used.
+func mostGuessableCover(runes []rune, matches []match) (float64, string) {
+	n := len(runes)
+	byEnd := make([][]match, n+1)
+	for _, m := range matches {
+		byEnd[m.end] = append(byEnd[m.end], m)
+	}
+
+	// best[i] is the fewest guesses for the first i runes, in log10.
+	// weakness[i] is the share of the weakest match used for them, in runes
+	// per digit of guesses, and warnings[i] its warning.
+	best := make([]float64, n+1)
+	weakness := make([]float64, n+1)
+	warnings := make([]string, n+1)
+	for i := 1; i <= n; i++ {
+		best[i] = best[i-1] + math.Log10(bruteforceCardinality)
+		weakness[i], warnings[i] = weakness[i-1], warnings[i-1]
+
+		for _, m := range byEnd[i] {
+			guesses := math.Log10(math.Max(m.guesses, minMatchGuesses))
+			if total := best[m.start] + guesses; total < best[i] {
+				best[i] = total
+				weakness[i], warnings[i] = weakness[m.start], warnings[m.start]
+				if share := float64(m.end-m.start) / guesses; share > weakness[i] {
+					weakness[i], warnings[i] = share, m.warning
+				}
+			}
+		}
+	}
+
+	return math.Pow(10, best[n]), warnings[n]
+}
+
+func rankedDictionary(words []string) map[string]int {
+	dictionary := make(map[string]int, len(words))
+	for i, word := range words {
+		if _, ok := dictionary[word]; !ok && len(word) > 0 {
+			dictionary[word] = i + 1
+		}
+	}
+	return dictionary
+}
+
+// leetSubstitutions undoes common character swaps such as p@ssw0rd.
+var leetSubstitutions = map[rune]rune{
+	'4': 'a', '@': 'a', '8': 'b', '(': 'c', '3': 'e', '6': 'g', '1': 'i', '!': 'i',
+	'|': 'l', '0': 'o', '$': 's', '5': 's', '7': 't', '+': 't', '2': 'z',
+}
+
+// dictionaryMatches finds words of dictionary in runes, also when spelled
+// backwards, capitalized or with leet substitutions.
+func dictionaryMatches(runes []rune, dictionary map[string]int, warning string) []match {
+	if len(dictionary) == 0 {
+		return nil
+	}
+
+	var matches []match
+	for i := 0; i < len(runes); i++ {
+		for j := i + 1; j <= len(runes); j++ {
+			part := runes[i:j]
+			lower := strings.ToLower(string(part))
+			variations := uppercaseVariations(part)
+
+			if rank, ok := dictionary[lower]; ok {
+				matches = append(matches, match{i, j, float64(rank) * variations, warning})
+			}
+			if reversed := reverse(lower); reversed != lower {
+				if rank, ok := dictionary[reversed]; ok {
+					matches = append(matches, match{i, j, float64(rank) * variations * 2, warning})
+				}
+			}
+			if unleeted := unleet(lower); unleeted != lower {
+				if rank, ok := dictionary[unleeted]; ok {
+					matches = append(matches, match{i, j, float64(rank) * variations * 2, warning})
+				}
+			}
+		}
+	}
+	return matches
+}
+
+// uppercaseVariations is how many ways of capitalizing a word an attacker
+// tries before reaching this one: all lower case is free, a capital first
+// or last letter or all capitals double the guesses.
+func uppercaseVariations(part []rune) float64 {
+	upper, lower := 0, 0
+	for _, r := range part {
+		switch {
+		case unicode.IsUpper(r):
+			upper++
+		case unicode.IsLower(r):
+			lower++
+		}
+	}
+	switch {
+	case upper == 0:
+		return 1
+	case lower == 0, upper == 1 && (unicode.IsUpper(part[0]) || unicode.IsUpper(part[len(part)-1])):
+		return 2
+	}
+
+	// Otherwise count the ways to pick that many capitals.
+	variations := 0.0
+	for k := 1; k <= min(upper, lower); k++ {
+		variations += binomial(upper+lower, k)
+	}
+	return math.Max(variations, 2)
+}
+
+func binomial(n, k int) float64 {
+	result := 1.0
+	for i := 1; i <= k; i++ {
+		result = result * float64(n-k+i) / float64(i)
+	}
+	return result
+}
+
+func unleet(word string) string {
+	return strings.Map(func(r rune) rune {
+		if substitute, ok := leetSubstitutions[r]; ok {
+			return substitute
+		}
+		return r
+	}, word)
+}
+
+func reverse(word string) string {
+	runes := []rune(word)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
+
+// keyboardRows is a QWERTY layout, each row shifted half a key right of the
+// one above.
+var keyboardRows = []string{"1234567890-=", "qwertyuiop[]", "asdfghjkl;'", "zxcvbnm,./"}
+
+type keyPosition struct{ row, column int }
+
+var keyPositions = func() map[rune]keyPosition {
+	positions := make(map[rune]keyPosition)
+	for row, keys := range keyboardRows {
+		for column, key := range keys {
+			positions[key] = keyPosition{row, column}
+		}
+	}
+	return positions
+}()
+
+// keyDirection returns how to get from key a to the adjacent key b, or -1
+// when they aren't adjacent.
+func keyDirection(a, b rune) int {
+	from, ok := keyPositions[unicode.ToLower(a)]
+	if !ok {
+		return -1
+	}
+	to, ok := keyPositions[unicode.ToLower(b)]
+	if !ok {
+		return -1
+	}
+
+	rowStep, columnStep := to.row-from.row, to.column-from.column
+	switch {
+	case rowStep == 0 && (columnStep == 1 || columnStep == -1):
+		return columnStep + 1
+	case rowStep == 1 && (columnStep == 0 || columnStep == -1):
+		return 3 + columnStep + 1
+	case rowStep == -1 && (columnStep == 0 || columnStep == 1):
+		return 6 + columnStep
+	}
+	return -1
+}
+
+// spatialMatches finds walks of four or more adjacent keys such as qwer or
+// zaq1, which cost more guesses the more often they turn.
+func spatialMatches(runes []rune) []match {
+	var matches []match
+	for i := 0; i < len(runes)-1; {
+		j, turns, direction := i+1, 1, keyDirection(runes[i], runes[i+1])
+		if direction < 0 {
+			i++
+			continue
+		}
+		for j+1 < len(runes) {
+			next := keyDirection(runes[j], runes[j+1])
+			if next < 0 {
+				break
+			}
+			if next != direction {
+				turns++
+				direction = next
+			}
+			j++
+		}
+
+		if length := j - i + 1; length >= 4 {
+			guesses := float64(len(keyPositions)) * float64(length) * math.Pow(4, float64(turns))
+			matches = append(matches, match{i, j + 1, guesses, WarningKeyboard})
+		}
+		i = j
+	}
+	return matches
+}
+
+// sequenceMatches finds runs of three or more characters that step by the
+// same amount, such as abc, 7531 or zyx.
+func sequenceMatches(runes []rune) []match {
+	var matches []match
+	for i := 0; i < len(runes)-2; {
+		delta := runes[i+1] - runes[i]
+		j := i + 1
+		for j+1 < len(runes) && runes[j+1]-runes[j] == delta {
+			j++
+		}
+
+		if length := j - i + 1; length >= 3 && delta != 0 && delta >= -5 && delta <= 5 {
+			base := 26.0
+			switch {
+			case strings.ContainsRune("aAzZ019", runes[i]):
+				base = 4
+			case unicode.IsDigit(runes[i]):
+				base = 10
+			}
+			guesses := base * float64(length)
+			if delta < 0 {
+				guesses *= 2
+			}
+			matches = append(matches, match{i, j + 1, guesses, WarningSequence})
+		}
+		i = j
+	}
+	return matches
+}
+
+// repeatMatches finds a character or block repeated back to back, such as
+// aaaa or abcabc.
+func repeatMatches(runes []rune) []match {
+	var matches []match
+	for i := range runes {
+		for size := 1; i+2*size <= len(runes); size++ {
+			block := string(runes[i : i+size])
+			count := 1
+			for i+(count+1)*size <= len(runes) && string(runes[i+count*size:i+(count+1)*size]) == block {
+				count++
+			}
+			if count < 2 || size == 1 && count < 3 {
+				continue
+			}
+
+			blockGuesses := math.Pow(float64(characterCardinality([]rune(block))), float64(size))
+			if size > 1 {
+				blockGuesses = math.Min(blockGuesses, math.Pow(bruteforceCardinality, float64(size)))
+			}
+			matches = append(matches, match{i, i + count*size, blockGuesses * float64(count), WarningRepeat})
+		}
+	}
+	return matches
+}
+
+func characterCardinality(runes []rune) int {
+	cardinality := 0
+	var hasLower, hasUpper, hasDigit, hasOther bool
+	for _, r := range runes {
+		switch {
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		default:
+			hasOther = true
+		}
+	}
+	if hasLower {
+		cardinality += 26
+	}
+	if hasUpper {
+		cardinality += 26
+	}
+	if hasDigit {
+		cardinality += 10
+	}
+	if hasOther {
+		cardinality += 33
+	}
+	return cardinality
+}
+
+// yearMatches finds years from 1900 to 2049, which are guessed starting
+// from the present.
+func yearMatches(runes []rune) []match {
+	var matches []match
+	for i := 0; i+4 <= len(runes); i++ {
+		year := 0
+		for _, r := range runes[i : i+4] {
+			if r < '0' || r > '9' {
+				year = -1
+				break
+			}
+			year = year*10 + int(r-'0')
+		}
+		if year < 1900 || year > 2049 {
+			continue
+		}
+		distance := math.Abs(float64(year - referenceYear))
+		matches = append(matches, match{i, i + 4, math.Max(distance, minYearSpace), WarningYear})
+	}
+	return matches
+}
@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"errors"
+	"github.com/erkindilekci/cinebase/server/pkg/controller/request"
+	"github.com/erkindilekci/cinebase/server/pkg/controller/response"
+	"github.com/erkindilekci/cinebase/server/pkg/domain"
+	"github.com/erkindilekci/cinebase/server/pkg/middleware"
+	"github.com/erkindilekci/cinebase/server/pkg/service"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strconv"
+)
+
+type ApiKeyController struct {
+	apiKeyService service.IApiKeyService
+	auth          *middleware.Auth
+}
+
+func NewApiKeyController(apiKeyService service.IApiKeyService, auth *middleware.Auth) *ApiKeyController {
+	return &ApiKeyController{apiKeyService, auth}
+}
+
+// RegisterApiKeyRoutes adds the routes managing the caller's own keys. They
+// need a login, so a leaked key can't be used to create more.
+func (controller *ApiKeyController) RegisterApiKeyRoutes(e *echo.Echo) {
+	apiKeyGroup := e.Group("/api-keys")
+	apiKeyGroup.Use(controller.auth.CheckAuthorizationHeader, controller.auth.RequireSession)
+	apiKeyGroup.POST("", controller.CreateApiKey)
+	apiKeyGroup.GET("", controller.GetApiKeys)
+	apiKeyGroup.DELETE("/:id", controller.RevokeApiKey)
+}
+
+func (controller *ApiKeyController) CreateApiKey(c echo.Context) error {
+	claims := middleware.ClaimsFromContext(c.Request().Context())
+	userId, err := userIdFromClaims(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, response.NewErrorResponse(err.Error()))
+	}
+
+	var createRequest request.ApiKeyCreateRequest
+	if err = c.Bind(&createRequest); err != nil {
+		return c.JSON(http.StatusBadRequest, response.NewErrorResponse("Invalid request body"))
+	}
+
+	apiKey, plainKey, err := controller.apiKeyService.Create(userId, createRequest.Name, createRequest.ToScopes(), createRequest.ExpiresAt, claims.HasMfa())
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrInvalidApiKeyName), errors.Is(err, domain.ErrInvalidScope), errors.Is(err, domain.ErrInvalidApiKeyExpiry):
+			return c.JSON(http.StatusBadRequest, response.NewErrorResponse(err.Error()))
+		case errors.Is(err, domain.ErrTooManyApiKeys):
+			return c.JSON(http.StatusConflict, response.NewErrorResponse(err.Error()))
+		case errors.Is(err, domain.ErrUserNotFound):
+			return c.JSON(http.StatusNotFound, response.NewErrorResponse(err.Error()))
+		}
+		return c.JSON(http.StatusInternalServerError, response.NewErrorResponse(err.Error()))
+	}
+
+	return c.JSON(http.StatusCreated, &response.CreatedApiKeyResponse{
+		ApiKeyResponse: response.ToApiKeyResponse(apiKey),
+		Key:            plainKey,
+	})
+}
+
+func (controller *ApiKeyController) GetApiKeys(c echo.Context) error {
+	userId, err := userIdFromClaims(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, response.NewErrorResponse(err.Error()))
+	}
+
+	apiKeys, err := controller.apiKeyService.List(userId)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.NewErrorResponse(err.Error()))
+	}
+
+	return c.JSON(http.StatusOK, response.ToApiKeyResponseList(apiKeys))
+}
+
+func (controller *ApiKeyController) RevokeApiKey(c echo.Context) error {
+	userId, err := userIdFromClaims(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, response.NewErrorResponse(err.Error()))
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, response.NewErrorResponse("Invalid API key ID"))
+	}
+
+	if err = controller.apiKeyService.Revoke(userId, id); err != nil {
+		if errors.Is(err, domain.ErrApiKeyNotFound) {
+			return c.JSON(http.StatusNotFound, response.NewErrorResponse(err.Error()))
+		}
+		return c.JSON(http.StatusInternalServerError, response.NewErrorResponse(err.Error()))
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
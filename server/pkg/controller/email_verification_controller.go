@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"errors"
+	"github.com/erkindilekci/cinebase/server/pkg/controller/request"
+	"github.com/erkindilekci/cinebase/server/pkg/controller/response"
+	"github.com/erkindilekci/cinebase/server/pkg/domain"
+	"github.com/erkindilekci/cinebase/server/pkg/service"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+type EmailVerificationController struct {
+	emailVerificationService service.IEmailVerificationService
+}
+
+func NewEmailVerificationController(emailVerificationService service.IEmailVerificationService) *EmailVerificationController {
+	return &EmailVerificationController{emailVerificationService}
+}
+
+func (controller *EmailVerificationController) RegisterEmailVerificationRoutes(e *echo.Echo) {
+	e.POST("/verify-email", controller.VerifyEmail)
+	e.POST("/verify-email/resend", controller.ResendVerification)
+}
+
+func (controller *EmailVerificationController) VerifyEmail(c echo.Context) error {
+	var verifyRequest request.VerifyEmailRequest
+	if err := c.Bind(&verifyRequest); err != nil {
+		return c.JSON(http.StatusBadRequest, response.NewErrorResponse("Invalid request body"))
+	}
+
+	err := controller.emailVerificationService.Verify(verifyRequest.Token)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidVerificationToken) {
+			return c.JSON(http.StatusBadRequest, response.NewErrorResponse(err.Error()))
+		}
+		return c.JSON(http.StatusInternalServerError, response.NewErrorResponse(err.Error()))
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+// ResendVerification answers 202 whether or not a mail was sent.
+func (controller *EmailVerificationController) ResendVerification(c echo.Context) error {
+	var resendRequest request.ResendVerificationRequest
+	if err := c.Bind(&resendRequest); err != nil {
+		return c.JSON(http.StatusBadRequest, response.NewErrorResponse("Invalid request body"))
+	}
+
+	err := controller.emailVerificationService.Resend(resendRequest.Email)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidEmail) {
+			return c.JSON(http.StatusBadRequest, response.NewErrorResponse(err.Error()))
+		}
+		return c.JSON(http.StatusInternalServerError, response.NewErrorResponse(err.Error()))
+	}
+
+	return c.NoContent(http.StatusAccepted)
+}
@@ -0,0 +1,123 @@
+package controller
+
+import (
+	"errors"
+	"github.com/erkindilekci/cinebase/server/pkg/controller/request"
+	"github.com/erkindilekci/cinebase/server/pkg/controller/response"
+	"github.com/erkindilekci/cinebase/server/pkg/domain"
+	"github.com/erkindilekci/cinebase/server/pkg/middleware"
+	"github.com/erkindilekci/cinebase/server/pkg/service"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strconv"
+)
+
+type GenreController struct {
+	genreService service.IGenreService
+	auth         *middleware.Auth
+}
+
+func NewGenreController(genreService service.IGenreService, auth *middleware.Auth) *GenreController {
+	return &GenreController{genreService, auth}
+}
+
+func (controller *GenreController) RegisterGenreRoutes(e *echo.Echo) {
+	adminGroup := e.Group("/admin")
+	adminGroup.Use(controller.auth.CheckAuthorizationHeader)
+	canWrite := controller.auth.RequirePermission(domain.PermissionGenresWrite)
+	canDelete := controller.auth.RequirePermission(domain.PermissionGenresDelete)
+	adminGroup.POST("/genres", controller.AddGenre, canWrite)
+	adminGroup.PUT("/genres/:id", controller.RenameGenre, canWrite)
+	adminGroup.POST("/genres/:id/merge", controller.MergeGenres, canDelete)
+	adminGroup.DELETE("/genres/:id", controller.DeleteGenre, canDelete)
+}
+
+func (controller *GenreController) AddGenre(c echo.Context) error {
+	var genreReq request.GenreRequest
+	if err := c.Bind(&genreReq); err != nil {
+		return c.JSON(http.StatusBadRequest, response.NewErrorResponse("Invalid request body"))
+	}
+
+	genre, err := controller.genreService.AddGenre(genreReq.Genre)
+	if err != nil {
+		return genreErrorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, response.ToGenreResponse(genre))
+}
+
+func (controller *GenreController) RenameGenre(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, response.NewErrorResponse("Invalid genre ID"))
+	}
+
+	var genreReq request.GenreRequest
+	if err := c.Bind(&genreReq); err != nil {
+		return c.JSON(http.StatusBadRequest, response.NewErrorResponse("Invalid request body"))
+	}
+
+	genre, err := controller.genreService.RenameGenre(id, genreReq.Genre)
+	if err != nil {
+		return genreErrorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, response.ToGenreResponse(genre))
+}
+
+func (controller *GenreController) MergeGenres(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, response.NewErrorResponse("Invalid genre ID"))
+	}
+
+	var mergeReq request.MergeGenresRequest
+	if err := c.Bind(&mergeReq); err != nil || mergeReq.TargetId <= 0 {
+		return c.JSON(http.StatusBadRequest, response.NewErrorResponse("Invalid request body: target_id is required"))
+	}
+
+	target, err := controller.genreService.MergeGenres(id, mergeReq.TargetId)
+	if err != nil {
+		return genreErrorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, response.ToGenreResponse(target))
+}
+
+// DeleteGenre deletes a genre. Genres that still have movies are only deleted
+// when the reassign_to query parameter names the genre they move to.
+func (controller *GenreController) DeleteGenre(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, response.NewErrorResponse("Invalid genre ID"))
+	}
+
+	var reassignToId int64
+	if reassignTo := c.QueryParam("reassign_to"); reassignTo != "" {
+		reassignToId, err = strconv.ParseInt(reassignTo, 10, 64)
+		if err != nil || reassignToId <= 0 {
+			return c.JSON(http.StatusBadRequest, response.NewErrorResponse("Invalid request: reassign_to must be a genre ID"))
+		}
+	}
+
+	err = controller.genreService.DeleteGenre(id, reassignToId)
+	if err != nil {
+		return genreErrorResponse(c, err)
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+func genreErrorResponse(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, domain.ErrInvalidGenre):
+		return c.JSON(http.StatusBadRequest, response.NewErrorResponse(err.Error()))
+	case errors.Is(err, domain.ErrGenreNotFound):
+		return c.JSON(http.StatusNotFound, response.NewErrorResponse(err.Error()))
+	case errors.Is(err, domain.ErrGenreExists):
+		return c.JSON(http.StatusConflict, response.NewErrorResponse(err.Error()))
+	case errors.Is(err, domain.ErrGenreInUse):
+		return c.JSON(http.StatusConflict, response.NewErrorResponse(err.Error()+", pass reassign_to to move them to another genre"))
+	}
+	return c.JSON(http.StatusInternalServerError, response.NewErrorResponse(err.Error()))
+}
@@ -0,0 +1,25 @@
+package controller
+
+import (
+	"github.com/erkindilekci/cinebase/server/pkg/commmon/signing"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+type JwksController struct {
+	keySet *signing.KeySet
+}
+
+func NewJwksController(keySet *signing.KeySet) *JwksController {
+	return &JwksController{keySet}
+}
+
+func (controller *JwksController) RegisterJwksRoutes(e *echo.Echo) {
+	e.GET("/.well-known/jwks.json", controller.GetJwks)
+}
+
+// GetJwks publishes the public keys access tokens are verified with.
+func (controller *JwksController) GetJwks(c echo.Context) error {
+	c.Response().Header().Set("Cache-Control", "public, max-age=300")
+	return c.JSON(http.StatusOK, controller.keySet.JWKS())
+}
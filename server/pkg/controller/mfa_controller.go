@@ -0,0 +1,147 @@
+package controller
+
+import (
+	"errors"
+	"github.com/erkindilekci/cinebase/server/pkg/controller/request"
+	"github.com/erkindilekci/cinebase/server/pkg/controller/response"
+	"github.com/erkindilekci/cinebase/server/pkg/domain"
+	"github.com/erkindilekci/cinebase/server/pkg/middleware"
+	"github.com/erkindilekci/cinebase/server/pkg/service"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strconv"
+)
+
+type MfaController struct {
+	mfaService service.IMfaService
+	auth       *middleware.Auth
+}
+
+func NewMfaController(mfaService service.IMfaService, auth *middleware.Auth) *MfaController {
+	return &MfaController{mfaService, auth}
+}
+
+func (controller *MfaController) RegisterMfaRoutes(e *echo.Echo) {
+	e.POST("/login/mfa", controller.CompleteLogin)
+
+	mfaGroup := e.Group("/mfa")
+	mfaGroup.Use(controller.auth.CheckAuthorizationHeader, controller.auth.RequireSession)
+	mfaGroup.POST("/totp/enroll", controller.Enroll)
+	mfaGroup.POST("/totp/confirm", controller.Confirm)
+	mfaGroup.POST("/totp/disable", controller.Disable)
+	mfaGroup.POST("/recovery-codes", controller.RegenerateRecoveryCodes)
+}
+
+func (controller *MfaController) CompleteLogin(c echo.Context) error {
+	var mfaLoginRequest request.MfaLoginRequest
+	if err := c.Bind(&mfaLoginRequest); err != nil {
+		return c.JSON(http.StatusBadRequest, response.NewErrorResponse("Invalid request body"))
+	}
+
+	tokenPair, err := controller.mfaService.CompleteLogin(mfaLoginRequest.MfaToken, mfaLoginRequest.Code, c.RealIP())
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidMfaToken) {
+			return c.JSON(http.StatusUnauthorized, response.NewErrorResponse(err.Error()))
+		}
+		return mfaErrorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusAccepted, response.NewLoginResponse(tokenPair))
+}
+
+func (controller *MfaController) Enroll(c echo.Context) error {
+	userId, err := userIdFromClaims(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, response.NewErrorResponse(err.Error()))
+	}
+
+	enrollment, err := controller.mfaService.Enroll(userId)
+	if err != nil {
+		return mfaErrorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, response.ToTotpEnrollmentResponse(enrollment))
+}
+
+func (controller *MfaController) Confirm(c echo.Context) error {
+	userId, err := userIdFromClaims(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, response.NewErrorResponse(err.Error()))
+	}
+
+	var codeRequest request.MfaCodeRequest
+	if err = c.Bind(&codeRequest); err != nil {
+		return c.JSON(http.StatusBadRequest, response.NewErrorResponse("Invalid request body"))
+	}
+
+	recoveryCodes, err := controller.mfaService.Confirm(userId, codeRequest.Code)
+	if err != nil {
+		return mfaErrorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, &response.RecoveryCodesResponse{RecoveryCodes: recoveryCodes})
+}
+
+func (controller *MfaController) Disable(c echo.Context) error {
+	userId, err := userIdFromClaims(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, response.NewErrorResponse(err.Error()))
+	}
+
+	var codeRequest request.MfaCodeRequest
+	if err = c.Bind(&codeRequest); err != nil {
+		return c.JSON(http.StatusBadRequest, response.NewErrorResponse("Invalid request body"))
+	}
+
+	if err = controller.mfaService.Disable(userId, codeRequest.Code, c.RealIP()); err != nil {
+		return mfaErrorResponse(c, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (controller *MfaController) RegenerateRecoveryCodes(c echo.Context) error {
+	userId, err := userIdFromClaims(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, response.NewErrorResponse(err.Error()))
+	}
+
+	var codeRequest request.MfaCodeRequest
+	if err = c.Bind(&codeRequest); err != nil {
+		return c.JSON(http.StatusBadRequest, response.NewErrorResponse("Invalid request body"))
+	}
+
+	recoveryCodes, err := controller.mfaService.RegenerateRecoveryCodes(userId, codeRequest.Code, c.RealIP())
+	if err != nil {
+		return mfaErrorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, &response.RecoveryCodesResponse{RecoveryCodes: recoveryCodes})
+}
+
+func userIdFromClaims(c echo.Context) (int64, error) {
+	claims := middleware.ClaimsFromContext(c.Request().Context())
+	if claims == nil {
+		return 0, middleware.ErrMissingToken
+	}
+	userId, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		return 0, middleware.ErrInvalidToken
+	}
+	return userId, nil
+}
+
+func mfaErrorResponse(c echo.Context, err error) error {
+	var tooManyAttempts *domain.TooManyAttemptsError
+	switch {
+	case errors.As(err, &tooManyAttempts):
+		return tooManyAttemptsResponse(c, tooManyAttempts)
+	case errors.Is(err, domain.ErrInvalidMfaCode):
+		return c.JSON(http.StatusUnprocessableEntity, response.NewErrorResponse(err.Error()))
+	case errors.Is(err, domain.ErrMfaNotEnrolled), errors.Is(err, domain.ErrMfaAlreadyEnabled):
+		return c.JSON(http.StatusConflict, response.NewErrorResponse(err.Error()))
+	case errors.Is(err, domain.ErrUserNotFound):
+		return c.JSON(http.StatusNotFound, response.NewErrorResponse(err.Error()))
+	}
+	return c.JSON(http.StatusInternalServerError, response.NewErrorResponse(err.Error()))
+}
@@ -1,6 +1,8 @@
 package controller
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/erkindilekci/cinebase/server/pkg/controller/request"
 	"github.com/erkindilekci/cinebase/server/pkg/controller/response"
@@ -9,51 +11,239 @@ import (
 	"github.com/erkindilekci/cinebase/server/pkg/middleware"
 	"github.com/erkindilekci/cinebase/server/pkg/service"
 	"github.com/labstack/echo/v4"
+	"io"
+	"mime"
 	"net/http"
 	"strconv"
+	"strings"
 )
 
+const graphqlResponseMediaType = "application/graphql-response+json"
+
 type MovieController struct {
 	movieService service.IMovieService
+	movieGraph   *graph.Graph
+	auth         *middleware.Auth
 }
 
-func NewMovieController(movieService service.IMovieService) *MovieController {
-	return &MovieController{movieService}
+func NewMovieController(movieService service.IMovieService, movieGraph *graph.Graph, auth *middleware.Auth) *MovieController {
+	return &MovieController{movieService, movieGraph, auth}
 }
 
 func (controller *MovieController) RegisterMovieRoutes(e *echo.Echo) {
 	e.GET("/movies", controller.GetAllMovies)
+	e.GET("/movies/search", controller.SearchMovies)
+	e.GET("/movies/autocomplete", controller.AutocompleteMovies)
 	e.GET("/movies/:id", controller.GetMovieById)
 	e.GET("/genres", controller.GetAllGenres)
-	e.POST("graphql", controller.HandleGraphql)
+	e.GET("graphql", controller.HandleGraphql, controller.auth.OptionalAuthorizationHeader)
+	e.POST("graphql", controller.HandleGraphql, controller.auth.OptionalAuthorizationHeader)
 
 	adminGroup := e.Group("/admin")
-	adminGroup.Use(middleware.CheckAuthorizationHeader)
-	adminGroup.GET("/movies", controller.MovieCatalogue)
-	adminGroup.GET("/movies/:id", controller.GetMovieByIdEdit)
-	adminGroup.POST("/movies", controller.AddMovie)
-	adminGroup.PUT("/movies/:id", controller.UpdateMovieById)
-	adminGroup.DELETE("/movies/:id", controller.DeleteMovieById)
+	adminGroup.Use(controller.auth.CheckAuthorizationHeader)
+	canWrite := controller.auth.RequirePermission(domain.PermissionMoviesWrite)
+	adminGroup.GET("/movies", controller.MovieCatalogue, canWrite)
+	adminGroup.GET("/movies/:id", controller.GetMovieByIdEdit, canWrite)
+	adminGroup.POST("/movies", controller.AddMovie, canWrite)
+	adminGroup.PUT("/movies/:id", controller.UpdateMovieById, canWrite)
+	adminGroup.DELETE("/movies/:id", controller.DeleteMovieById, controller.auth.RequirePermission(domain.PermissionMoviesDelete))
 }
 
 func (controller *MovieController) GetAllMovies(c echo.Context) error {
-	genre := c.QueryParam("genre")
-	var movies []*domain.Movie
+	pageQuery, err := parseMoviePageQuery(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, response.NewErrorResponse("Invalid request: "+err.Error()))
+	}
+
+	withFacets := false
+	if facetsParam := c.QueryParam("facets"); facetsParam != "" {
+		if withFacets, err = strconv.ParseBool(facetsParam); err != nil {
+			return c.JSON(http.StatusBadRequest, response.NewErrorResponse("Invalid request: facets must be true or false"))
+		}
+	}
+
+	page, err := controller.movieService.GetMoviesPage(pageQuery)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.NewErrorResponse(err.Error()))
+	}
+
+	pageResponse := response.ToMoviePageResponse(page, pageQuery)
+	setPaginationLinks(c, pageResponse.Pagination)
+
+	if withFacets {
+		facets, err := controller.movieService.GetMovieFacets(pageQuery.Filter)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, response.NewErrorResponse(err.Error()))
+		}
+		pageResponse.Facets = response.ToMovieFacetsResponse(facets)
+	}
+
+	return c.JSON(http.StatusOK, pageResponse)
+}
+
+// parseMoviePageQuery reads the paging, sorting and filtering query parameters
+// of GET /movies. List parameters accept comma separated or repeated values.
+func parseMoviePageQuery(c echo.Context) (*domain.MoviePageQuery, error) {
+	pageQuery := &domain.MoviePageQuery{SortField: domain.MovieSortByTitle}
 	var err error
 
-	if len(genre) > 0 {
-		var genreId int
-		genreId, err = strconv.Atoi(genre)
-		movies, err = controller.movieService.GetMoviesByGenreId(int64(genreId))
-	} else {
-		movies, err = controller.movieService.GetAllMovies()
+	if sort := c.QueryParam("sort"); sort != "" {
+		pageQuery.SortField = domain.MovieSortField(sort)
+		if !pageQuery.SortField.IsValid() {
+			return nil, fmt.Errorf("unsupported sort field %q", sort)
+		}
+	}
+
+	switch order := strings.ToLower(c.QueryParam("order")); order {
+	case "", "asc":
+	case "desc":
+		pageQuery.Descending = true
+	default:
+		return nil, fmt.Errorf("order must be asc or desc")
+	}
+
+	if pageQuery.Limit, err = intQueryParam(c, "limit"); err != nil {
+		return nil, err
+	}
+
+	if cursorParam := c.QueryParam("cursor"); cursorParam != "" {
+		cursor, err := domain.DecodeMovieCursor(cursorParam, pageQuery.SortField)
+		if err != nil {
+			return nil, err
+		}
+		if cursor.Backward {
+			pageQuery.Before = cursor
+			pageQuery.Backward = true
+		} else {
+			pageQuery.After = cursor
+		}
+	}
+
+	filter := &pageQuery.Filter
+	filter.TitleContains = c.QueryParam("title")
+	filter.MPAARatings = listQueryParam(c, "mpaa_rating")
+
+	genres := listQueryParam(c, "genres")
+	if genre := c.QueryParam("genre"); genre != "" {
+		genres = append(genres, genre)
+	}
+	for _, genre := range genres {
+		genreId, err := strconv.ParseInt(genre, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("genre ids must be integers")
+		}
+		filter.GenreIds = append(filter.GenreIds, genreId)
+	}
+
+	switch genreMatch := strings.ToLower(c.QueryParam("genre_match")); genreMatch {
+	case "", "any":
+	case "all":
+		filter.GenreMatchAll = true
+	default:
+		return nil, fmt.Errorf("genre_match must be any or all")
+	}
+
+	if filter.ReleaseYearFrom, err = intQueryParam(c, "year_from"); err != nil {
+		return nil, err
+	}
+	if filter.ReleaseYearTo, err = intQueryParam(c, "year_to"); err != nil {
+		return nil, err
+	}
+
+	runtimeMin, err := intQueryParam(c, "runtime_min")
+	if err != nil {
+		return nil, err
+	}
+	runtimeMax, err := intQueryParam(c, "runtime_max")
+	if err != nil {
+		return nil, err
+	}
+	filter.RuntimeMin, filter.RuntimeMax = int64(runtimeMin), int64(runtimeMax)
+
+	return pageQuery, nil
+}
+
+func intQueryParam(c echo.Context, name string) (int, error) {
+	param := c.QueryParam(name)
+	if param == "" {
+		return 0, nil
+	}
+
+	value, err := strconv.Atoi(param)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer", name)
+	}
+	return value, nil
+}
+
+func listQueryParam(c echo.Context, name string) []string {
+	var values []string
+	for _, param := range c.QueryParams()[name] {
+		for _, value := range strings.Split(param, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
+
+// setPaginationLinks adds an RFC 8288 Link header pointing at the first,
+// previous and next pages while keeping the request's other parameters.
+func setPaginationLinks(c echo.Context, pagination response.PaginationResponse) {
+	pageLink := func(cursor string, rel string) string {
+		linkUrl := *c.Request().URL
+		query := linkUrl.Query()
+		query.Del("cursor")
+		if cursor != "" {
+			query.Set("cursor", cursor)
+		}
+		linkUrl.RawQuery = query.Encode()
+		return fmt.Sprintf("<%s>; rel=\"%s\"", linkUrl.RequestURI(), rel)
+	}
+
+	links := []string{pageLink("", "first")}
+	if pagination.PrevCursor != "" {
+		links = append(links, pageLink(pagination.PrevCursor, "prev"))
+	}
+	if pagination.NextCursor != "" {
+		links = append(links, pageLink(pagination.NextCursor, "next"))
+	}
+
+	c.Response().Header().Set("Link", strings.Join(links, ", "))
+}
+
+func (controller *MovieController) SearchMovies(c echo.Context) error {
+	text := strings.TrimSpace(c.QueryParam("q"))
+	if text == "" {
+		return c.JSON(http.StatusBadRequest, response.NewErrorResponse("Invalid request: q is required"))
 	}
 
+	limit, err := intQueryParam(c, "limit")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, response.NewErrorResponse("Invalid request: "+err.Error()))
+	}
+
+	results, err := controller.movieService.Search(text, limit)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, response.NewErrorResponse(err.Error()))
 	}
 
-	return c.JSON(http.StatusOK, response.ToMovieResponseList(movies))
+	return c.JSON(http.StatusOK, response.ToMovieSearchResponse(results))
+}
+
+func (controller *MovieController) AutocompleteMovies(c echo.Context) error {
+	limit, err := intQueryParam(c, "limit")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, response.NewErrorResponse("Invalid request: "+err.Error()))
+	}
+
+	suggestions, err := controller.movieService.Autocomplete(c.QueryParam("prefix"), limit)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.NewErrorResponse(err.Error()))
+	}
+
+	return c.JSON(http.StatusOK, response.ToMovieSuggestionsResponse(suggestions))
 }
 
 func (controller *MovieController) GetAllGenres(c echo.Context) error {
@@ -160,27 +350,80 @@ func (controller *MovieController) DeleteMovieById(c echo.Context) error {
 }
 
 func (controller *MovieController) HandleGraphql(c echo.Context) error {
-	movies, err := controller.movieService.GetAllMovies()
+	graphqlRequest, err := bindGraphqlRequest(c)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, response.NewErrorResponse(err.Error()))
+		return writeGraphqlResponse(c, http.StatusBadRequest, response.NewGraphqlErrorMessageResponse(err.Error()))
 	}
 
-	var params struct {
-		Query string `json:"query"`
+	allowMutations := c.Request().Method == http.MethodPost
+	result, err := controller.movieGraph.Execute(c.Request().Context(), graphqlRequest, allowMutations)
+	if err != nil {
+		var requestError *graph.RequestError
+		if errors.As(err, &requestError) {
+			if requestError.StatusCode == http.StatusMethodNotAllowed {
+				c.Response().Header().Set(echo.HeaderAllow, http.MethodPost)
+			}
+			return writeGraphqlResponse(c, requestError.StatusCode, response.NewGraphqlErrorResponse(requestError.Errors))
+		}
+		return writeGraphqlResponse(c, http.StatusInternalServerError, response.NewGraphqlErrorMessageResponse("Error executing query"))
 	}
 
-	err = c.Bind(&params)
-	if err != nil {
-		return c.JSON(http.StatusBadRequest, response.NewErrorResponse("Invalid request body"))
+	return writeGraphqlResponse(c, http.StatusOK, response.ToGraphqlResponse(result))
+}
+
+// bindGraphqlRequest reads a request as described by the GraphQL-over-HTTP spec:
+// URL parameters for GET, and either a JSON body or a raw application/graphql
+// document for POST.
+func bindGraphqlRequest(c echo.Context) (*request.GraphqlRequest, error) {
+	graphqlRequest := &request.GraphqlRequest{}
+
+	if c.Request().Method == http.MethodGet {
+		graphqlRequest.Query = c.QueryParam("query")
+		graphqlRequest.OperationName = c.QueryParam("operationName")
+		if variables := c.QueryParam("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &graphqlRequest.Variables); err != nil {
+				return nil, errors.New("Variables are invalid JSON.")
+			}
+		}
+		if extensions := c.QueryParam("extensions"); extensions != "" {
+			if err := json.Unmarshal([]byte(extensions), &graphqlRequest.Extensions); err != nil {
+				return nil, errors.New("Extensions are invalid JSON.")
+			}
+		}
+		return graphqlRequest, nil
 	}
 
-	g := graph.New(response.ToMovieResponseList(movies))
-	g.QueryString = params.Query
+	contentType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	switch contentType {
+	case "application/graphql":
+		body, err := io.ReadAll(c.Request().Body)
+		if err != nil {
+			return nil, errors.New("Invalid request body")
+		}
+		graphqlRequest.Query = string(body)
+	case "", echo.MIMEApplicationJSON:
+		if err := json.NewDecoder(c.Request().Body).Decode(graphqlRequest); err != nil {
+			return nil, errors.New("POST body sent invalid JSON.")
+		}
+	default:
+		return nil, fmt.Errorf("Unsupported content type: %s", contentType)
+	}
+
+	return graphqlRequest, nil
+}
+
+// writeGraphqlResponse answers with application/graphql-response+json when the
+// client accepts it and falls back to application/json otherwise.
+func writeGraphqlResponse(c echo.Context, statusCode int, graphqlResponse *response.GraphqlResponse) error {
+	contentType := echo.MIMEApplicationJSONCharsetUTF8
+	if strings.Contains(c.Request().Header.Get(echo.HeaderAccept), graphqlResponseMediaType) {
+		contentType = graphqlResponseMediaType + "; charset=utf-8"
+	}
 
-	resp, err := g.Query()
+	body, err := json.Marshal(graphqlResponse)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, response.NewErrorResponse("Error executing query"))
+		return err
 	}
 
-	return c.JSON(http.StatusOK, resp)
+	return c.Blob(statusCode, contentType, body)
 }
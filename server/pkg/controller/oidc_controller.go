@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"errors"
+	"github.com/erkindilekci/cinebase/server/pkg/domain"
+	"github.com/erkindilekci/cinebase/server/pkg/service"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const oidcStateCookie = "cinebase_oidc_state"
+
+type OidcController struct {
+	oidcService service.IOidcService
+	// clientRedirectURL is the client page the callback sends users back to,
+	// with the tokens or an error code in the URL fragment.
+	clientRedirectURL string
+	// secureCookie limits the state cookie to HTTPS, which is the case when
+	// the provider redirects to us over HTTPS.
+	secureCookie bool
+	stateTTL     time.Duration
+}
+
+func NewOidcController(oidcService service.IOidcService, clientRedirectURL string, redirectURL string, stateTTL time.Duration) *OidcController {
+	return &OidcController{oidcService, clientRedirectURL, strings.HasPrefix(redirectURL, "https://"), stateTTL}
+}
+
+func (controller *OidcController) RegisterOidcRoutes(e *echo.Echo) {
+	e.GET("/oidc/login", controller.BeginLogin)
+	e.GET("/oidc/callback", controller.Callback)
+}
+
+// BeginLogin redirects the browser to the provider's login page.
+func (controller *OidcController) BeginLogin(c echo.Context) error {
+	authURL, stateToken, err := controller.oidcService.BeginLogin(c.Request().Context())
+	if err != nil {
+		log.Errorf("error while starting single sign-on: %v", err)
+		return c.Redirect(http.StatusFound, controller.clientURL(url.Values{"error": {"sso_unavailable"}}))
+	}
+
+	c.SetCookie(controller.stateCookie(stateToken, int(controller.stateTTL.Seconds())))
+	return c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback completes the login the provider redirected back from. The tokens
+// are passed to the client in the URL fragment, which browsers don't send to
+// servers or in Referer headers.
+func (controller *OidcController) Callback(c echo.Context) error {
+	stateToken := ""
+	if cookie, err := c.Cookie(oidcStateCookie); err == nil {
+		stateToken = cookie.Value
+	}
+	c.SetCookie(controller.stateCookie("", -1))
+
+	if providerError := c.QueryParam("error"); providerError != "" {
+		return c.Redirect(http.StatusFound, controller.clientURL(url.Values{"error": {"access_denied"}}))
+	}
+
+	loginResult, err := controller.oidcService.CompleteLogin(c.Request().Context(), stateToken, c.QueryParam("state"), c.QueryParam("code"))
+	if err != nil {
+		errorCode := "sso_failed"
+		switch {
+		case errors.Is(err, domain.ErrIdentityConflict):
+			errorCode = "identity_conflict"
+		case errors.Is(err, domain.ErrEmailNotVerified):
+			errorCode = "email_not_verified"
+		case !errors.Is(err, domain.ErrSingleSignOnFailed):
+			log.Errorf("error while completing single sign-on: %v", err)
+		}
+		return c.Redirect(http.StatusFound, controller.clientURL(url.Values{"error": {errorCode}}))
+	}
+
+	if loginResult.MfaToken != "" {
+		return c.Redirect(http.StatusFound, controller.clientURL(url.Values{
+			"mfa_required": {"true"},
+			"mfa_token":    {loginResult.MfaToken},
+			"expires_in":   {strconv.FormatInt(int64(loginResult.MfaExpiresIn.Seconds()), 10)},
+		}))
+	}
+	return c.Redirect(http.StatusFound, controller.clientURL(url.Values{
+		"token":         {loginResult.Tokens.AccessToken},
+		"refresh_token": {loginResult.Tokens.RefreshToken},
+		"token_type":    {"Bearer"},
+		"expires_in":    {strconv.FormatInt(int64(loginResult.Tokens.ExpiresIn.Seconds()), 10)},
+	}))
+}
+
+func (controller *OidcController) clientURL(fragment url.Values) string {
+	return controller.clientRedirectURL + "#" + fragment.Encode()
+}
+
+// stateCookie is only sent to the callback. SameSite=Lax still sends it on
+// the top-level redirect back from the provider.
+func (controller *OidcController) stateCookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     "/oidc",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   controller.secureCookie,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
@@ -0,0 +1,60 @@
+package controller
+
+import (
+	"errors"
+	"github.com/erkindilekci/cinebase/server/pkg/controller/request"
+	"github.com/erkindilekci/cinebase/server/pkg/controller/response"
+	"github.com/erkindilekci/cinebase/server/pkg/domain"
+	"github.com/erkindilekci/cinebase/server/pkg/service"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+type PasswordController struct {
+	passwordResetService service.IPasswordResetService
+}
+
+func NewPasswordController(passwordResetService service.IPasswordResetService) *PasswordController {
+	return &PasswordController{passwordResetService}
+}
+
+func (controller *PasswordController) RegisterPasswordRoutes(e *echo.Echo) {
+	e.POST("/password/forgot", controller.ForgotPassword)
+	e.POST("/password/reset", controller.ResetPassword)
+}
+
+// ForgotPassword answers 202 whether or not the email has an account.
+func (controller *PasswordController) ForgotPassword(c echo.Context) error {
+	var forgotRequest request.ForgotPasswordRequest
+	if err := c.Bind(&forgotRequest); err != nil {
+		return c.JSON(http.StatusBadRequest, response.NewErrorResponse("Invalid request body"))
+	}
+
+	err := controller.passwordResetService.RequestReset(forgotRequest.Email)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidEmail) {
+			return c.JSON(http.StatusBadRequest, response.NewErrorResponse(err.Error()))
+		}
+		return c.JSON(http.StatusInternalServerError, response.NewErrorResponse(err.Error()))
+	}
+
+	return c.NoContent(http.StatusAccepted)
+}
+
+func (controller *PasswordController) ResetPassword(c echo.Context) error {
+	var resetRequest request.ResetPasswordRequest
+	if err := c.Bind(&resetRequest); err != nil {
+		return c.JSON(http.StatusBadRequest, response.NewErrorResponse("Invalid request body"))
+	}
+
+	err := controller.passwordResetService.ResetPassword(resetRequest.Token, resetRequest.Password)
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrInvalidPassword), errors.Is(err, domain.ErrInvalidResetToken):
+			return c.JSON(http.StatusBadRequest, response.NewErrorResponse(err.Error()))
+		}
+		return c.JSON(http.StatusInternalServerError, response.NewErrorResponse(err.Error()))
+	}
+
+	return c.NoContent(http.StatusOK)
+}
@@ -0,0 +1,9 @@
+package request
+
+type GenreRequest struct {
+	Genre string `json:"genre"`
+}
+
+type MergeGenresRequest struct {
+	TargetId int64 `json:"target_id"`
+}
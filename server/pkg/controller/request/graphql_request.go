@@ -0,0 +1,8 @@
+package request
+
+type GraphqlRequest struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+	Extensions    map[string]interface{} `json:"extensions"`
+}
@@ -1,12 +1,24 @@
 package request
 
-import "github.com/erkindilekci/cinebase/server/pkg/service/dto"
+import (
+	"github.com/erkindilekci/cinebase/server/pkg/domain"
+	"github.com/erkindilekci/cinebase/server/pkg/service/dto"
+	"time"
+)
 
 type LoginRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
 }
 
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type ChangeRoleRequest struct {
+	Role string `json:"role"`
+}
+
 type SignUpRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
@@ -18,3 +30,45 @@ func (request *SignUpRequest) ToDtoModel() *dto.UserCreate {
 		Password: request.Password,
 	}
 }
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email"`
+}
+
+// MfaCodeRequest carries a TOTP code or a recovery code.
+type MfaCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type MfaLoginRequest struct {
+	MfaToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+type ApiKeyCreateRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// ExpiresAt is optional, keys without it don't expire.
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func (request *ApiKeyCreateRequest) ToScopes() []domain.Scope {
+	scopes := make([]domain.Scope, len(request.Scopes))
+	for i, scope := range request.Scopes {
+		scopes[i] = domain.Scope(scope)
+	}
+	return scopes
+}
@@ -0,0 +1,26 @@
+package response
+
+import (
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+)
+
+// GraphqlResponse omits data entirely for requests that never reached execution,
+// as required by the GraphQL-over-HTTP spec.
+type GraphqlResponse struct {
+	Data       interface{}                `json:"data,omitempty"`
+	Errors     []gqlerrors.FormattedError `json:"errors,omitempty"`
+	Extensions map[string]interface{}     `json:"extensions,omitempty"`
+}
+
+func ToGraphqlResponse(result *graphql.Result) *GraphqlResponse {
+	return &GraphqlResponse{Data: result.Data, Errors: result.Errors, Extensions: result.Extensions}
+}
+
+func NewGraphqlErrorResponse(errors []gqlerrors.FormattedError) *GraphqlResponse {
+	return &GraphqlResponse{Errors: errors}
+}
+
+func NewGraphqlErrorMessageResponse(message string) *GraphqlResponse {
+	return NewGraphqlErrorResponse([]gqlerrors.FormattedError{gqlerrors.NewFormattedError(message)})
+}
@@ -39,13 +39,167 @@ func ToMovieResponseList(movies []*domain.Movie) []*MovieResponse {
 	return responses
 }
 
+type PaginationResponse struct {
+	Limit       int    `json:"limit"`
+	HasNext     bool   `json:"has_next"`
+	HasPrevious bool   `json:"has_previous"`
+	NextCursor  string `json:"next_cursor,omitempty"`
+	PrevCursor  string `json:"prev_cursor,omitempty"`
+}
+
+type MoviePageResponse struct {
+	Data       []*MovieResponse     `json:"data"`
+	Pagination PaginationResponse   `json:"pagination"`
+	Facets     *MovieFacetsResponse `json:"facets,omitempty"`
+}
+
+// ToMoviePageResponse wraps a page of movies together with the cursors that
+// lead to the neighbouring pages.
+func ToMoviePageResponse(page *domain.MoviePage, pageQuery *domain.MoviePageQuery) *MoviePageResponse {
+	pageResponse := &MoviePageResponse{
+		Data: make([]*MovieResponse, 0, len(page.Movies)),
+		Pagination: PaginationResponse{
+			Limit:       pageQuery.Limit,
+			HasNext:     page.HasNext,
+			HasPrevious: page.HasPrevious,
+		},
+	}
+
+	for _, movie := range page.Movies {
+		pageResponse.Data = append(pageResponse.Data, ToMovieResponse(movie))
+	}
+
+	if len(page.Movies) > 0 {
+		if page.HasNext {
+			pageResponse.Pagination.NextCursor = domain.NewMovieCursor(page.Movies[len(page.Movies)-1], pageQuery.SortField).Encode()
+		}
+		if page.HasPrevious {
+			prevCursor := domain.NewMovieCursor(page.Movies[0], pageQuery.SortField)
+			prevCursor.Backward = true
+			pageResponse.Pagination.PrevCursor = prevCursor.Encode()
+		}
+	}
+
+	return pageResponse
+}
+
+type GenreFacetResponse struct {
+	Id    int64  `json:"id"`
+	Genre string `json:"genre"`
+	Count int64  `json:"count"`
+}
+
+type MPAARatingFacetResponse struct {
+	MPAARating string `json:"mpaa_rating"`
+	Count      int64  `json:"count"`
+}
+
+type DecadeFacetResponse struct {
+	Decade int   `json:"decade"`
+	Count  int64 `json:"count"`
+}
+
+type RuntimeFacetResponse struct {
+	Bucket string `json:"bucket"`
+	Min    int64  `json:"min"`
+	Max    *int64 `json:"max"`
+	Count  int64  `json:"count"`
+}
+
+type MovieFacetsResponse struct {
+	Genres         []*GenreFacetResponse      `json:"genres"`
+	MPAARatings    []*MPAARatingFacetResponse `json:"mpaa_ratings"`
+	Decades        []*DecadeFacetResponse     `json:"decades"`
+	RuntimeBuckets []*RuntimeFacetResponse    `json:"runtime_buckets"`
+}
+
+func ToMovieFacetsResponse(facets *domain.MovieFacets) *MovieFacetsResponse {
+	facetsResponse := &MovieFacetsResponse{
+		Genres:         make([]*GenreFacetResponse, 0, len(facets.Genres)),
+		MPAARatings:    make([]*MPAARatingFacetResponse, 0, len(facets.MPAARatings)),
+		Decades:        make([]*DecadeFacetResponse, 0, len(facets.Decades)),
+		RuntimeBuckets: make([]*RuntimeFacetResponse, 0, len(facets.RuntimeBuckets)),
+	}
+
+	for _, facet := range facets.Genres {
+		facetsResponse.Genres = append(facetsResponse.Genres, &GenreFacetResponse{Id: facet.Id, Genre: facet.Genre, Count: facet.Count})
+	}
+	for _, facet := range facets.MPAARatings {
+		facetsResponse.MPAARatings = append(facetsResponse.MPAARatings, &MPAARatingFacetResponse{MPAARating: facet.MPAARating, Count: facet.Count})
+	}
+	for _, facet := range facets.Decades {
+		facetsResponse.Decades = append(facetsResponse.Decades, &DecadeFacetResponse{Decade: facet.Decade, Count: facet.Count})
+	}
+	for _, facet := range facets.RuntimeBuckets {
+		runtimeFacet := &RuntimeFacetResponse{Bucket: facet.Label, Min: facet.Min, Count: facet.Count}
+		if facet.Max > 0 {
+			max := facet.Max
+			runtimeFacet.Max = &max
+		}
+		facetsResponse.RuntimeBuckets = append(facetsResponse.RuntimeBuckets, runtimeFacet)
+	}
+
+	return facetsResponse
+}
+
+type MovieSearchResultResponse struct {
+	*MovieResponse
+	Rank           float64 `json:"rank"`
+	TitleHighlight string  `json:"title_highlight"`
+	Snippet        string  `json:"snippet"`
+}
+
+func ToMovieSearchResultResponse(result *domain.MovieSearchResult) *MovieSearchResultResponse {
+	return &MovieSearchResultResponse{
+		MovieResponse:  ToMovieResponse(result.Movie),
+		Rank:           result.Rank,
+		TitleHighlight: result.TitleHighlight,
+		Snippet:        result.Snippet,
+	}
+}
+
+type MovieSearchResponse struct {
+	Data []*MovieSearchResultResponse `json:"data"`
+}
+
+func ToMovieSearchResponse(results []*domain.MovieSearchResult) *MovieSearchResponse {
+	searchResponse := &MovieSearchResponse{Data: make([]*MovieSearchResultResponse, 0, len(results))}
+	for _, result := range results {
+		searchResponse.Data = append(searchResponse.Data, ToMovieSearchResultResponse(result))
+	}
+	return searchResponse
+}
+
+type MovieSuggestionResponse struct {
+	Id    int64  `json:"id"`
+	Title string `json:"title"`
+	Image string `json:"image"`
+}
+
+type MovieSuggestionsResponse struct {
+	Data []*MovieSuggestionResponse `json:"data"`
+}
+
+func ToMovieSuggestionsResponse(suggestions []*domain.MovieSuggestion) *MovieSuggestionsResponse {
+	suggestionsResponse := &MovieSuggestionsResponse{Data: make([]*MovieSuggestionResponse, 0, len(suggestions))}
+	for _, suggestion := range suggestions {
+		suggestionsResponse.Data = append(suggestionsResponse.Data, &MovieSuggestionResponse{
+			Id:    suggestion.Id,
+			Title: suggestion.Title,
+			Image: suggestion.Image,
+		})
+	}
+	return suggestionsResponse
+}
+
 type GenreResponse struct {
 	Id    int64  `json:"id"`
 	Genre string `json:"genre"`
+	Slug  string `json:"slug,omitempty"`
 }
 
 func ToGenreResponse(genre *domain.Genre) *GenreResponse {
-	return &GenreResponse{Id: genre.Id, Genre: genre.Genre}
+	return &GenreResponse{Id: genre.Id, Genre: genre.Genre, Slug: genre.Slug}
 }
 
 func ToGenreResponseList(genres []*domain.Genre) []*GenreResponse {
@@ -1,5 +1,10 @@
 package response
 
+import (
+	"github.com/erkindilekci/cinebase/server/pkg/domain"
+	"time"
+)
+
 type ErrorResponse struct {
 	ErrorMessage string `json:"error_message"`
 }
@@ -9,9 +14,98 @@ func NewErrorResponse(errorMessage string) *ErrorResponse {
 }
 
 type LoginResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	// ExpiresIn is the access token lifetime in seconds.
+	ExpiresIn int64 `json:"expires_in"`
+}
+
+func NewLoginResponse(tokenPair *domain.TokenPair) *LoginResponse {
+	return &LoginResponse{
+		Token:        tokenPair.AccessToken,
+		RefreshToken: tokenPair.RefreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(tokenPair.ExpiresIn.Seconds()),
+	}
+}
+
+type UserResponse struct {
+	Id    int64  `json:"id"`
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+func ToUserResponse(user *domain.User) *UserResponse {
+	return &UserResponse{Id: user.Id, Email: user.Email, Role: string(user.Role)}
+}
+
+// MfaChallengeResponse answers a correct password of an account with two-factor
+// authentication. The mfa_token is exchanged for a LoginResponse at /login/mfa.
+type MfaChallengeResponse struct {
+	MfaRequired bool   `json:"mfa_required"`
+	MfaToken    string `json:"mfa_token"`
+	// ExpiresIn is the time left to complete the login in seconds.
+	ExpiresIn int64 `json:"expires_in"`
+}
+
+func NewMfaChallengeResponse(loginResult *domain.LoginResult) *MfaChallengeResponse {
+	return &MfaChallengeResponse{
+		MfaRequired: true,
+		MfaToken:    loginResult.MfaToken,
+		ExpiresIn:   int64(loginResult.MfaExpiresIn.Seconds()),
+	}
+}
+
+type TotpEnrollmentResponse struct {
+	Secret     string `json:"secret"`
+	OtpauthUri string `json:"otpauth_uri"`
+}
+
+func ToTotpEnrollmentResponse(enrollment *domain.TotpEnrollment) *TotpEnrollmentResponse {
+	return &TotpEnrollmentResponse{Secret: enrollment.Secret, OtpauthUri: enrollment.URI}
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type ApiKeyResponse struct {
+	Id         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func ToApiKeyResponse(apiKey *domain.ApiKey) *ApiKeyResponse {
+	scopes := make([]string, len(apiKey.Scopes))
+	for i, scope := range apiKey.Scopes {
+		scopes[i] = string(scope)
+	}
+	return &ApiKeyResponse{
+		Id:         apiKey.Id,
+		Name:       apiKey.Name,
+		Prefix:     apiKey.Prefix,
+		Scopes:     scopes,
+		ExpiresAt:  apiKey.ExpiresAt,
+		LastUsedAt: apiKey.LastUsedAt,
+		CreatedAt:  apiKey.CreatedAt,
+	}
+}
+
+func ToApiKeyResponseList(apiKeys []*domain.ApiKey) []*ApiKeyResponse {
+	apiKeyResponses := make([]*ApiKeyResponse, 0, len(apiKeys))
+	for _, apiKey := range apiKeys {
+		apiKeyResponses = append(apiKeyResponses, ToApiKeyResponse(apiKey))
+	}
+	return apiKeyResponses
 }
 
-func NewLoginResponse(token string) *LoginResponse {
-	return &LoginResponse{token}
+// CreatedApiKeyResponse is the only time the key itself is shown.
+type CreatedApiKeyResponse struct {
+	*ApiKeyResponse
+	Key string `json:"key"`
 }
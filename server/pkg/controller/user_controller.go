@@ -1,24 +1,38 @@
 package controller
 
 import (
+	"errors"
 	"github.com/erkindilekci/cinebase/server/pkg/controller/request"
 	"github.com/erkindilekci/cinebase/server/pkg/controller/response"
+	"github.com/erkindilekci/cinebase/server/pkg/domain"
+	"github.com/erkindilekci/cinebase/server/pkg/middleware"
 	"github.com/erkindilekci/cinebase/server/pkg/service"
 	"github.com/labstack/echo/v4"
+	"math"
 	"net/http"
+	"strconv"
 )
 
 type UserController struct {
-	userService service.IUserService
+	userService  service.IUserService
+	tokenService service.ITokenService
+	auth         *middleware.Auth
 }
 
-func NewUserController(userService service.IUserService) *UserController {
-	return &UserController{userService}
+func NewUserController(userService service.IUserService, tokenService service.ITokenService, auth *middleware.Auth) *UserController {
+	return &UserController{userService, tokenService, auth}
 }
 
 func (controller *UserController) RegisterUserRoutes(e *echo.Echo) {
 	e.POST("/login", controller.Login)
 	e.POST("/signup", controller.SignUp)
+	e.POST("/token/refresh", controller.RefreshToken)
+	e.POST("/logout", controller.Logout, controller.auth.OptionalAuthorizationHeader)
+
+	adminGroup := e.Group("/admin")
+	adminGroup.Use(controller.auth.CheckAuthorizationHeader)
+	adminGroup.PUT("/users/:id/role", controller.ChangeRole, controller.auth.RequirePermission(domain.PermissionUsersManage))
+	adminGroup.POST("/users/:id/unlock", controller.UnlockAccount, controller.auth.RequirePermission(domain.PermissionUsersManage))
 }
 
 func (controller *UserController) Login(c echo.Context) error {
@@ -28,12 +42,65 @@ func (controller *UserController) Login(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, response.NewErrorResponse("Invalid request: unable to bind the provided data to the user structure"))
 	}
 
-	token, err := controller.userService.Login(loginRequest.Email, loginRequest.Password)
+	loginResult, err := controller.userService.Login(loginRequest.Email, loginRequest.Password, c.RealIP())
+	if err != nil {
+		var tooManyAttempts *domain.TooManyAttemptsError
+		switch {
+		case errors.As(err, &tooManyAttempts):
+			return tooManyAttemptsResponse(c, tooManyAttempts)
+		case errors.Is(err, domain.ErrInvalidCredentials):
+			return c.JSON(http.StatusUnprocessableEntity, response.NewErrorResponse(err.Error()))
+		case errors.Is(err, domain.ErrEmailNotVerified):
+			return c.JSON(http.StatusForbidden, response.NewErrorResponse(err.Error()))
+		}
+		return c.JSON(http.StatusInternalServerError, response.NewErrorResponse("error while logging in"))
+	}
+
+	if loginResult.MfaToken != "" {
+		return c.JSON(http.StatusAccepted, response.NewMfaChallengeResponse(loginResult))
+	}
+	return c.JSON(http.StatusAccepted, response.NewLoginResponse(loginResult.Tokens))
+}
+
+func (controller *UserController) RefreshToken(c echo.Context) error {
+	var refreshRequest request.RefreshTokenRequest
+	if err := c.Bind(&refreshRequest); err != nil {
+		return c.JSON(http.StatusBadRequest, response.NewErrorResponse("Invalid request body"))
+	}
+
+	tokenPair, err := controller.tokenService.Refresh(refreshRequest.RefreshToken)
 	if err != nil {
-		return c.JSON(http.StatusUnprocessableEntity, response.NewErrorResponse(err.Error()))
+		if errors.Is(err, domain.ErrInvalidRefreshToken) || errors.Is(err, domain.ErrRefreshTokenReused) {
+			return c.JSON(http.StatusUnauthorized, response.NewErrorResponse(err.Error()))
+		}
+		return c.JSON(http.StatusInternalServerError, response.NewErrorResponse(err.Error()))
 	}
 
-	return c.JSON(http.StatusAccepted, response.NewLoginResponse(token))
+	return c.JSON(http.StatusOK, response.NewLoginResponse(tokenPair))
+}
+
+// Logout ends the session of the bearer token and of the refresh token in the
+// body. Clients whose access token already expired send just the latter.
+func (controller *UserController) Logout(c echo.Context) error {
+	var refreshRequest request.RefreshTokenRequest
+	if err := c.Bind(&refreshRequest); err != nil {
+		return c.JSON(http.StatusBadRequest, response.NewErrorResponse("Invalid request body"))
+	}
+
+	claims := middleware.ClaimsFromContext(c.Request().Context())
+	if claims == nil && refreshRequest.RefreshToken == "" {
+		return c.JSON(http.StatusBadRequest, response.NewErrorResponse("Invalid request: a bearer token or refresh_token is required"))
+	}
+
+	err := controller.tokenService.Logout(claims, refreshRequest.RefreshToken)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidRefreshToken) {
+			return c.JSON(http.StatusUnauthorized, response.NewErrorResponse(err.Error()))
+		}
+		return c.JSON(http.StatusInternalServerError, response.NewErrorResponse(err.Error()))
+	}
+
+	return c.NoContent(http.StatusOK)
 }
 
 func (controller *UserController) SignUp(c echo.Context) error {
@@ -45,8 +112,62 @@ func (controller *UserController) SignUp(c echo.Context) error {
 
 	err = controller.userService.SignUp(signUpRequest.ToDtoModel())
 	if err != nil {
-		return c.JSON(http.StatusUnprocessableEntity, response.NewErrorResponse(err.Error()))
+		switch {
+		case errors.Is(err, domain.ErrInvalidEmail), errors.Is(err, domain.ErrInvalidPassword):
+			return c.JSON(http.StatusUnprocessableEntity, response.NewErrorResponse(err.Error()))
+		case errors.Is(err, domain.ErrEmailTaken):
+			return c.JSON(http.StatusConflict, response.NewErrorResponse(err.Error()))
+		}
+		return c.JSON(http.StatusInternalServerError, response.NewErrorResponse(err.Error()))
 	}
 
 	return c.NoContent(http.StatusCreated)
 }
+
+func (controller *UserController) ChangeRole(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, response.NewErrorResponse("Invalid user ID"))
+	}
+
+	var changeRoleRequest request.ChangeRoleRequest
+	if err = c.Bind(&changeRoleRequest); err != nil {
+		return c.JSON(http.StatusBadRequest, response.NewErrorResponse("Invalid request body"))
+	}
+
+	user, err := controller.userService.ChangeRole(id, domain.Role(changeRoleRequest.Role))
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrInvalidRole):
+			return c.JSON(http.StatusBadRequest, response.NewErrorResponse(err.Error()))
+		case errors.Is(err, domain.ErrUserNotFound):
+			return c.JSON(http.StatusNotFound, response.NewErrorResponse(err.Error()))
+		case errors.Is(err, domain.ErrLastAdmin):
+			return c.JSON(http.StatusConflict, response.NewErrorResponse(err.Error()))
+		}
+		return c.JSON(http.StatusInternalServerError, response.NewErrorResponse(err.Error()))
+	}
+
+	return c.JSON(http.StatusOK, response.ToUserResponse(user))
+}
+
+func (controller *UserController) UnlockAccount(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, response.NewErrorResponse("Invalid user ID"))
+	}
+
+	if err = controller.userService.UnlockAccount(id); err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return c.JSON(http.StatusNotFound, response.NewErrorResponse(err.Error()))
+		}
+		return c.JSON(http.StatusInternalServerError, response.NewErrorResponse(err.Error()))
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func tooManyAttemptsResponse(c echo.Context, err *domain.TooManyAttemptsError) error {
+	c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(err.RetryAfter.Seconds()))))
+	return c.JSON(http.StatusTooManyRequests, response.NewErrorResponse(err.Error()))
+}
@@ -2,9 +2,45 @@ package domain
 
 import (
 	"github.com/golang-jwt/jwt/v5"
+	"slices"
 )
 
 type Claims struct {
 	Email string `json:"email"`
+	// Role is the user's role when the token was issued. Tokens issued before
+	// roles existed carry none and are granted no permissions.
+	Role Role `json:"role,omitempty"`
+	// SessionId is the refresh token family the token was issued with.
+	SessionId string `json:"sid,omitempty"`
+	// EmailVerified tells whether the email was verified when the token was
+	// issued. A token issued before that lacks it until it's refreshed.
+	EmailVerified bool `json:"email_verified"`
+	// AuthMethods lists how the user authenticated, such as pwd and otp.
+	AuthMethods []string `json:"amr,omitempty"`
+	// ApiKeyId and Scopes are set when the request was made with an API key
+	// instead of a token.
+	ApiKeyId int64   `json:"-"`
+	Scopes   []Scope `json:"-"`
 	jwt.RegisteredClaims
 }
+
+// HasMfa tells whether the user passed a second factor.
+func (claims *Claims) HasMfa() bool {
+	return slices.Contains(claims.AuthMethods, AuthMethodOtp)
+}
+
+// IsApiKey tells whether the claims come from an API key.
+func (claims *Claims) IsApiKey() bool {
+	return claims.ApiKeyId != 0
+}
+
+// ScopesAllow tells whether the scopes of an API key include permission.
+// Tokens aren't limited by scopes.
+func (claims *Claims) ScopesAllow(permission Permission) bool {
+	if !claims.IsApiKey() {
+		return true
+	}
+	return slices.ContainsFunc(claims.Scopes, func(scope Scope) bool {
+		return scope.Allows(permission)
+	})
+}
@@ -0,0 +1,31 @@
+package domain
+
+import "errors"
+
+var (
+	ErrEmailNotVerified          = errors.New("the email address hasn't been verified yet")
+	ErrInvalidVerificationToken  = errors.New("invalid or expired verification link")
+	ErrInvalidVerificationPolicy = errors.New("verification policy must be one of none, login or write")
+)
+
+// VerificationPolicy decides what accounts can do before their email address
+// is verified.
+type VerificationPolicy string
+
+const (
+	// VerificationPolicyNone doesn't restrict unverified accounts.
+	VerificationPolicyNone VerificationPolicy = "none"
+	// VerificationPolicyLogin refuses to log unverified accounts in.
+	VerificationPolicyLogin VerificationPolicy = "login"
+	// VerificationPolicyWrite lets unverified accounts log in and read, but
+	// denies them every permission their role grants.
+	VerificationPolicyWrite VerificationPolicy = "write"
+)
+
+func (policy VerificationPolicy) IsValid() bool {
+	switch policy {
+	case VerificationPolicyNone, VerificationPolicyLogin, VerificationPolicyWrite:
+		return true
+	}
+	return false
+}
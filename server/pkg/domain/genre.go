@@ -1,6 +1,18 @@
 package domain
 
+import "errors"
+
+var (
+	ErrGenreNotFound = errors.New("genre not found")
+	ErrInvalidGenre  = errors.New("invalid genre")
+	// ErrGenreExists is returned when a genre name collides with another
+	// genre's name or slug.
+	ErrGenreExists = errors.New("a genre with the same name already exists")
+	ErrGenreInUse  = errors.New("genre is still assigned to movies")
+)
+
 type Genre struct {
 	Id    int64  `json:"id"`
 	Genre string `json:"genre"`
+	Slug  string `json:"slug,omitempty"`
 }
@@ -0,0 +1,19 @@
+package domain
+
+import "errors"
+
+var (
+	ErrSingleSignOnFailed = errors.New("single sign-on failed")
+	// ErrIdentityConflict means an account has the provider's email but the
+	// provider didn't verify it, so the two can't be linked safely.
+	ErrIdentityConflict = errors.New("an account with this email already exists, log in with its password")
+)
+
+// UserIdentity links an account to its subject at an OpenID Connect provider.
+type UserIdentity struct {
+	Id      int64
+	UserId  int64
+	Issuer  string
+	Subject string
+	Email   string
+}
@@ -0,0 +1,20 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrInvalidCredentials is the only error a failed login reports, whether the
+// email is unknown or the password wrong.
+var ErrInvalidCredentials = errors.New("invalid email or password")
+
+// TooManyAttemptsError is returned while logins are blocked after repeated
+// failures.
+type TooManyAttemptsError struct {
+	RetryAfter time.Duration
+}
+
+func (err *TooManyAttemptsError) Error() string {
+	return "too many failed login attempts, try again later"
+}
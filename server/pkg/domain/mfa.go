@@ -0,0 +1,48 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrMfaAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrMfaNotEnrolled    = errors.New("two-factor authentication isn't enabled")
+	ErrInvalidMfaCode    = errors.New("invalid authentication code")
+	ErrInvalidMfaToken   = errors.New("invalid or expired two-factor challenge")
+	// ErrMfaRequired is returned when the role of an account requires it to
+	// log in with a second factor before using its permissions.
+	ErrMfaRequired = errors.New("your role requires two-factor authentication")
+)
+
+// Authentication methods as listed in the amr claim, see RFC 8176.
+const (
+	AuthMethodPassword = "pwd"
+	AuthMethodOtp      = "otp"
+	// AuthMethodApiKey isn't registered by RFC 8176, it marks requests made
+	// with an API key.
+	AuthMethodApiKey = "apikey"
+)
+
+// Totp is a user's TOTP enrollment. It only counts once ConfirmedAt is set.
+type Totp struct {
+	Secret      string
+	ConfirmedAt *time.Time
+	// LastStep is the time step of the last accepted code, which can't be
+	// used again.
+	LastStep *int64
+}
+
+// TotpEnrollment is what an authenticator app needs to be set up.
+type TotpEnrollment struct {
+	Secret string
+	URI    string
+}
+
+// LoginResult holds either the tokens of a completed login or, when a second
+// factor is needed, the token of the MFA challenge.
+type LoginResult struct {
+	Tokens       *TokenPair
+	MfaToken     string
+	MfaExpiresIn time.Duration
+}
@@ -2,9 +2,12 @@ package domain
 
 import (
 	"database/sql"
+	"errors"
 	"time"
 )
 
+var ErrMovieNotFound = errors.New("movie not found")
+
 type Movie struct {
 	Id             int64
 	Title          string
@@ -18,3 +21,17 @@ type Movie struct {
 	CreatedAt      sql.NullTime
 	UpdateAt       sql.NullTime
 }
+
+type MovieSearchResult struct {
+	Movie *Movie
+	Rank  float64
+	// TitleHighlight and Snippet wrap the matched terms in <mark> tags.
+	TitleHighlight string
+	Snippet        string
+}
+
+type MovieSuggestion struct {
+	Id    int64
+	Title string
+	Image string
+}
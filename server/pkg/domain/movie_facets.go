@@ -0,0 +1,52 @@
+package domain
+
+// RuntimeBucket is a runtime range movies are grouped into when counting
+// facets. Max is exclusive and zero means the bucket is unbounded.
+type RuntimeBucket struct {
+	Label string
+	Min   int64
+	Max   int64
+}
+
+// RuntimeBuckets are the runtime facet ranges in ascending order. Their
+// boundaries are contiguous, every runtime falls into exactly one of them.
+var RuntimeBuckets = []RuntimeBucket{
+	{Label: "under_90", Min: 0, Max: 90},
+	{Label: "90_to_120", Min: 90, Max: 120},
+	{Label: "120_to_150", Min: 120, Max: 150},
+	{Label: "over_150", Min: 150},
+}
+
+type GenreFacet struct {
+	Id    int64
+	Genre string
+	Count int64
+}
+
+type MPAARatingFacet struct {
+	MPAARating string
+	Count      int64
+}
+
+type DecadeFacet struct {
+	// Decade is the first year of the decade, e.g. 1990.
+	Decade int
+	Count  int64
+}
+
+type RuntimeFacet struct {
+	Label string
+	Min   int64
+	Max   int64
+	Count int64
+}
+
+// MovieFacets holds how many movies each facet value would yield for a
+// filter. Every facet ignores the filter's own condition on that dimension,
+// so the counts of the values that aren't selected yet stay meaningful.
+type MovieFacets struct {
+	Genres         []*GenreFacet
+	MPAARatings    []*MPAARatingFacet
+	Decades        []*DecadeFacet
+	RuntimeBuckets []*RuntimeFacet
+}
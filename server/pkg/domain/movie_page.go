@@ -0,0 +1,136 @@
+package domain
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+)
+
+type MovieSortField string
+
+func (sortField MovieSortField) IsValid() bool {
+	switch sortField {
+	case MovieSortByTitle, MovieSortByReleaseDate, MovieSortByRuntime, MovieSortByCreatedAt:
+		return true
+	}
+	return false
+}
+
+const (
+	MovieSortByTitle       MovieSortField = "title"
+	MovieSortByReleaseDate MovieSortField = "release_date"
+	MovieSortByRuntime     MovieSortField = "runtime"
+	MovieSortByCreatedAt   MovieSortField = "created_at"
+)
+
+const sortValueTimeLayout = "2006-01-02 15:04:05.999999"
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+type MovieFilter struct {
+	TitleContains string
+	GenreIds      []int64
+	// GenreMatchAll requires a movie to have every genre in GenreIds rather
+	// than at least one of them.
+	GenreMatchAll   bool
+	MPAARatings     []string
+	ReleaseYearFrom int
+	ReleaseYearTo   int
+	RuntimeMin      int64
+	RuntimeMax      int64
+}
+
+// MovieCursor points at a movie within a listing sorted by SortField. It
+// carries the movie's sort value and id so the next page can be read with a
+// keyset condition instead of an offset.
+type MovieCursor struct {
+	SortField MovieSortField `json:"f"`
+	SortValue string         `json:"v"`
+	Id        int64          `json:"i"`
+	// Backward marks a cursor that points to the page ending before it, used
+	// by APIs that take a single cursor parameter.
+	Backward bool `json:"b,omitempty"`
+}
+
+type MoviePageQuery struct {
+	Filter     MovieFilter
+	SortField  MovieSortField
+	Descending bool
+	After      *MovieCursor
+	Before     *MovieCursor
+	// Backward reads the page that ends at Before (or at the end of the list)
+	// instead of the one that starts at After.
+	Backward bool
+	Limit    int
+}
+
+type MoviePage struct {
+	Movies      []*Movie
+	HasNext     bool
+	HasPrevious bool
+}
+
+func NewMovieCursor(movie *Movie, sortField MovieSortField) *MovieCursor {
+	cursor := &MovieCursor{SortField: sortField, Id: movie.Id}
+
+	switch sortField {
+	case MovieSortByReleaseDate:
+		cursor.SortValue = movie.ReleaseDate.Format("2006-01-02")
+	case MovieSortByRuntime:
+		cursor.SortValue = strconv.FormatInt(movie.Runtime, 10)
+	case MovieSortByCreatedAt:
+		if movie.CreatedAt.Valid {
+			cursor.SortValue = movie.CreatedAt.Time.Format(sortValueTimeLayout)
+		} else {
+			cursor.SortValue = "epoch"
+		}
+	default:
+		cursor.SortValue = movie.Title
+	}
+
+	return cursor
+}
+
+func (cursor *MovieCursor) Encode() string {
+	encoded, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+// DecodeMovieCursor parses a cursor produced by Encode and makes sure it was
+// issued for a listing sorted by sortField.
+func DecodeMovieCursor(encoded string, sortField MovieSortField) (*MovieCursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor MovieCursor
+	if err = json.Unmarshal(decoded, &cursor); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	if cursor.SortField != sortField || !validSortValue(sortField, cursor.SortValue) {
+		return nil, ErrInvalidCursor
+	}
+
+	return &cursor, nil
+}
+
+func validSortValue(sortField MovieSortField, sortValue string) bool {
+	var err error
+
+	switch sortField {
+	case MovieSortByReleaseDate:
+		_, err = time.Parse("2006-01-02", sortValue)
+	case MovieSortByRuntime:
+		_, err = strconv.ParseInt(sortValue, 10, 64)
+	case MovieSortByCreatedAt:
+		if sortValue != "epoch" {
+			_, err = time.Parse(sortValueTimeLayout, sortValue)
+		}
+	}
+
+	return err == nil
+}
@@ -0,0 +1,18 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+
+// PasswordResetToken is the stored form of a token mailed to reset a
+// password. It can be used once, before ExpiresAt.
+type PasswordResetToken struct {
+	Id        int64
+	UserId    int64
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
@@ -0,0 +1,50 @@
+package domain
+
+type Role string
+
+const (
+	RoleViewer Role = "viewer"
+	RoleEditor Role = "editor"
+	RoleAdmin  Role = "admin"
+)
+
+type Permission string
+
+const (
+	PermissionMoviesWrite  Permission = "movies:write"
+	PermissionMoviesDelete Permission = "movies:delete"
+	PermissionGenresWrite  Permission = "genres:write"
+	PermissionGenresDelete Permission = "genres:delete"
+	PermissionUsersManage  Permission = "users:manage"
+)
+
+// rolePermissions lists what each role may do on top of the public, read-only
+// routes. Viewers get nothing beyond those.
+var rolePermissions = map[Role][]Permission{
+	RoleViewer: {},
+	RoleEditor: {PermissionMoviesWrite, PermissionGenresWrite},
+	RoleAdmin: {
+		PermissionMoviesWrite, PermissionMoviesDelete,
+		PermissionGenresWrite, PermissionGenresDelete,
+		PermissionUsersManage,
+	},
+}
+
+func (role Role) IsValid() bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// IsPrivileged tells whether the role grants any permission.
+func (role Role) IsPrivileged() bool {
+	return len(rolePermissions[role]) > 0
+}
+
+func (role Role) Can(permission Permission) bool {
+	for _, granted := range rolePermissions[role] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
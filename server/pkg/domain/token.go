@@ -0,0 +1,36 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	// ErrRefreshTokenReused means an already rotated refresh token was
+	// presented again, which revokes every token of its session.
+	ErrRefreshTokenReused = errors.New("refresh token was already used, the session has been revoked")
+)
+
+// TokenPair is what a client receives after logging in or refreshing.
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    time.Duration
+}
+
+// RefreshToken is the stored form of an opaque refresh token. Rotating a token
+// keeps the FamilyId, so a whole login session can be revoked at once.
+type RefreshToken struct {
+	Id              int64
+	UserId          int64
+	FamilyId        string
+	TokenHash       string
+	AccessJti       string
+	AccessExpiresAt time.Time
+	ExpiresAt       time.Time
+	UsedAt          *time.Time
+	RevokedAt       *time.Time
+	// Mfa tells whether the session was started with a second factor.
+	Mfa bool
+}
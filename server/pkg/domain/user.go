@@ -2,24 +2,29 @@ package domain
 
 import (
 	"errors"
-	"golang.org/x/crypto/bcrypt"
+	"time"
+)
+
+var (
+	ErrUserNotFound    = errors.New("user not found")
+	ErrInvalidRole     = errors.New("role must be one of viewer, editor or admin")
+	ErrLastAdmin       = errors.New("the last admin can't be demoted")
+	ErrInvalidEmail    = errors.New("invalid email")
+	ErrInvalidPassword = errors.New("invalid password")
+	ErrEmailTaken      = errors.New("an account with this email already exists")
 )
 
 type User struct {
 	Id       int64
 	Email    string
 	Password string
+	Role     Role
+	// EmailVerifiedAt is when the user proved they own Email, nil until then.
+	EmailVerifiedAt *time.Time
+	// MfaEnabled tells whether the user confirmed a TOTP enrollment.
+	MfaEnabled bool
 }
 
-func (u *User) PasswordMatches(plainText string) (bool, error) {
-	err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(plainText))
-	if err != nil {
-		switch {
-		case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
-			return false, nil
-		default:
-			return false, err
-		}
-	}
-	return true, nil
+func (u *User) IsEmailVerified() bool {
+	return u.EmailVerifiedAt != nil
 }
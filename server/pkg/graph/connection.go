@@ -0,0 +1,327 @@
+package graph
+
+import (
+	"errors"
+	"github.com/erkindilekci/cinebase/server/pkg/controller/response"
+	"github.com/erkindilekci/cinebase/server/pkg/domain"
+	"github.com/graphql-go/graphql"
+)
+
+type movieConnection struct {
+	page      *domain.MoviePage
+	filter    domain.MovieFilter
+	sortField domain.MovieSortField
+}
+
+type movieEdge struct {
+	Cursor string                  `json:"cursor"`
+	Node   *response.MovieResponse `json:"node"`
+}
+
+type pageInfo struct {
+	HasNextPage     bool    `json:"hasNextPage"`
+	HasPreviousPage bool    `json:"hasPreviousPage"`
+	StartCursor     *string `json:"startCursor"`
+	EndCursor       *string `json:"endCursor"`
+}
+
+var movieOrderFieldEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name: "MovieOrderField",
+	Values: graphql.EnumValueConfigMap{
+		"TITLE":        &graphql.EnumValueConfig{Value: domain.MovieSortByTitle},
+		"RELEASE_DATE": &graphql.EnumValueConfig{Value: domain.MovieSortByReleaseDate},
+		"RUNTIME":      &graphql.EnumValueConfig{Value: domain.MovieSortByRuntime},
+		"CREATED_AT":   &graphql.EnumValueConfig{Value: domain.MovieSortByCreatedAt},
+	},
+})
+
+var orderDirectionEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name: "OrderDirection",
+	Values: graphql.EnumValueConfigMap{
+		"ASC":  &graphql.EnumValueConfig{Value: "asc"},
+		"DESC": &graphql.EnumValueConfig{Value: "desc"},
+	},
+})
+
+var genreMatchEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name: "GenreMatch",
+	Values: graphql.EnumValueConfigMap{
+		"ANY": &graphql.EnumValueConfig{Value: "any"},
+		"ALL": &graphql.EnumValueConfig{Value: "all"},
+	},
+})
+
+var movieFilterInput = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "MovieFilter",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"titleContains":   &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"genreIds":        &graphql.InputObjectFieldConfig{Type: graphql.NewList(graphql.NewNonNull(graphql.Int))},
+		"genreMatch":      &graphql.InputObjectFieldConfig{Type: genreMatchEnum, DefaultValue: "any"},
+		"mpaaRatings":     &graphql.InputObjectFieldConfig{Type: graphql.NewList(graphql.NewNonNull(graphql.String))},
+		"releaseYearFrom": &graphql.InputObjectFieldConfig{Type: graphql.Int},
+		"releaseYearTo":   &graphql.InputObjectFieldConfig{Type: graphql.Int},
+		"runtimeMin":      &graphql.InputObjectFieldConfig{Type: graphql.Int},
+		"runtimeMax":      &graphql.InputObjectFieldConfig{Type: graphql.Int},
+	},
+})
+
+var movieOrderInput = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "MovieOrder",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"field":     &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(movieOrderFieldEnum)},
+		"direction": &graphql.InputObjectFieldConfig{Type: orderDirectionEnum, DefaultValue: "asc"},
+	},
+})
+
+var pageInfoType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "PageInfo",
+	Fields: graphql.Fields{
+		"hasNextPage":     &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+		"hasPreviousPage": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+		"startCursor":     &graphql.Field{Type: graphql.String},
+		"endCursor":       &graphql.Field{Type: graphql.String},
+	},
+})
+
+var movieFacetsType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "MovieFacets",
+	Description: "Movie counts per facet value, each facet ignoring the filter on its own dimension",
+	Fields: graphql.Fields{
+		"genres": &graphql.Field{Type: graphql.NewList(graphql.NewObject(graphql.ObjectConfig{
+			Name: "GenreFacet",
+			Fields: graphql.Fields{
+				"id":    &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+				"genre": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+				"count": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			},
+		}))},
+		"mpaaRatings": &graphql.Field{Type: graphql.NewList(graphql.NewObject(graphql.ObjectConfig{
+			Name: "MpaaRatingFacet",
+			Fields: graphql.Fields{
+				"mpaaRating": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+				"count":      &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			},
+		}))},
+		"decades": &graphql.Field{Type: graphql.NewList(graphql.NewObject(graphql.ObjectConfig{
+			Name: "DecadeFacet",
+			Fields: graphql.Fields{
+				"decade": &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Description: "First year of the decade"},
+				"count":  &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			},
+		}))},
+		"runtimeBuckets": &graphql.Field{Type: graphql.NewList(graphql.NewObject(graphql.ObjectConfig{
+			Name: "RuntimeFacet",
+			Fields: graphql.Fields{
+				"label": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+				"min":   &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+				"max": &graphql.Field{
+					Type:        graphql.Int,
+					Description: "Exclusive upper bound, null for the last bucket",
+					Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+						if facet := params.Source.(*domain.RuntimeFacet); facet.Max > 0 {
+							return facet.Max, nil
+						}
+						return nil, nil
+					},
+				},
+				"count": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			},
+		}))},
+	},
+})
+
+// moviesConnectionField builds the Relay-style moviesConnection query field,
+// which pages through movies with opaque keyset cursors.
+func (graph *Graph) moviesConnectionField() *graphql.Field {
+	movieEdgeType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "MovieEdge",
+		Fields: graphql.Fields{
+			"cursor": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"node":   &graphql.Field{Type: graph.movieType},
+		},
+	})
+
+	movieConnectionType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "MovieConnection",
+		Fields: graphql.Fields{
+			"edges": &graphql.Field{
+				Type: graphql.NewList(movieEdgeType),
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					connection := params.Source.(*movieConnection)
+					edges := make([]*movieEdge, 0, len(connection.page.Movies))
+					for _, movie := range connection.page.Movies {
+						edges = append(edges, &movieEdge{
+							Cursor: domain.NewMovieCursor(movie, connection.sortField).Encode(),
+							Node:   response.ToMovieResponse(movie),
+						})
+					}
+					return edges, nil
+				},
+			},
+			"nodes": &graphql.Field{
+				Type: graphql.NewList(graph.movieType),
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					connection := params.Source.(*movieConnection)
+					return response.ToMovieResponseList(connection.page.Movies), nil
+				},
+			},
+			"pageInfo": &graphql.Field{
+				Type: graphql.NewNonNull(pageInfoType),
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					connection := params.Source.(*movieConnection)
+					info := &pageInfo{
+						HasNextPage:     connection.page.HasNext,
+						HasPreviousPage: connection.page.HasPrevious,
+					}
+					if movies := connection.page.Movies; len(movies) > 0 {
+						startCursor := domain.NewMovieCursor(movies[0], connection.sortField).Encode()
+						endCursor := domain.NewMovieCursor(movies[len(movies)-1], connection.sortField).Encode()
+						info.StartCursor = &startCursor
+						info.EndCursor = &endCursor
+					}
+					return info, nil
+				},
+			},
+			"totalCount": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.Int),
+				Description: "Number of movies matching the filter across all pages",
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					connection := params.Source.(*movieConnection)
+					return graph.movieService.CountMovies(connection.filter)
+				},
+			},
+			"facets": &graphql.Field{
+				Type:        graphql.NewNonNull(movieFacetsType),
+				Description: "Movie counts per genre, rating, decade and runtime bucket for the filter",
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					connection := params.Source.(*movieConnection)
+					return graph.movieService.GetMovieFacets(connection.filter)
+				},
+			},
+		},
+	})
+
+	return &graphql.Field{
+		Type:        movieConnectionType,
+		Description: "Page through movies with cursors",
+		Args: graphql.FieldConfigArgument{
+			"first":   &graphql.ArgumentConfig{Type: graphql.Int},
+			"after":   &graphql.ArgumentConfig{Type: graphql.String},
+			"last":    &graphql.ArgumentConfig{Type: graphql.Int},
+			"before":  &graphql.ArgumentConfig{Type: graphql.String},
+			"filter":  &graphql.ArgumentConfig{Type: movieFilterInput},
+			"orderBy": &graphql.ArgumentConfig{Type: movieOrderInput},
+		},
+		Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+			pageQuery, err := moviePageQueryFromArgs(params.Args)
+			if err != nil {
+				return nil, err
+			}
+
+			// first: 0 or last: 0 asks for no movies rather than the default
+			// page size, so the page is empty without a query.
+			if pageQuery.Limit == 0 && (params.Args["first"] != nil || params.Args["last"] != nil) {
+				return &movieConnection{page: emptyMoviePage(pageQuery), filter: pageQuery.Filter, sortField: pageQuery.SortField}, nil
+			}
+
+			page, err := graph.movieService.GetMoviesPage(pageQuery)
+			if err != nil {
+				return nil, err
+			}
+
+			return &movieConnection{page: page, filter: pageQuery.Filter, sortField: pageQuery.SortField}, nil
+		},
+	}
+}
+
+func moviePageQueryFromArgs(args map[string]interface{}) (*domain.MoviePageQuery, error) {
+	pageQuery := &domain.MoviePageQuery{SortField: domain.MovieSortByTitle}
+
+	if orderBy, ok := args["orderBy"].(map[string]interface{}); ok {
+		if field, ok := orderBy["field"].(domain.MovieSortField); ok {
+			pageQuery.SortField = field
+		}
+		pageQuery.Descending = orderBy["direction"] == "desc"
+	}
+
+	if filter, ok := args["filter"].(map[string]interface{}); ok {
+		pageQuery.Filter = movieFilterFromArgs(filter)
+	}
+
+	first, hasFirst := args["first"].(int)
+	last, hasLast := args["last"].(int)
+	if hasFirst && hasLast {
+		return nil, errors.New("first and last can't be used together")
+	}
+	if (hasFirst && first < 0) || (hasLast && last < 0) {
+		return nil, errors.New("first and last must not be negative")
+	}
+
+	if hasLast {
+		pageQuery.Backward = true
+		pageQuery.Limit = last
+	} else {
+		pageQuery.Limit = first
+	}
+
+	if after, ok := args["after"].(string); ok {
+		cursor, err := domain.DecodeMovieCursor(after, pageQuery.SortField)
+		if err != nil {
+			return nil, err
+		}
+		pageQuery.After = cursor
+	}
+
+	if before, ok := args["before"].(string); ok {
+		cursor, err := domain.DecodeMovieCursor(before, pageQuery.SortField)
+		if err != nil {
+			return nil, err
+		}
+		pageQuery.Before = cursor
+	}
+
+	return pageQuery, nil
+}
+
+// emptyMoviePage is the page of a query for no movies. Like a full page, it
+// tells from the cursor whether movies precede or follow it, as counting the
+// movies on its other side would need a query.
+func emptyMoviePage(pageQuery *domain.MoviePageQuery) *domain.MoviePage {
+	if pageQuery.Backward {
+		return &domain.MoviePage{HasNext: pageQuery.Before != nil}
+	}
+	return &domain.MoviePage{HasPrevious: pageQuery.After != nil}
+}
+
+func movieFilterFromArgs(args map[string]interface{}) domain.MovieFilter {
+	var filter domain.MovieFilter
+
+	if titleContains, ok := args["titleContains"].(string); ok {
+		filter.TitleContains = titleContains
+	}
+	if genreIds, ok := args["genreIds"].([]interface{}); ok {
+		for _, genreId := range genreIds {
+			filter.GenreIds = append(filter.GenreIds, int64(genreId.(int)))
+		}
+	}
+	filter.GenreMatchAll = args["genreMatch"] == "all"
+	if mpaaRatings, ok := args["mpaaRatings"].([]interface{}); ok {
+		for _, mpaaRating := range mpaaRatings {
+			filter.MPAARatings = append(filter.MPAARatings, mpaaRating.(string))
+		}
+	}
+	if releaseYearFrom, ok := args["releaseYearFrom"].(int); ok {
+		filter.ReleaseYearFrom = releaseYearFrom
+	}
+	if releaseYearTo, ok := args["releaseYearTo"].(int); ok {
+		filter.ReleaseYearTo = releaseYearTo
+	}
+	if runtimeMin, ok := args["runtimeMin"].(int); ok {
+		filter.RuntimeMin = int64(runtimeMin)
+	}
+	if runtimeMax, ok := args["runtimeMax"].(int); ok {
+		filter.RuntimeMax = int64(runtimeMax)
+	}
+
+	return filter
+}
@@ -0,0 +1,48 @@
+package graph
+
+import (
+	"fmt"
+	"github.com/erkindilekci/cinebase/server/pkg/domain"
+	"testing"
+)
+
+func TestZeroPageSizeReturnsNoEdges(t *testing.T) {
+	cursor := domain.NewMovieCursor(&domain.Movie{Id: 10, Title: "A"}, domain.MovieSortByTitle).Encode()
+
+	tests := []struct {
+		arguments       string
+		hasNextPage     bool
+		hasPreviousPage bool
+	}{
+		{"first: 0", false, false},
+		{fmt.Sprintf("first: 0, after: %q", cursor), false, true},
+		{"last: 0", false, false},
+		{fmt.Sprintf("last: 0, before: %q", cursor), true, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.arguments, func(t *testing.T) {
+			// GetMoviesPage isn't implemented, so a query for movies fails.
+			data := executeQuery(t, newCountingMovieService(), fmt.Sprintf(`{
+				moviesConnection(%s) {
+					edges { cursor }
+					pageInfo { hasNextPage hasPreviousPage startCursor endCursor }
+				}
+			}`, test.arguments))
+
+			connection := data["moviesConnection"].(map[string]interface{})
+			if edges := connection["edges"].([]interface{}); len(edges) != 0 {
+				t.Errorf("got %d edges, want none", len(edges))
+			}
+
+			pageInfo := connection["pageInfo"].(map[string]interface{})
+			if pageInfo["hasNextPage"] != test.hasNextPage || pageInfo["hasPreviousPage"] != test.hasPreviousPage {
+				t.Errorf("hasNextPage = %v, hasPreviousPage = %v, want %t and %t",
+					pageInfo["hasNextPage"], pageInfo["hasPreviousPage"], test.hasNextPage, test.hasPreviousPage)
+			}
+			if pageInfo["startCursor"] != nil || pageInfo["endCursor"] != nil {
+				t.Errorf("startCursor = %v, endCursor = %v, want null", pageInfo["startCursor"], pageInfo["endCursor"])
+			}
+		})
+	}
+}
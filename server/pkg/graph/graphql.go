@@ -1,194 +1,510 @@
 package graph
 
 import (
+	"context"
 	"errors"
+	"github.com/erkindilekci/cinebase/server/pkg/controller/request"
 	"github.com/erkindilekci/cinebase/server/pkg/controller/response"
+	"github.com/erkindilekci/cinebase/server/pkg/domain"
+	"github.com/erkindilekci/cinebase/server/pkg/middleware"
+	"github.com/erkindilekci/cinebase/server/pkg/service"
 	"github.com/graphql-go/graphql"
-	"strings"
-	"time"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"net/http"
+)
+
+var (
+	errUnauthorized = errors.New("unauthorized: a valid token is required")
+	errForbidden    = errors.New("forbidden: your role doesn't allow this action")
+	// errEmailNotVerified is returned under the write verification policy.
+	errEmailNotVerified = errors.New("forbidden: verify your email address first")
+	// errMfaRequired is returned when privileged roles must use a second factor.
+	errMfaRequired = errors.New("forbidden: log in with two-factor authentication first")
+	// errInsufficientScope is returned for API keys lacking a scope.
+	errInsufficientScope = errors.New("forbidden: the API key's scopes don't allow this action")
 )
 
 type Graph struct {
-	Movies      []*response.MovieResponse
-	QueryString string
-	Config      graphql.SchemaConfig
-	fields      graphql.Fields
-	movieType   *graphql.Object
+	movieService     service.IMovieService
+	auth             *middleware.Auth
+	limits           Limits
+	persistedQueries *PersistedQueries
+	Schema           graphql.Schema
+	movieType        *graphql.Object
+	genreType        *graphql.Object
 }
 
-func New(movies []*response.MovieResponse) *Graph {
-	var movieType = graphql.NewObject(
+func New(movieService service.IMovieService, auth *middleware.Auth, limits Limits, persistedQueries *PersistedQueries) (*Graph, error) {
+	graph := &Graph{movieService: movieService, auth: auth, limits: limits, persistedQueries: persistedQueries}
+
+	graph.movieType = graphql.NewObject(
 		graphql.ObjectConfig{
 			Name: "Movie",
-			Fields: graphql.Fields{
-				"id":           &graphql.Field{Type: graphql.Int},
-				"title":        &graphql.Field{Type: graphql.String},
-				"release_date": &graphql.Field{Type: graphql.DateTime},
-				"runtime":      &graphql.Field{Type: graphql.Int},
-				"mpaa_rating":  &graphql.Field{Type: graphql.String},
-				"description":  &graphql.Field{Type: graphql.String},
-				"image":        &graphql.Field{Type: graphql.String},
-				"created_at":   &graphql.Field{Type: graphql.String},
-				"updated_at":   &graphql.Field{Type: graphql.DateTime},
-			},
+			Fields: graphql.FieldsThunk(func() graphql.Fields {
+				return graphql.Fields{
+					"id":           &graphql.Field{Type: graphql.Int},
+					"title":        &graphql.Field{Type: graphql.String},
+					"release_date": &graphql.Field{Type: graphql.DateTime},
+					"runtime":      &graphql.Field{Type: graphql.Int},
+					"mpaa_rating":  &graphql.Field{Type: graphql.String},
+					"description":  &graphql.Field{Type: graphql.String},
+					"image":        &graphql.Field{Type: graphql.String},
+					"created_at":   &graphql.Field{Type: graphql.String},
+					"updated_at":   &graphql.Field{Type: graphql.DateTime},
+					"genres": &graphql.Field{
+						Type:        graphql.NewList(graph.genreType),
+						Description: "Genres the movie belongs to",
+						Resolve:     graph.resolveMovieGenres,
+					},
+				}
+			}),
 		},
 	)
 
+	graph.genreType = graphql.NewObject(
+		graphql.ObjectConfig{
+			Name: "Genre",
+			Fields: graphql.FieldsThunk(func() graphql.Fields {
+				return graphql.Fields{
+					"id":    &graphql.Field{Type: graphql.Int},
+					"genre": &graphql.Field{Type: graphql.String},
+					"slug":  &graphql.Field{Type: graphql.String, Description: "URL-friendly genre name"},
+					"movies": &graphql.Field{
+						Type:        graphql.NewList(graph.movieType),
+						Description: "Movies in the genre",
+						Resolve:     graph.resolveGenreMovies,
+					},
+				}
+			}),
+		},
+	)
+
+	movieSearchResultType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "MovieSearchResult",
+		Fields: graphql.Fields{
+			"movie": &graphql.Field{
+				Type: graph.movieType,
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					return params.Source.(*response.MovieSearchResultResponse).MovieResponse, nil
+				},
+			},
+			"rank":           &graphql.Field{Type: graphql.Float},
+			"titleHighlight": &graphql.Field{Type: graphql.String},
+			"snippet":        &graphql.Field{Type: graphql.String},
+		},
+	})
+
 	var fields = graphql.Fields{
 		"list": &graphql.Field{
-			Type:        graphql.NewList(movieType),
+			Type:        graphql.NewList(graph.movieType),
 			Description: "Get all movies",
 			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
-				return movies, nil
+				movies, err := graph.movieService.GetAllMovies()
+				if err != nil {
+					return nil, err
+				}
+				return response.ToMovieResponseList(movies), nil
 			},
 		},
 		"search": &graphql.Field{
-			Type:        graphql.NewList(movieType),
+			Type:        graphql.NewList(graph.movieType),
 			Description: "Search movies by title",
 			Args: graphql.FieldConfigArgument{
 				"titleContains": &graphql.ArgumentConfig{Type: graphql.String},
 			},
 			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
-				var searchedList []*response.MovieResponse
 				searchKey, ok := params.Args["titleContains"].(string)
-				if ok {
-					for _, movie := range movies {
-						if strings.Contains(strings.ToLower(movie.Title), strings.ToLower(searchKey)) {
-							searchedList = append(searchedList, movie)
-						}
-					}
+				if !ok {
+					return nil, nil
+				}
+				movies, err := graph.movieService.SearchMoviesByTitle(searchKey)
+				if err != nil {
+					return nil, err
 				}
-				return searchedList, nil
+				return response.ToMovieResponseList(movies), nil
+			},
+		},
+		"fullTextSearch": &graphql.Field{
+			Type:        graphql.NewList(movieSearchResultType),
+			Description: "Rank movies by how well their title and description match the query",
+			Args: graphql.FieldConfigArgument{
+				"query": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				"limit": &graphql.ArgumentConfig{Type: graphql.Int},
+			},
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				limit, _ := params.Args["limit"].(int)
+				results, err := graph.movieService.Search(params.Args["query"].(string), limit)
+				if err != nil {
+					return nil, err
+				}
+				return response.ToMovieSearchResponse(results).Data, nil
 			},
 		},
 		"get": &graphql.Field{
-			Type:        movieType,
+			Type:        graph.movieType,
 			Description: "Get movie by id",
 			Args: graphql.FieldConfigArgument{
 				"id": &graphql.ArgumentConfig{Type: graphql.Int},
 			},
 			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
 				id, ok := params.Args["id"].(int)
-				if ok {
-					for _, movie := range movies {
-						if movie.Id == int64(id) {
-							return movie, nil
-						}
-					}
+				if !ok {
+					return nil, nil
+				}
+				movie, err := graph.movieService.GetMovieById(int64(id))
+				if errors.Is(err, domain.ErrMovieNotFound) {
+					return nil, nil
+				}
+				if err != nil {
+					return nil, err
+				}
+				return response.ToMovieResponse(movie), nil
+			},
+		},
+		"moviesConnection": graph.moviesConnectionField(),
+		"byGenre": &graphql.Field{
+			Type:        graphql.NewList(graph.movieType),
+			Description: "Get movies by genre id",
+			Args: graphql.FieldConfigArgument{
+				"genreId": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+			},
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				genreId := params.Args["genreId"].(int)
+				movies, err := graph.movieService.GetMoviesByGenreId(int64(genreId))
+				if err != nil {
+					return nil, err
+				}
+				return response.ToMovieResponseList(movies), nil
+			},
+		},
+		"genres": &graphql.Field{
+			Type:        graphql.NewList(graph.genreType),
+			Description: "Get all genres",
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				genres, err := graph.movieService.GetAllGenres()
+				if err != nil {
+					return nil, err
 				}
-				return nil, nil
+				return response.ToGenreResponseList(genres), nil
+			},
+		},
+		"genre": &graphql.Field{
+			Type:        graph.genreType,
+			Description: "Get genre by id",
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+			},
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				id := params.Args["id"].(int)
+				genre, err := graph.movieService.GetGenreById(int64(id))
+				if errors.Is(err, domain.ErrGenreNotFound) {
+					return nil, nil
+				}
+				if err != nil {
+					return nil, err
+				}
+				return response.ToGenreResponse(genre), nil
 			},
 		},
 	}
 
 	var mutationFields = graphql.Fields{
 		"addMovie": &graphql.Field{
-			Type:        movieType,
+			Type:        graph.movieType,
 			Description: "Add a new movie",
 			Args: graphql.FieldConfigArgument{
-				"title":        &graphql.ArgumentConfig{Type: graphql.String},
-				"release_date": &graphql.ArgumentConfig{Type: graphql.DateTime},
-				"runtime":      &graphql.ArgumentConfig{Type: graphql.Int},
-				"mpaa_rating":  &graphql.ArgumentConfig{Type: graphql.String},
-				"description":  &graphql.ArgumentConfig{Type: graphql.String},
+				"title":        &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				"release_date": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String), Description: "Release date in YYYY-MM-DD format"},
+				"runtime":      &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+				"mpaa_rating":  &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				"description":  &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
 				"image":        &graphql.ArgumentConfig{Type: graphql.String},
+				"genres":       &graphql.ArgumentConfig{Type: graphql.NewList(graphql.NewNonNull(graphql.Int))},
 			},
-			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
-				newMovie := &response.MovieResponse{
-					Title:       params.Args["title"].(string),
-					ReleaseDate: params.Args["release_date"].(time.Time),
-					Runtime:     params.Args["runtime"].(int64),
-					MPAARating:  params.Args["mpaa_rating"].(string),
-					Description: params.Args["description"].(string),
-					Image:       params.Args["image"].(string),
+			Resolve: graph.requirePermission(domain.PermissionMoviesWrite, func(params graphql.ResolveParams) (interface{}, error) {
+				var movieReq request.AddMovieRequest
+				applyMovieArgs(&movieReq, params.Args)
+
+				movie, err := graph.movieService.AddMovie(movieReq)
+				if err != nil {
+					return nil, err
 				}
-				movies = append(movies, newMovie)
-				return newMovie, nil
-			},
+				return response.ToMovieResponse(movie), nil
+			}),
 		},
 		"updateMovie": &graphql.Field{
-			Type:        movieType,
-			Description: "Update an existing movie",
+			Type:        graph.movieType,
+			Description: "Update an existing movie, only the given fields are changed",
 			Args: graphql.FieldConfigArgument{
-				"id":           &graphql.ArgumentConfig{Type: graphql.Int},
+				"id":           &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
 				"title":        &graphql.ArgumentConfig{Type: graphql.String},
-				"release_date": &graphql.ArgumentConfig{Type: graphql.DateTime},
+				"release_date": &graphql.ArgumentConfig{Type: graphql.String, Description: "Release date in YYYY-MM-DD format"},
 				"runtime":      &graphql.ArgumentConfig{Type: graphql.Int},
 				"mpaa_rating":  &graphql.ArgumentConfig{Type: graphql.String},
 				"description":  &graphql.ArgumentConfig{Type: graphql.String},
 				"image":        &graphql.ArgumentConfig{Type: graphql.String},
+				"genres":       &graphql.ArgumentConfig{Type: graphql.NewList(graphql.NewNonNull(graphql.Int))},
 			},
-			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
-				id := params.Args["id"].(int)
-				for _, movie := range movies {
-					if movie.Id == int64(id) {
-						if title, ok := params.Args["title"].(string); ok {
-							movie.Title = title
-						}
-						if releaseDate, ok := params.Args["release_date"].(time.Time); ok {
-							movie.ReleaseDate = releaseDate
-						}
-						if runtime, ok := params.Args["runtime"].(int); ok {
-							movie.Runtime = int64(runtime)
-						}
-						if mpaaRating, ok := params.Args["mpaa_rating"].(string); ok {
-							movie.MPAARating = mpaaRating
-						}
-						if description, ok := params.Args["description"].(string); ok {
-							movie.Description = description
-						}
-						if image, ok := params.Args["image"].(string); ok {
-							movie.Image = image
-						}
-						return movie, nil
-					}
-				}
-				return nil, nil
-			},
+			Resolve: graph.requirePermission(domain.PermissionMoviesWrite, func(params graphql.ResolveParams) (interface{}, error) {
+				id := int64(params.Args["id"].(int))
+				existing, err := graph.movieService.GetMovieByIdEdit(id)
+				if errors.Is(err, domain.ErrMovieNotFound) {
+					return nil, errors.New("movie not found")
+				}
+				if err != nil {
+					return nil, err
+				}
+
+				movieReq := request.AddMovieRequest{
+					Title:       existing.Title,
+					ReleaseDate: existing.ReleaseDate.Format("2006-01-02"),
+					Runtime:     existing.Runtime,
+					MPAARating:  existing.MPAARating,
+					Description: existing.Description,
+					Image:       existing.Image,
+				}
+				for _, genreId := range existing.GenresIntArray {
+					movieReq.Genres = append(movieReq.Genres, int(genreId))
+				}
+				applyMovieArgs(&movieReq, params.Args)
+
+				movie, err := graph.movieService.UpdateMovie(id, movieReq)
+				if err != nil {
+					return nil, err
+				}
+				return response.ToMovieResponse(movie), nil
+			}),
 		},
 		"deleteMovie": &graphql.Field{
 			Type:        graphql.Boolean,
 			Description: "Delete a movie by id",
 			Args: graphql.FieldConfigArgument{
-				"id": &graphql.ArgumentConfig{Type: graphql.Int},
+				"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
 			},
-			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+			Resolve: graph.requirePermission(domain.PermissionMoviesDelete, func(params graphql.ResolveParams) (interface{}, error) {
 				id := params.Args["id"].(int)
-				for i, movie := range movies {
-					if movie.Id == int64(id) {
-						movies = append(movies[:i], movies[i+1:]...)
-						return true, nil
-					}
+				if err := graph.movieService.DeleteMovie(int64(id)); err != nil {
+					return false, err
 				}
-				return false, nil
-			},
+				return true, nil
+			}),
 		},
 	}
 
-	return &Graph{
-		Movies:    movies,
-		fields:    fields,
-		movieType: movieType,
-		Config: graphql.SchemaConfig{
-			Query:    graphql.NewObject(graphql.ObjectConfig{Name: "Query", Fields: fields}),
-			Mutation: graphql.NewObject(graphql.ObjectConfig{Name: "Mutation", Fields: mutationFields}),
-		},
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query:    graphql.NewObject(graphql.ObjectConfig{Name: "Query", Fields: fields}),
+		Mutation: graphql.NewObject(graphql.ObjectConfig{Name: "Mutation", Fields: mutationFields}),
+	})
+	if err != nil {
+		return nil, err
+	}
+	graph.Schema = schema
+
+	return graph, nil
+}
+
+// requirePermission rejects the resolver call unless the request was
+// authenticated by the auth middleware with a role granting permission.
+func (graph *Graph) requirePermission(permission domain.Permission, resolve graphql.FieldResolveFn) graphql.FieldResolveFn {
+	return func(params graphql.ResolveParams) (interface{}, error) {
+		err := graph.auth.Authorize(middleware.ClaimsFromContext(params.Context), permission)
+		switch {
+		case errors.Is(err, middleware.ErrMissingToken):
+			return nil, errUnauthorized
+		case errors.Is(err, domain.ErrEmailNotVerified):
+			return nil, errEmailNotVerified
+		case errors.Is(err, domain.ErrMfaRequired):
+			return nil, errMfaRequired
+		case errors.Is(err, middleware.ErrInsufficientScope):
+			return nil, errInsufficientScope
+		case err != nil:
+			return nil, errForbidden
+		}
+		return resolve(params)
+	}
+}
+
+func applyMovieArgs(movieReq *request.AddMovieRequest, args map[string]interface{}) {
+	if title, ok := args["title"].(string); ok {
+		movieReq.Title = title
+	}
+	if releaseDate, ok := args["release_date"].(string); ok {
+		movieReq.ReleaseDate = releaseDate
+	}
+	if runtime, ok := args["runtime"].(int); ok {
+		movieReq.Runtime = int64(runtime)
+	}
+	if mpaaRating, ok := args["mpaa_rating"].(string); ok {
+		movieReq.MPAARating = mpaaRating
+	}
+	if description, ok := args["description"].(string); ok {
+		movieReq.Description = description
+	}
+	if image, ok := args["image"].(string); ok {
+		movieReq.Image = image
+	}
+	if genres, ok := args["genres"].([]interface{}); ok {
+		movieReq.Genres = make([]int, 0, len(genres))
+		for _, genre := range genres {
+			movieReq.Genres = append(movieReq.Genres, genre.(int))
+		}
+	}
+}
+
+func (graph *Graph) resolveMovieGenres(params graphql.ResolveParams) (interface{}, error) {
+	movie, ok := params.Source.(*response.MovieResponse)
+	if !ok {
+		return nil, nil
+	}
+	if movie.Genres != nil {
+		return response.ToGenreResponseList(movie.Genres), nil
+	}
+
+	requestLoaders := loadersFromContext(params.Context)
+	if requestLoaders == nil {
+		genres, err := graph.movieService.GetGenresByMovieId(movie.Id)
+		if err != nil {
+			return nil, err
+		}
+		return response.ToGenreResponseList(genres), nil
+	}
+
+	load := requestLoaders.genresByMovieId.Load(movie.Id)
+	return func() (interface{}, error) {
+		genres, err := load()
+		if err != nil {
+			return nil, err
+		}
+		return response.ToGenreResponseList(genres), nil
+	}, nil
+}
+
+func (graph *Graph) resolveGenreMovies(params graphql.ResolveParams) (interface{}, error) {
+	genre, ok := params.Source.(*response.GenreResponse)
+	if !ok {
+		return nil, nil
+	}
+
+	requestLoaders := loadersFromContext(params.Context)
+	if requestLoaders == nil {
+		movies, err := graph.movieService.GetMoviesByGenreId(genre.Id)
+		if err != nil {
+			return nil, err
+		}
+		return response.ToMovieResponseList(movies), nil
+	}
+
+	load := requestLoaders.moviesByGenreId.Load(genre.Id)
+	return func() (interface{}, error) {
+		movies, err := load()
+		if err != nil {
+			return nil, err
+		}
+		return response.ToMovieResponseList(movies), nil
+	}, nil
+}
+
+// RequestError is returned by Execute when a request is rejected before any
+// resolver runs, e.g. because it doesn't parse or fails validation.
+type RequestError struct {
+	StatusCode int
+	Errors     []gqlerrors.FormattedError
+}
+
+func (requestError *RequestError) Error() string {
+	if len(requestError.Errors) == 0 {
+		return "invalid graphql request"
+	}
+	return requestError.Errors[0].Message
+}
+
+func NewRequestError(statusCode int, message string) *RequestError {
+	return &RequestError{
+		StatusCode: statusCode,
+		Errors:     []gqlerrors.FormattedError{gqlerrors.NewFormattedError(message)},
 	}
 }
 
-func (graph *Graph) Query() (*graphql.Result, error) {
-	rootQuery := graphql.ObjectConfig{Name: "RootQuery", Fields: graph.fields}
-	schemaConfig := graphql.SchemaConfig{Query: graphql.NewObject(rootQuery)}
-	schema, err := graphql.NewSchema(schemaConfig)
+// Execute parses, validates and executes a GraphQL request. Errors raised by
+// resolvers are part of the returned result alongside any partial data; a
+// *RequestError is returned when the request can't be executed at all.
+// Mutations are rejected unless allowMutations is set, which lets GET requests
+// stay safe to cache.
+func (graph *Graph) Execute(ctx context.Context, graphqlRequest *request.GraphqlRequest, allowMutations bool) (*graphql.Result, error) {
+	if graph.persistedQueries != nil {
+		if err := graph.persistedQueries.Resolve(graphqlRequest); err != nil {
+			return nil, err
+		}
+	}
+
+	if graphqlRequest.Query == "" {
+		return nil, NewRequestError(http.StatusBadRequest, "Must provide query string.")
+	}
+
+	document, err := parser.Parse(parser.ParseParams{
+		Source: source.NewSource(&source.Source{Body: []byte(graphqlRequest.Query), Name: "GraphQL request"}),
+	})
+	if err != nil {
+		return nil, &RequestError{StatusCode: http.StatusBadRequest, Errors: gqlerrors.FormatErrors(err)}
+	}
+
+	validationResult := graphql.ValidateDocument(&graph.Schema, document, nil)
+	if !validationResult.IsValid {
+		return nil, &RequestError{StatusCode: http.StatusBadRequest, Errors: validationResult.Errors}
+	}
+
+	operation, err := selectOperation(document, graphqlRequest.OperationName)
 	if err != nil {
+		return nil, NewRequestError(http.StatusBadRequest, err.Error())
+	}
+
+	if operation.Operation == ast.OperationTypeMutation && !allowMutations {
+		return nil, NewRequestError(http.StatusMethodNotAllowed, "Mutations can only be sent with POST requests.")
+	}
+
+	if err = graph.checkLimits(document, operation, graphqlRequest.Variables); err != nil {
 		return nil, err
 	}
 
-	params := graphql.Params{Schema: schema, RequestString: graph.QueryString}
-	resp := graphql.Do(params)
-	if len(resp.Errors) > 0 {
-		return nil, errors.New("error executing query")
+	result := graphql.Execute(graphql.ExecuteParams{
+		Schema:        graph.Schema,
+		AST:           document,
+		OperationName: graphqlRequest.OperationName,
+		Args:          graphqlRequest.Variables,
+		Context:       contextWithLoaders(ctx, graph.movieService),
+	})
+
+	// Execution only returns no data at all when the variables couldn't be coerced.
+	if result.Data == nil && result.HasErrors() {
+		return nil, &RequestError{StatusCode: http.StatusBadRequest, Errors: result.Errors}
+	}
+
+	return result, nil
+}
+
+func selectOperation(document *ast.Document, operationName string) (*ast.OperationDefinition, error) {
+	var operations []*ast.OperationDefinition
+	for _, definition := range document.Definitions {
+		if operation, ok := definition.(*ast.OperationDefinition); ok {
+			operations = append(operations, operation)
+		}
+	}
+
+	if operationName == "" {
+		if len(operations) != 1 {
+			return nil, errors.New("Must provide operation name if query contains multiple operations.")
+		}
+		return operations[0], nil
+	}
+
+	for _, operation := range operations {
+		if operation.Name != nil && operation.Name.Value == operationName {
+			return operation, nil
+		}
 	}
 
-	return resp, nil
+	return nil, errors.New(`Unknown operation named "` + operationName + `".`)
 }
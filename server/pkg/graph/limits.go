@@ -0,0 +1,245 @@
+package graph
+
+import (
+	"fmt"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Limits bounds how expensive a single operation may be. A zero value
+// disables the corresponding check.
+type Limits struct {
+	MaxDepth      int
+	MaxComplexity int
+	MaxAliases    int
+	// DefaultListSize is the multiplier used for list fields whose size
+	// can't be read from a limiting argument such as first or limit.
+	DefaultListSize int
+}
+
+// fieldCosts overrides the default cost of 1 for fields that hit the
+// database on their own, keyed by "<Type>.<field>".
+var fieldCosts = map[string]int{
+	"Query.list":                 5,
+	"Query.search":               5,
+	"Query.fullTextSearch":       10,
+	"Query.byGenre":              5,
+	"Query.moviesConnection":     5,
+	"Query.get":                  2,
+	"Query.genre":                2,
+	"Movie.genres":               2,
+	"Genre.movies":               5,
+	"MovieConnection.totalCount": 5,
+	"MovieConnection.facets":     20,
+}
+
+// listSizeArguments are the arguments that bound how many items a list field returns.
+var listSizeArguments = []string{"first", "last", "limit"}
+
+// connectionListFields are the fields of a *Connection type that return one
+// item per page entry, so they cost as many times as the connection's page
+// size allows.
+var connectionListFields = map[string]bool{"edges": true, "nodes": true}
+
+type operationCost struct {
+	depth      int
+	complexity int
+	aliases    int
+}
+
+type costAnalyzer struct {
+	schema    *graphql.Schema
+	limits    Limits
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+}
+
+// checkLimits walks the operation that is about to run and rejects it when it
+// exceeds any of the configured limits.
+func (graph *Graph) checkLimits(document *ast.Document, operation *ast.OperationDefinition, variables map[string]interface{}) error {
+	limits := graph.limits
+	if limits.MaxDepth <= 0 && limits.MaxComplexity <= 0 && limits.MaxAliases <= 0 {
+		return nil
+	}
+
+	analyzer := &costAnalyzer{
+		schema:    &graph.Schema,
+		limits:    limits,
+		fragments: make(map[string]*ast.FragmentDefinition),
+		variables: variables,
+	}
+	for _, definition := range document.Definitions {
+		if fragment, ok := definition.(*ast.FragmentDefinition); ok {
+			analyzer.fragments[fragment.Name.Value] = fragment
+		}
+	}
+
+	var rootType graphql.Type = graph.Schema.QueryType()
+	if operation.Operation == ast.OperationTypeMutation {
+		rootType = graph.Schema.MutationType()
+	}
+
+	cost := analyzer.selectionSetCost(operation.SelectionSet, rootType, 1, 0)
+
+	switch {
+	case limits.MaxDepth > 0 && cost.depth > limits.MaxDepth:
+		return newLimitError("QUERY_TOO_DEEP", "Query depth", cost.depth, limits.MaxDepth)
+	case limits.MaxComplexity > 0 && cost.complexity > limits.MaxComplexity:
+		return newLimitError("QUERY_TOO_COMPLEX", "Query complexity", cost.complexity, limits.MaxComplexity)
+	case limits.MaxAliases > 0 && cost.aliases > limits.MaxAliases:
+		return newLimitError("TOO_MANY_ALIASES", "Number of aliases", cost.aliases, limits.MaxAliases)
+	}
+
+	return nil
+}
+
+// selectionSetCost adds up the cost of a selection set. pageSize is the page
+// size of the connection parentType belongs to, or 0 outside of connections.
+func (analyzer *costAnalyzer) selectionSetCost(selectionSet *ast.SelectionSet, parentType graphql.Type, depth int, pageSize int) operationCost {
+	var total operationCost
+	if selectionSet == nil {
+		return total
+	}
+
+	for _, selection := range selectionSet.Selections {
+		var cost operationCost
+
+		switch selection := selection.(type) {
+		case *ast.Field:
+			cost = analyzer.fieldCost(selection, parentType, depth, pageSize)
+		case *ast.InlineFragment:
+			fragmentType := parentType
+			if selection.TypeCondition != nil {
+				fragmentType = analyzer.schema.Type(selection.TypeCondition.Name.Value)
+			}
+			cost = analyzer.selectionSetCost(selection.SelectionSet, fragmentType, depth, pageSize)
+		case *ast.FragmentSpread:
+			fragment, ok := analyzer.fragments[selection.Name.Value]
+			if !ok {
+				continue
+			}
+			cost = analyzer.selectionSetCost(fragment.SelectionSet, analyzer.schema.Type(fragment.TypeCondition.Name.Value), depth, pageSize)
+		}
+
+		total.depth = max(total.depth, cost.depth)
+		total.complexity += cost.complexity
+		total.aliases += cost.aliases
+	}
+
+	return total
+}
+
+func (analyzer *costAnalyzer) fieldCost(field *ast.Field, parentType graphql.Type, depth int, pageSize int) operationCost {
+	fieldName := field.Name.Value
+
+	// Introspection is bounded by the size of the schema, so it doesn't count.
+	if strings.HasPrefix(fieldName, "__") {
+		return operationCost{}
+	}
+
+	cost := operationCost{depth: depth, complexity: 1}
+	if field.Alias != nil {
+		cost.aliases = 1
+	}
+
+	definition := fieldDefinition(parentType, fieldName)
+	if definition == nil {
+		return cost
+	}
+
+	if fieldCost, ok := fieldCosts[parentType.Name()+"."+fieldName]; ok {
+		cost.complexity = fieldCost
+	}
+
+	if field.SelectionSet != nil {
+		childType, _ := graphql.GetNamed(definition.Type).(graphql.Type)
+
+		// A connection's first or last argument bounds its edges and nodes.
+		childPageSize := 0
+		if childType != nil && strings.HasSuffix(childType.Name(), "Connection") {
+			childPageSize = analyzer.listSize(field)
+		}
+		childCost := analyzer.selectionSetCost(field.SelectionSet, childType, depth+1, childPageSize)
+
+		multiplier := 1
+		if isListType(definition.Type) {
+			if pageSize > 0 && connectionListFields[fieldName] {
+				multiplier = pageSize
+			} else {
+				multiplier = analyzer.listSize(field)
+			}
+		}
+
+		cost.depth = max(cost.depth, childCost.depth)
+		cost.complexity += multiplier * childCost.complexity
+		cost.aliases += childCost.aliases
+	}
+
+	return cost
+}
+
+func (analyzer *costAnalyzer) listSize(field *ast.Field) int {
+	for _, argument := range field.Arguments {
+		for _, name := range listSizeArguments {
+			if argument.Name.Value != name {
+				continue
+			}
+			if size, ok := analyzer.intValue(argument.Value); ok && size > 0 {
+				return size
+			}
+		}
+	}
+
+	if analyzer.limits.DefaultListSize > 0 {
+		return analyzer.limits.DefaultListSize
+	}
+	return 1
+}
+
+func (analyzer *costAnalyzer) intValue(value ast.Value) (int, bool) {
+	switch value := value.(type) {
+	case *ast.IntValue:
+		size, err := strconv.Atoi(value.Value)
+		return size, err == nil
+	case *ast.Variable:
+		switch variable := analyzer.variables[value.Name.Value].(type) {
+		case int:
+			return variable, true
+		case float64:
+			return int(variable), true
+		}
+	}
+	return 0, false
+}
+
+func fieldDefinition(parentType graphql.Type, fieldName string) *graphql.FieldDefinition {
+	switch parentType := parentType.(type) {
+	case *graphql.Object:
+		return parentType.Fields()[fieldName]
+	case *graphql.Interface:
+		return parentType.Fields()[fieldName]
+	}
+	return nil
+}
+
+func isListType(fieldType graphql.Type) bool {
+	if nonNull, ok := fieldType.(*graphql.NonNull); ok {
+		fieldType = nonNull.OfType
+	}
+	_, ok := fieldType.(*graphql.List)
+	return ok
+}
+
+func newLimitError(code string, subject string, actual int, limit int) *RequestError {
+	formattedError := gqlerrors.NewFormattedError(fmt.Sprintf("%s of %d exceeds the maximum of %d.", subject, actual, limit))
+	formattedError.Extensions = map[string]interface{}{
+		"code":   code,
+		"actual": actual,
+		"limit":  limit,
+	}
+	return &RequestError{StatusCode: http.StatusBadRequest, Errors: []gqlerrors.FormattedError{formattedError}}
+}
@@ -0,0 +1,72 @@
+package graph
+
+import (
+	"errors"
+	"github.com/graphql-go/graphql/language/parser"
+	"testing"
+)
+
+func checkQueryLimits(t *testing.T, limits Limits, query string, variables map[string]interface{}) error {
+	t.Helper()
+
+	graph, err := New(nil, nil, limits, nil)
+	if err != nil {
+		t.Fatalf("building the schema failed: %v", err)
+	}
+
+	document, err := parser.Parse(parser.ParseParams{Source: query})
+	if err != nil {
+		t.Fatalf("parsing %q failed: %v", query, err)
+	}
+	operation, err := selectOperation(document, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return graph.checkLimits(document, operation, variables)
+}
+
+func TestConnectionPageSizeMultipliesEdgesAndNodes(t *testing.T) {
+	limits := Limits{MaxComplexity: 1000, DefaultListSize: 20}
+
+	// moviesConnection costs 5 and edges or nodes 1, plus per item node 1,
+	// genres 2 and 20 genres of 1.
+	tests := []struct {
+		name       string
+		query      string
+		variables  map[string]interface{}
+		complexity int
+	}{
+		{"default page", `{ moviesConnection { edges { node { genres { genre } } } } }`, nil, 5 + 1 + 20*23},
+		{"first", `{ moviesConnection(first: 1) { edges { node { genres { genre } } } } }`, nil, 5 + 1 + 23},
+		{"first 100", `{ moviesConnection(first: 100) { edges { node { genres { genre } } } } }`, nil, 5 + 1 + 100*23},
+		{"last from variable", `query($last: Int) { moviesConnection(last: $last) { nodes { genres { genre } } } }`, map[string]interface{}{"last": 100}, 5 + 1 + 100*22},
+		{"fragment", `{ moviesConnection(first: 50) { ...page } } fragment page on MovieConnection { nodes { id } }`, nil, 5 + 1 + 50*1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cost := complexityOf(t, test.query, test.variables)
+			if cost != test.complexity {
+				t.Errorf("complexity = %d, want %d", cost, test.complexity)
+			}
+
+			err := checkQueryLimits(t, limits, test.query, test.variables)
+			if exceeds := test.complexity > limits.MaxComplexity; exceeds != (err != nil) {
+				t.Errorf("checkLimits() = %v, want an error: %t", err, exceeds)
+			}
+		})
+	}
+}
+
+// complexityOf reads the complexity of query from the error of a limit it
+// can't meet.
+func complexityOf(t *testing.T, query string, variables map[string]interface{}) int {
+	t.Helper()
+
+	err := checkQueryLimits(t, Limits{MaxComplexity: 1, DefaultListSize: 20}, query, variables)
+	var requestError *RequestError
+	if !errors.As(err, &requestError) {
+		t.Fatalf("checkLimits() = %v, want a *RequestError", err)
+	}
+	return requestError.Errors[0].Extensions["actual"].(int)
+}
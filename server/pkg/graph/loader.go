@@ -0,0 +1,91 @@
+package graph
+
+import (
+	"context"
+	"github.com/erkindilekci/cinebase/server/pkg/domain"
+	"github.com/erkindilekci/cinebase/server/pkg/service"
+	"slices"
+	"sync"
+)
+
+type loadersContextKey struct{}
+
+// batchLoader collects the keys requested while a level of the query is being
+// resolved and fetches them with a single call once the first result is needed.
+// Results are cached for the lifetime of the request.
+type batchLoader[V any] struct {
+	mu      sync.Mutex
+	fetch   func(keys []int64) (map[int64]V, error)
+	pending []int64
+	// queued holds the pending keys, so a key is fetched once however often
+	// it is loaded.
+	queued map[int64]struct{}
+	cache  map[int64]V
+}
+
+func newBatchLoader[V any](fetch func(keys []int64) (map[int64]V, error)) *batchLoader[V] {
+	return &batchLoader[V]{fetch: fetch, queued: make(map[int64]struct{}), cache: make(map[int64]V)}
+}
+
+// Load queues key and returns a thunk that graphql-go resolves after every
+// sibling field has had the chance to queue its own key.
+func (loader *batchLoader[V]) Load(key int64) func() (V, error) {
+	loader.mu.Lock()
+	_, cached := loader.cache[key]
+	_, queued := loader.queued[key]
+	if !cached && !queued {
+		loader.pending = append(loader.pending, key)
+		loader.queued[key] = struct{}{}
+	}
+	loader.mu.Unlock()
+
+	return func() (V, error) {
+		loader.mu.Lock()
+		defer loader.mu.Unlock()
+
+		if value, ok := loader.cache[key]; ok {
+			return value, nil
+		}
+
+		keys := loader.pending
+		loader.pending = nil
+		clear(loader.queued)
+		if !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+
+		values, err := loader.fetch(keys)
+		if err != nil {
+			var zero V
+			return zero, err
+		}
+
+		// Keys without rows are cached too so they aren't fetched again.
+		for _, pendingKey := range keys {
+			loader.cache[pendingKey] = values[pendingKey]
+		}
+
+		return loader.cache[key], nil
+	}
+}
+
+type loaders struct {
+	genresByMovieId *batchLoader[[]*domain.Genre]
+	moviesByGenreId *batchLoader[[]*domain.Movie]
+}
+
+func newLoaders(movieService service.IMovieService) *loaders {
+	return &loaders{
+		genresByMovieId: newBatchLoader(movieService.GetGenresByMovieIds),
+		moviesByGenreId: newBatchLoader(movieService.GetMoviesByGenreIds),
+	}
+}
+
+func contextWithLoaders(ctx context.Context, movieService service.IMovieService) context.Context {
+	return context.WithValue(ctx, loadersContextKey{}, newLoaders(movieService))
+}
+
+func loadersFromContext(ctx context.Context) *loaders {
+	requestLoaders, _ := ctx.Value(loadersContextKey{}).(*loaders)
+	return requestLoaders
+}
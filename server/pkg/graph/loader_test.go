@@ -0,0 +1,146 @@
+package graph
+
+import (
+	"context"
+	"github.com/erkindilekci/cinebase/server/pkg/controller/request"
+	"github.com/erkindilekci/cinebase/server/pkg/domain"
+	"github.com/erkindilekci/cinebase/server/pkg/service"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// countingMovieService serves a fixed set of movies and records the batches
+// genres are fetched in. Methods the tests don't need panic through the nil
+// embedded interface.
+type countingMovieService struct {
+	service.IMovieService
+
+	movies []*domain.Movie
+	genres map[int64][]*domain.Genre
+
+	mu           sync.Mutex
+	genreBatches [][]int64
+}
+
+func (movieService *countingMovieService) GetAllMovies() ([]*domain.Movie, error) {
+	return movieService.movies, nil
+}
+
+func (movieService *countingMovieService) GetMovieById(id int64) (*domain.Movie, error) {
+	for _, movie := range movieService.movies {
+		if movie.Id == id {
+			return movie, nil
+		}
+	}
+	return nil, domain.ErrMovieNotFound
+}
+
+func (movieService *countingMovieService) GetGenresByMovieIds(movieIds []int64) (map[int64][]*domain.Genre, error) {
+	movieService.mu.Lock()
+	movieService.genreBatches = append(movieService.genreBatches, slices.Clone(movieIds))
+	movieService.mu.Unlock()
+
+	genres := make(map[int64][]*domain.Genre)
+	for _, id := range movieIds {
+		genres[id] = movieService.genres[id]
+	}
+	return genres, nil
+}
+
+func (movieService *countingMovieService) GetMoviesByGenreIds(genreIds []int64) (map[int64][]*domain.Movie, error) {
+	movies := make(map[int64][]*domain.Movie)
+	for _, movie := range movieService.movies {
+		for _, genre := range movieService.genres[movie.Id] {
+			if slices.Contains(genreIds, genre.Id) {
+				movies[genre.Id] = append(movies[genre.Id], movie)
+			}
+		}
+	}
+	return movies, nil
+}
+
+func (movieService *countingMovieService) GetGenresByMovieId(int64) ([]*domain.Genre, error) {
+	panic("genres must be loaded in batches")
+}
+
+func newCountingMovieService() *countingMovieService {
+	drama := &domain.Genre{Id: 1, Genre: "Drama"}
+	comedy := &domain.Genre{Id: 2, Genre: "Comedy"}
+	return &countingMovieService{
+		movies: []*domain.Movie{{Id: 10, Title: "A"}, {Id: 20, Title: "B"}, {Id: 30, Title: "C"}},
+		genres: map[int64][]*domain.Genre{10: {drama}, 20: {drama, comedy}},
+	}
+}
+
+func executeQuery(t *testing.T, movieService service.IMovieService, query string) map[string]interface{} {
+	t.Helper()
+
+	graph, err := New(movieService, nil, Limits{}, nil)
+	if err != nil {
+		t.Fatalf("building the schema failed: %v", err)
+	}
+
+	result, err := graph.Execute(context.Background(), &request.GraphqlRequest{Query: query}, false)
+	if err != nil {
+		t.Fatalf("executing %q failed: %v", query, err)
+	}
+	if result.HasErrors() {
+		t.Fatalf("executing %q returned errors: %v", query, result.Errors)
+	}
+	return result.Data.(map[string]interface{})
+}
+
+func TestListLoadsGenresInOneBatch(t *testing.T) {
+	movieService := newCountingMovieService()
+
+	data := executeQuery(t, movieService, `{ list { id genres { genre } } }`)
+
+	if len(movieService.genreBatches) != 1 {
+		t.Fatalf("GetGenresByMovieIds was called %d times, want 1: %v", len(movieService.genreBatches), movieService.genreBatches)
+	}
+	batch := slices.Sorted(slices.Values(movieService.genreBatches[0]))
+	if !slices.Equal(batch, []int64{10, 20, 30}) {
+		t.Errorf("GetGenresByMovieIds(%v), want the ids of every listed movie", batch)
+	}
+
+	movies := data["list"].([]interface{})
+	wantGenreCounts := []int{1, 2, 0}
+	for i, movie := range movies {
+		genres, _ := movie.(map[string]interface{})["genres"].([]interface{})
+		if len(genres) != wantGenreCounts[i] {
+			t.Errorf("movie %d has %d genres, want %d", i, len(genres), wantGenreCounts[i])
+		}
+	}
+}
+
+func TestRepeatedMovieIsServedFromTheRequestCache(t *testing.T) {
+	movieService := newCountingMovieService()
+	// The same movie twice in one list and again under aliases.
+	movieService.movies = append(movieService.movies, movieService.movies[0])
+
+	executeQuery(t, movieService, `{
+		list { id genres { genre } }
+		first: get(id: 10) { genres { genre } }
+		again: get(id: 10) { genres { genre } }
+	}`)
+
+	if len(movieService.genreBatches) != 1 {
+		t.Fatalf("GetGenresByMovieIds was called %d times, want 1: %v", len(movieService.genreBatches), movieService.genreBatches)
+	}
+	batch := slices.Sorted(slices.Values(movieService.genreBatches[0]))
+	if !slices.Equal(batch, []int64{10, 20, 30}) {
+		t.Errorf("GetGenresByMovieIds(%v), want every movie exactly once", batch)
+	}
+}
+
+func TestGenresLoadedAtAnEarlierLevelAreNotFetchedAgain(t *testing.T) {
+	movieService := newCountingMovieService()
+
+	// The movies of each genre are movies whose genres were already loaded.
+	executeQuery(t, movieService, `{ list { id genres { movies { id genres { genre } } } } }`)
+
+	if len(movieService.genreBatches) != 1 {
+		t.Errorf("GetGenresByMovieIds was called %d times, want 1: %v", len(movieService.genreBatches), movieService.genreBatches)
+	}
+}
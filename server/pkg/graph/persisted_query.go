@@ -0,0 +1,184 @@
+package graph
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/erkindilekci/cinebase/server/pkg/controller/request"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+type PersistedQueryConfig struct {
+	// Enabled turns on automatic persisted queries: clients may register a
+	// document once and afterwards send only its sha256 hash.
+	Enabled bool
+	// CacheSize caps the number of automatically registered documents.
+	CacheSize int
+	// AllowListFile points to a JSON object mapping sha256 hashes to documents.
+	AllowListFile string
+	// Strict refuses every document that isn't on the allow-list.
+	Strict bool
+}
+
+// PersistedQueries resolves the query document of requests that use the
+// Apollo automatic persisted queries protocol and enforces the allow-list.
+type PersistedQueries struct {
+	mu        sync.RWMutex
+	config    PersistedQueryConfig
+	allowList map[string]string
+	queries   map[string]string
+	order     []string
+}
+
+func NewPersistedQueries(config PersistedQueryConfig) (*PersistedQueries, error) {
+	persistedQueries := &PersistedQueries{
+		config:    config,
+		allowList: make(map[string]string),
+		queries:   make(map[string]string),
+	}
+
+	if config.AllowListFile != "" {
+		allowList, err := loadAllowList(config.AllowListFile)
+		if err != nil {
+			return nil, err
+		}
+		persistedQueries.allowList = allowList
+	} else if config.Strict {
+		return nil, fmt.Errorf("strict persisted query mode requires an allow-list file")
+	}
+
+	return persistedQueries, nil
+}
+
+// Resolve fills in the query of graphqlRequest from its persisted query hash
+// and registers newly sent documents, rejecting anything the allow-list forbids.
+func (persistedQueries *PersistedQueries) Resolve(graphqlRequest *request.GraphqlRequest) error {
+	hash, hasHash, err := persistedQueryHash(graphqlRequest)
+	if err != nil {
+		return err
+	}
+
+	if hasHash && graphqlRequest.Query == "" {
+		query, ok := persistedQueries.lookup(hash)
+		if !ok {
+			return newPersistedQueryError(http.StatusOK, "PERSISTED_QUERY_NOT_FOUND", "PersistedQueryNotFound")
+		}
+		graphqlRequest.Query = query
+		return nil
+	}
+
+	if graphqlRequest.Query == "" {
+		return nil
+	}
+
+	queryHash := hashQuery(graphqlRequest.Query)
+	if hasHash && hash != queryHash {
+		return newPersistedQueryError(http.StatusBadRequest, "PERSISTED_QUERY_HASH_MISMATCH", "provided sha does not match query")
+	}
+
+	if persistedQueries.config.Strict {
+		if _, ok := persistedQueries.allowList[queryHash]; !ok {
+			return newPersistedQueryError(http.StatusForbidden, "OPERATION_NOT_ALLOWED", "Operation is not on the allow-list.")
+		}
+		return nil
+	}
+
+	if hasHash {
+		persistedQueries.store(queryHash, graphqlRequest.Query)
+	}
+	return nil
+}
+
+func (persistedQueries *PersistedQueries) lookup(hash string) (string, bool) {
+	if query, ok := persistedQueries.allowList[hash]; ok {
+		return query, true
+	}
+	if persistedQueries.config.Strict || !persistedQueries.config.Enabled {
+		return "", false
+	}
+
+	persistedQueries.mu.RLock()
+	defer persistedQueries.mu.RUnlock()
+
+	query, ok := persistedQueries.queries[hash]
+	return query, ok
+}
+
+func (persistedQueries *PersistedQueries) store(hash string, query string) {
+	if !persistedQueries.config.Enabled {
+		return
+	}
+
+	persistedQueries.mu.Lock()
+	defer persistedQueries.mu.Unlock()
+
+	if _, ok := persistedQueries.queries[hash]; ok {
+		return
+	}
+
+	// Evict the oldest registrations first once the cache is full.
+	if persistedQueries.config.CacheSize > 0 && len(persistedQueries.order) >= persistedQueries.config.CacheSize {
+		oldest := persistedQueries.order[0]
+		persistedQueries.order = persistedQueries.order[1:]
+		delete(persistedQueries.queries, oldest)
+	}
+
+	persistedQueries.queries[hash] = query
+	persistedQueries.order = append(persistedQueries.order, hash)
+}
+
+func persistedQueryHash(graphqlRequest *request.GraphqlRequest) (string, bool, error) {
+	persistedQuery, ok := graphqlRequest.Extensions["persistedQuery"].(map[string]interface{})
+	if !ok {
+		return "", false, nil
+	}
+
+	if version, _ := persistedQuery["version"].(float64); version != 1 {
+		return "", false, newPersistedQueryError(http.StatusBadRequest, "PERSISTED_QUERY_NOT_SUPPORTED", "Unsupported persisted query version.")
+	}
+
+	hash, _ := persistedQuery["sha256Hash"].(string)
+	if hash == "" {
+		return "", false, newPersistedQueryError(http.StatusBadRequest, "PERSISTED_QUERY_NOT_SUPPORTED", "Persisted query is missing sha256Hash.")
+	}
+
+	return strings.ToLower(hash), true, nil
+}
+
+func loadAllowList(path string) (map[string]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading graphql allow-list: %w", err)
+	}
+
+	var documents map[string]string
+	if err = json.Unmarshal(content, &documents); err != nil {
+		return nil, fmt.Errorf("error while parsing graphql allow-list: %w", err)
+	}
+
+	allowList := make(map[string]string, len(documents))
+	for hash, query := range documents {
+		if hashQuery(query) != strings.ToLower(hash) {
+			return nil, fmt.Errorf("graphql allow-list entry %s doesn't match the sha256 of its document", hash)
+		}
+		allowList[strings.ToLower(hash)] = query
+	}
+
+	return allowList, nil
+}
+
+func hashQuery(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:])
+}
+
+func newPersistedQueryError(statusCode int, code string, message string) *RequestError {
+	formattedError := gqlerrors.NewFormattedError(message)
+	formattedError.Extensions = map[string]interface{}{"code": code}
+	return &RequestError{StatusCode: statusCode, Errors: []gqlerrors.FormattedError{formattedError}}
+}
@@ -1,37 +1,245 @@
 package middleware
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/erkindilekci/cinebase/server/pkg/commmon/signing"
 	"github.com/erkindilekci/cinebase/server/pkg/domain"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
 	"net/http"
-	"os"
+	"slices"
 	"strings"
+	"time"
 )
 
-func CheckAuthorizationHeader(next echo.HandlerFunc) echo.HandlerFunc {
-	return func(c echo.Context) error {
-		authHeader := c.Request().Header.Get("Authorization")
-		if authHeader == "" {
-			return c.JSON(http.StatusUnauthorized, map[string]string{"message": "missing or invalid token"})
+type claimsContextKey struct{}
+
+// RevocationChecker tells whether the access token with the given jti was
+// revoked before it expired, e.g. by logging out.
+type RevocationChecker interface {
+	IsTokenRevoked(jti string) (bool, error)
+}
+
+// ApiKeyAuthenticator returns the claims of the owner of an API key, failing
+// with domain.ErrInvalidApiKey for keys that don't work.
+type ApiKeyAuthenticator interface {
+	AuthenticateApiKey(key string) (*domain.Claims, error)
+}
+
+// ApiKeyHeader is the header API keys can be sent in, besides
+// "Authorization: ApiKey <key>".
+const ApiKeyHeader = "X-API-Key"
+
+type TokenValidation struct {
+	// Issuer and Audience are the iss and aud claims tokens must carry.
+	Issuer   string
+	Audience string
+	// Algorithms lists the signing algorithms accepted, by default those of
+	// the keys in the key set.
+	Algorithms []string
+	// Leeway tolerates clock skew when checking exp, nbf and iat.
+	Leeway time.Duration
+}
+
+// Auth authenticates requests by their bearer token or API key.
+type Auth struct {
+	keySet      *signing.KeySet
+	validation  TokenValidation
+	parser      *jwt.Parser
+	revocations RevocationChecker
+	apiKeys     ApiKeyAuthenticator
+	policy      AccessPolicy
+}
+
+// AccessPolicy holds back the permissions of a role until the account meets
+// further conditions.
+type AccessPolicy struct {
+	// Verification decides whether unverified accounts get their permissions.
+	Verification domain.VerificationPolicy
+	// RequireMfaForPrivilegedRoles withholds the permissions of privileged
+	// roles from sessions that weren't started with a second factor.
+	RequireMfaForPrivilegedRoles bool
+}
+
+func NewAuth(keySet *signing.KeySet, validation TokenValidation, policy AccessPolicy, revocations RevocationChecker, apiKeys ApiKeyAuthenticator) (*Auth, error) {
+	if len(validation.Algorithms) == 0 {
+		validation.Algorithms = keySet.Methods()
+	}
+	for _, algorithm := range validation.Algorithms {
+		if !slices.Contains(keySet.Methods(), algorithm) {
+			return nil, fmt.Errorf("no signing key uses the allowed algorithm %s", algorithm)
 		}
+	}
+	if !slices.Contains(validation.Algorithms, keySet.SigningMethod()) {
+		return nil, fmt.Errorf("the signing key's algorithm %s is not allowed", keySet.SigningMethod())
+	}
 
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		if tokenString == authHeader {
-			return c.JSON(http.StatusUnauthorized, map[string]string{"message": "missing or invalid token"})
+	parser := jwt.NewParser(
+		jwt.WithIssuer(validation.Issuer),
+		jwt.WithAudience(validation.Audience),
+		jwt.WithLeeway(validation.Leeway),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+
+	return &Auth{keySet, validation, parser, revocations, apiKeys, policy}, nil
+}
+
+func (auth *Auth) CheckAuthorizationHeader(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		claims, err := auth.authenticate(c.Request().Header)
+		if err != nil {
+			return unauthorized(c, err)
 		}
 
-		jwtKey := os.Getenv("JWT_KEY")
-		claims := &domain.Claims{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return []byte(jwtKey), nil
-		})
+		setClaims(c, claims)
+		return next(c)
+	}
+}
 
-		if err != nil || !token.Valid {
-			return c.JSON(http.StatusUnauthorized, map[string]string{"message": "invalid token"})
+// OptionalAuthorizationHeader attaches the caller's claims when a valid token or
+// API key is present but lets anonymous requests through, leaving
+// authorization to the handler.
+func (auth *Auth) OptionalAuthorizationHeader(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		header := c.Request().Header
+		if header.Get("Authorization") == "" && header.Get(ApiKeyHeader) == "" {
+			return next(c)
+		}
+
+		claims, err := auth.authenticate(header)
+		if err != nil {
+			return unauthorized(c, err)
 		}
 
-		c.Set("user", claims)
+		setClaims(c, claims)
 		return next(c)
 	}
 }
+
+// RequireSession refuses requests made with an API key, for routes that manage
+// the account such as creating keys. It must run after CheckAuthorizationHeader.
+func (auth *Auth) RequireSession(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if claims := ClaimsFromContext(c.Request().Context()); claims != nil && claims.IsApiKey() {
+			return forbidden(c, ErrSessionRequired)
+		}
+		return next(c)
+	}
+}
+
+// RequirePermission only lets requests through whose token carries a role
+// granting permission. It must run after CheckAuthorizationHeader.
+func (auth *Auth) RequirePermission(permission domain.Permission) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if err := auth.Authorize(ClaimsFromContext(c.Request().Context()), permission); err != nil {
+				if errors.Is(err, ErrMissingToken) {
+					return unauthorized(c, err)
+				}
+				return forbidden(c, err)
+			}
+			return next(c)
+		}
+	}
+}
+
+// Authorize tells whether claims grant permission. It returns ErrMissingToken
+// without claims, ErrForbidden when the role lacks the permission and
+// ErrInsufficientScope when the scopes of an API key do. When the
+// access policy holds it back it returns domain.ErrEmailNotVerified or
+// domain.ErrMfaRequired.
+func (auth *Auth) Authorize(claims *domain.Claims, permission domain.Permission) error {
+	if claims == nil {
+		return ErrMissingToken
+	}
+	if !claims.Role.Can(permission) {
+		return ErrForbidden
+	}
+	if !claims.ScopesAllow(permission) {
+		return ErrInsufficientScope
+	}
+	if auth.policy.Verification == domain.VerificationPolicyWrite && !claims.EmailVerified {
+		return domain.ErrEmailNotVerified
+	}
+	if auth.policy.RequireMfaForPrivilegedRoles && claims.Role.IsPrivileged() && !claims.HasMfa() {
+		return domain.ErrMfaRequired
+	}
+	return nil
+}
+
+// ParseAuthorizationHeader verifies the bearer token in authHeader against the
+// key set and the expected issuer and audience, and makes sure it hasn't been
+// revoked. Tokens without a jti can't be revoked and are therefore refused.
+// Problems with the token are reported as a *TokenError.
+func (auth *Auth) ParseAuthorizationHeader(authHeader string) (*domain.Claims, error) {
+	if authHeader == "" {
+		return nil, ErrMissingToken
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	if tokenString == authHeader {
+		return nil, ErrMissingToken
+	}
+
+	claims := &domain.Claims{}
+	token, err := auth.parser.ParseWithClaims(tokenString, claims, auth.keyfunc)
+	if err != nil {
+		return nil, tokenErrorFor(err)
+	}
+	if !token.Valid || claims.ID == "" {
+		return nil, ErrInvalidToken
+	}
+
+	revoked, err := auth.revocations.IsTokenRevoked(claims.ID)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrRevokedToken
+	}
+
+	return claims, nil
+}
+
+// authenticate reads the credentials of a request: an API key in the
+// X-API-Key header or as "Authorization: ApiKey <key>", or else a bearer token.
+func (auth *Auth) authenticate(header http.Header) (*domain.Claims, error) {
+	authHeader := header.Get("Authorization")
+
+	apiKey := header.Get(ApiKeyHeader)
+	if apiKey == "" {
+		apiKey, _ = strings.CutPrefix(authHeader, "ApiKey ")
+		if apiKey == authHeader {
+			return auth.ParseAuthorizationHeader(authHeader)
+		}
+	}
+
+	claims, err := auth.apiKeys.AuthenticateApiKey(apiKey)
+	if errors.Is(err, domain.ErrInvalidApiKey) {
+		return nil, ErrInvalidApiKey
+	}
+	return claims, err
+}
+
+// keyfunc refuses algorithms outside the allow-list before the key set picks
+// the verification key, so a token can't choose how it is verified.
+func (auth *Auth) keyfunc(token *jwt.Token) (interface{}, error) {
+	if !slices.Contains(auth.validation.Algorithms, token.Method.Alg()) {
+		return nil, ErrUnsupportedAlgorithm
+	}
+	return auth.keySet.Keyfunc(token)
+}
+
+// ClaimsFromContext returns the claims stored by the auth middlewares, or nil for anonymous requests.
+func ClaimsFromContext(ctx context.Context) *domain.Claims {
+	claims, _ := ctx.Value(claimsContextKey{}).(*domain.Claims)
+	return claims
+}
+
+func setClaims(c echo.Context, claims *domain.Claims) {
+	c.Set("user", claims)
+	c.SetRequest(c.Request().WithContext(context.WithValue(c.Request().Context(), claimsContextKey{}, claims)))
+}
@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"github.com/erkindilekci/cinebase/server/pkg/commmon/signing"
+	"github.com/erkindilekci/cinebase/server/pkg/domain"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+const authRealm = "cinebase"
+
+// TokenError explains why a bearer token was refused. Code is stable and meant
+// for clients, e.g. to refresh on token_expired but log in again otherwise.
+type TokenError struct {
+	Code    string
+	Message string
+}
+
+func (err *TokenError) Error() string {
+	return err.Message
+}
+
+var (
+	ErrMissingToken         = &TokenError{Code: "missing_token", Message: "missing or invalid token"}
+	ErrInvalidToken         = &TokenError{Code: "invalid_token", Message: "invalid token"}
+	ErrMalformedToken       = &TokenError{Code: "malformed_token", Message: "token is malformed"}
+	ErrExpiredToken         = &TokenError{Code: "token_expired", Message: "token has expired"}
+	ErrTokenNotYetValid     = &TokenError{Code: "token_not_yet_valid", Message: "token is not valid yet"}
+	ErrInvalidSignature     = &TokenError{Code: "invalid_signature", Message: "token signature is invalid"}
+	ErrUnsupportedAlgorithm = &TokenError{Code: "unsupported_algorithm", Message: "token is signed with an algorithm that isn't allowed"}
+	ErrInvalidIssuer        = &TokenError{Code: "invalid_issuer", Message: "token was issued by an unexpected issuer"}
+	ErrInvalidAudience      = &TokenError{Code: "invalid_audience", Message: "token is not meant for this audience"}
+	ErrRevokedToken         = &TokenError{Code: "token_revoked", Message: "token has been revoked"}
+	ErrInvalidApiKey        = &TokenError{Code: "invalid_api_key", Message: "API key is invalid or expired"}
+)
+
+var (
+	ErrForbidden         = errors.New("your role doesn't allow this action")
+	ErrInsufficientScope = errors.New("the scopes of the API key don't allow this action")
+	ErrSessionRequired   = errors.New("API keys can't be used here, log in instead")
+)
+
+// tokenErrorFor translates the errors of jwt.Parse into a TokenError.
+func tokenErrorFor(err error) *TokenError {
+	switch {
+	case errors.Is(err, ErrUnsupportedAlgorithm):
+		return ErrUnsupportedAlgorithm
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		return ErrMalformedToken
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return ErrExpiredToken
+	case errors.Is(err, jwt.ErrTokenNotValidYet), errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		return ErrTokenNotYetValid
+	case errors.Is(err, jwt.ErrTokenInvalidIssuer):
+		return ErrInvalidIssuer
+	case errors.Is(err, jwt.ErrTokenInvalidAudience):
+		return ErrInvalidAudience
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid), errors.Is(err, signing.ErrUnknownKey):
+		return ErrInvalidSignature
+	}
+	return ErrInvalidToken
+}
+
+// unauthorized answers 401 with a WWW-Authenticate challenge as described by
+// RFC 6750 for token problems, and 500 when the token couldn't be checked.
+func unauthorized(c echo.Context, err error) error {
+	var tokenError *TokenError
+	if !errors.As(err, &tokenError) {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "unable to verify the token"})
+	}
+
+	// A request without credentials gets a bare challenge.
+	challenge := fmt.Sprintf(`Bearer realm="%s"`, authRealm)
+	if tokenError != ErrMissingToken {
+		challenge += fmt.Sprintf(`, error="invalid_token", error_description="%s"`, tokenError.Message)
+	}
+	c.Response().Header().Set(echo.HeaderWWWAuthenticate, challenge)
+
+	return c.JSON(http.StatusUnauthorized, map[string]string{"message": tokenError.Message, "code": tokenError.Code})
+}
+
+// forbidden answers 403 for a valid token that doesn't grant enough, with the
+// code email_not_verified or mfa_required when the access policy is the reason
+// and session_required for an API key where only a login will do.
+func forbidden(c echo.Context, err error) error {
+	code := "insufficient_scope"
+	switch {
+	case errors.Is(err, ErrSessionRequired):
+		code = "session_required"
+	case errors.Is(err, domain.ErrEmailNotVerified):
+		code = "email_not_verified"
+	case errors.Is(err, domain.ErrMfaRequired):
+		code = "mfa_required"
+	}
+	c.Response().Header().Set(echo.HeaderWWWAuthenticate,
+		fmt.Sprintf(`Bearer realm="%s", error="insufficient_scope", error_description="%s"`, authRealm, err.Error()))
+	return c.JSON(http.StatusForbidden, map[string]string{"message": err.Error(), "code": code})
+}
@@ -0,0 +1,190 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/erkindilekci/cinebase/server/pkg/domain"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/labstack/gommon/log"
+	"time"
+)
+
+const selectApiKeyColumns = "k.id, k.user_id, k.name, k.prefix, k.key_hash, k.scopes, k.mfa, k.expires_at, k.last_used_at, k.created_at"
+
+// revokeUserCredentialsStatements end every session of a user, given as $1,
+// and delete their API keys, so nothing issued before stays usable.
+var revokeUserCredentialsStatements = append(append([]string{}, revokeUserSessionsStatements...),
+	`DELETE FROM api_keys WHERE user_id = $1`,
+)
+
+type IApiKeyRepository interface {
+	AddApiKey(key *domain.ApiKey, maxPerUser int) error
+	GetApiKeysByUser(userId int64) ([]*domain.ApiKey, error)
+	GetApiKeyByPrefix(prefix string) (*domain.ApiKey, *domain.User, error)
+	TouchApiKey(id int64, usedBefore time.Time) error
+	DeleteApiKey(userId int64, id int64) error
+}
+
+type ApiKeyRepository struct {
+	dbPool *pgxpool.Pool
+}
+
+func NewApiKeyRepository(dbPool *pgxpool.Pool) IApiKeyRepository {
+	return &ApiKeyRepository{dbPool}
+}
+
+// AddApiKey stores key unless its user has maxPerUser keys already, in which
+// case domain.ErrTooManyApiKeys is returned. The user's row is locked while
+// counting, so concurrent requests can't get past the limit together.
+func (repository *ApiKeyRepository) AddApiKey(key *domain.ApiKey, maxPerUser int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := repository.dbPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var userId int64
+	if err = tx.QueryRow(ctx, `SELECT id FROM cinebase_users WHERE id = $1 FOR UPDATE`, key.UserId).Scan(&userId); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return domain.ErrUserNotFound
+		}
+		log.Errorf("error while adding API key: %v", err)
+		return err
+	}
+
+	insertStatement := `INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, mfa, expires_at)
+		SELECT $1::INTEGER, $2::VARCHAR, $3::VARCHAR, $4::VARCHAR, $5::TEXT[], $6::BOOLEAN, $7::TIMESTAMPTZ
+		WHERE (SELECT COUNT(*) FROM api_keys WHERE user_id = $1) < $8
+		RETURNING id, created_at`
+
+	err = tx.QueryRow(ctx, insertStatement, key.UserId, key.Name, key.Prefix, key.KeyHash, scopeStrings(key.Scopes), key.Mfa, key.ExpiresAt, maxPerUser).
+		Scan(&key.Id, &key.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return domain.ErrTooManyApiKeys
+		}
+		log.Errorf("error while adding API key: %v", err)
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (repository *ApiKeyRepository) GetApiKeysByUser(userId int64) ([]*domain.ApiKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	selectStatement := "SELECT " + selectApiKeyColumns + " FROM api_keys k WHERE k.user_id = $1 ORDER BY k.created_at DESC"
+
+	rows, err := repository.dbPool.Query(ctx, selectStatement, userId)
+	if err != nil {
+		log.Errorf("error while listing API keys: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*domain.ApiKey{}
+	for rows.Next() {
+		key, err := scanApiKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// GetApiKeyByPrefix returns the key with prefix together with its owner, or
+// domain.ErrInvalidApiKey when there is none.
+func (repository *ApiKeyRepository) GetApiKeyByPrefix(prefix string) (*domain.ApiKey, *domain.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	selectStatement := "SELECT " + selectApiKeyColumns + `, u.email, u.role, u.email_verified_at
+		FROM api_keys k JOIN cinebase_users u ON u.id = k.user_id WHERE k.prefix = $1`
+
+	var key domain.ApiKey
+	var scopes []string
+	var user domain.User
+	err := repository.dbPool.QueryRow(ctx, selectStatement, prefix).Scan(
+		&key.Id, &key.UserId, &key.Name, &key.Prefix, &key.KeyHash, &scopes, &key.Mfa, &key.ExpiresAt, &key.LastUsedAt, &key.CreatedAt,
+		&user.Email, &user.Role, &user.EmailVerifiedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil, domain.ErrInvalidApiKey
+		}
+		log.Errorf("error while finding API key: %v", err)
+		return nil, nil, err
+	}
+
+	key.Scopes = toScopes(scopes)
+	user.Id = key.UserId
+	return &key, &user, nil
+}
+
+// TouchApiKey records that the key was used, unless that was already done
+// after usedBefore, so busy keys don't cause a write per request.
+func (repository *ApiKeyRepository) TouchApiKey(id int64, usedBefore time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	updateStatement := `UPDATE api_keys SET last_used_at = NOW() WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < $2)`
+
+	if _, err := repository.dbPool.Exec(ctx, updateStatement, id, usedBefore); err != nil {
+		log.Errorf("error while recording API key use: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// DeleteApiKey revokes a key of the user, domain.ErrApiKeyNotFound is returned
+// for keys of other users.
+func (repository *ApiKeyRepository) DeleteApiKey(userId int64, id int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	commandTag, err := repository.dbPool.Exec(ctx, `DELETE FROM api_keys WHERE id = $1 AND user_id = $2`, id, userId)
+	if err != nil {
+		log.Errorf("error while deleting API key: %v", err)
+		return err
+	}
+	if commandTag.RowsAffected() == 0 {
+		return domain.ErrApiKeyNotFound
+	}
+
+	return nil
+}
+
+func scanApiKey(rows pgx.Rows) (*domain.ApiKey, error) {
+	var key domain.ApiKey
+	var scopes []string
+	err := rows.Scan(&key.Id, &key.UserId, &key.Name, &key.Prefix, &key.KeyHash, &scopes, &key.Mfa, &key.ExpiresAt, &key.LastUsedAt, &key.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	key.Scopes = toScopes(scopes)
+	return &key, nil
+}
+
+func scopeStrings(scopes []domain.Scope) []string {
+	values := make([]string, len(scopes))
+	for i, scope := range scopes {
+		values[i] = string(scope)
+	}
+	return values
+}
+
+func toScopes(values []string) []domain.Scope {
+	scopes := make([]domain.Scope, len(values))
+	for i, value := range values {
+		scopes[i] = domain.Scope(value)
+	}
+	return scopes
+}
@@ -0,0 +1,164 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/erkindilekci/cinebase/server/pkg/domain"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/labstack/gommon/log"
+)
+
+const uniqueViolationCode = "23505"
+
+type IGenreRepository interface {
+	AddGenre(genre *domain.Genre) (*domain.Genre, error)
+	UpdateGenre(genre *domain.Genre) (*domain.Genre, error)
+	MergeGenres(sourceId int64, targetId int64) (*domain.Genre, error)
+	DeleteGenreById(id int64) error
+}
+
+type GenreRepository struct {
+	dbPool *pgxpool.Pool
+}
+
+func NewGenreRepository(dbPool *pgxpool.Pool) IGenreRepository {
+	return &GenreRepository{dbPool}
+}
+
+func (repository *GenreRepository) AddGenre(genre *domain.Genre) (*domain.Genre, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `INSERT INTO genres (genre, slug, created_at, updated_at) VALUES ($1, $2, NOW(), NOW()) RETURNING id`
+
+	err := repository.dbPool.QueryRow(ctx, query, genre.Genre, genre.Slug).Scan(&genre.Id)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, domain.ErrGenreExists
+		}
+		log.Errorf("error while adding genre: %v", err)
+		return nil, err
+	}
+
+	return genre, nil
+}
+
+func (repository *GenreRepository) UpdateGenre(genre *domain.Genre) (*domain.Genre, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `UPDATE genres SET genre = $1, slug = $2, updated_at = NOW() WHERE id = $3`
+
+	commandTag, err := repository.dbPool.Exec(ctx, query, genre.Genre, genre.Slug, genre.Id)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, domain.ErrGenreExists
+		}
+		log.Errorf("error while updating genre: %v", err)
+		return nil, err
+	}
+	if commandTag.RowsAffected() == 0 {
+		return nil, domain.ErrGenreNotFound
+	}
+
+	return genre, nil
+}
+
+// MergeGenres moves every movie of the source genre to the target genre and
+// deletes the source. Movies that already have both keep a single link.
+func (repository *GenreRepository) MergeGenres(sourceId int64, targetId int64) (*domain.Genre, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := repository.dbPool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var target domain.Genre
+	lockQuery := `SELECT id, genre, slug FROM genres WHERE id = ANY($1) ORDER BY id FOR UPDATE`
+
+	genreRows, err := tx.Query(ctx, lockQuery, []int64{sourceId, targetId})
+	if err != nil {
+		log.Errorf("error while locking genres for merge: %v", err)
+		return nil, err
+	}
+	genres, err := extractGenresFromRows(genreRows)
+	genreRows.Close()
+	if err != nil {
+		return nil, err
+	}
+	if len(genres) != 2 {
+		return nil, domain.ErrGenreNotFound
+	}
+	for _, genre := range genres {
+		if genre.Id == targetId {
+			target = *genre
+		}
+	}
+
+	reassignQuery := `INSERT INTO movies_genres (movie_id, genre_id)
+		SELECT movie_id, $2 FROM movies_genres WHERE genre_id = $1
+		ON CONFLICT DO NOTHING`
+
+	if _, err = tx.Exec(ctx, reassignQuery, sourceId, targetId); err != nil {
+		log.Errorf("error while reassigning movies from genre %d to %d: %v", sourceId, targetId, err)
+		return nil, err
+	}
+
+	// The source's own movies_genres rows go with it through ON DELETE CASCADE.
+	if _, err = tx.Exec(ctx, `DELETE FROM genres WHERE id = $1`, sourceId); err != nil {
+		log.Errorf("error while deleting merged genre: %v", err)
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return &target, nil
+}
+
+// DeleteGenreById deletes a genre that no movie belongs to anymore.
+func (repository *GenreRepository) DeleteGenreById(id int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := repository.dbPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, `SELECT id FROM genres WHERE id = $1 FOR UPDATE`, id).Scan(&id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return domain.ErrGenreNotFound
+		}
+		return err
+	}
+
+	var inUse bool
+	err = tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM movies_genres WHERE genre_id = $1)`, id).Scan(&inUse)
+	if err != nil {
+		return err
+	}
+	if inUse {
+		return domain.ErrGenreInUse
+	}
+
+	if _, err = tx.Exec(ctx, `DELETE FROM genres WHERE id = $1`, id); err != nil {
+		log.Errorf("error while deleting genre: %v", err)
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolationCode
+}
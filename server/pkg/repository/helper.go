@@ -3,8 +3,63 @@ package repository
 import (
 	"github.com/erkindilekci/cinebase/server/pkg/domain"
 	"github.com/jackc/pgx/v4"
+	"regexp"
+	"strings"
+	"unicode"
 )
 
+var likePatternReplacer = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// escapeLikePattern escapes the LIKE wildcards in user input so it is matched literally.
+func escapeLikePattern(value string) string {
+	return likePatternReplacer.Replace(value)
+}
+
+var searchTermPattern = regexp.MustCompile(`"[^"]*"|\S+`)
+
+// buildTsQuery turns free text into to_tsquery syntax: "quoted words" become a
+// phrase, a trailing * marks a prefix and every other word must match. Anything
+// but letters and digits is dropped so user input can't break the query syntax.
+func buildTsQuery(text string) string {
+	var terms []string
+
+	for _, token := range searchTermPattern.FindAllString(text, -1) {
+		if strings.HasPrefix(token, `"`) {
+			var phrase []string
+			for _, word := range strings.Fields(token) {
+				if lexeme := sanitizeLexeme(word); lexeme != "" {
+					phrase = append(phrase, "'"+lexeme+"'")
+				}
+			}
+			if len(phrase) > 0 {
+				terms = append(terms, "("+strings.Join(phrase, " <-> ")+")")
+			}
+			continue
+		}
+
+		lexeme := sanitizeLexeme(token)
+		if lexeme == "" {
+			continue
+		}
+		if strings.HasSuffix(token, "*") {
+			terms = append(terms, "'"+lexeme+"':*")
+		} else {
+			terms = append(terms, "'"+lexeme+"'")
+		}
+	}
+
+	return strings.Join(terms, " & ")
+}
+
+func sanitizeLexeme(word string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, word)
+}
+
 func extractMoviesFromRows(movieRows pgx.Rows) ([]*domain.Movie, error) {
 	var movies []*domain.Movie
 
@@ -36,7 +91,7 @@ func extractGenresFromRows(genreRows pgx.Rows) ([]*domain.Genre, error) {
 
 	for genreRows.Next() {
 		genre := domain.Genre{}
-		err := genreRows.Scan(&genre.Id, &genre.Genre)
+		err := genreRows.Scan(&genre.Id, &genre.Genre, &genre.Slug)
 		if err != nil {
 			return nil, err
 		}
@@ -46,3 +101,19 @@ func extractGenresFromRows(genreRows pgx.Rows) ([]*domain.Genre, error) {
 
 	return genres, nil
 }
+
+// scanFacetRows reads the next result of a facet batch row by row.
+func scanFacetRows(results pgx.BatchResults, scan func(rows pgx.Rows) error) error {
+	rows, err := results.Query()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err = scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/erkindilekci/cinebase/server/pkg/domain"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/labstack/gommon/log"
+)
+
+type IIdentityRepository interface {
+	GetUserByIdentity(issuer, subject string) (*domain.User, error)
+	ProvisionUser(identity *domain.UserIdentity, emailVerified bool, role domain.Role) (*domain.User, error)
+}
+
+type IdentityRepository struct {
+	dbPool *pgxpool.Pool
+}
+
+func NewIdentityRepository(dbPool *pgxpool.Pool) IIdentityRepository {
+	return &IdentityRepository{dbPool}
+}
+
+// GetUserByIdentity returns the account linked to subject at issuer and
+// records the login, or domain.ErrUserNotFound when none is linked yet.
+func (repository *IdentityRepository) GetUserByIdentity(issuer, subject string) (*domain.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	updateStatement := `UPDATE user_identities SET last_login_at = NOW() WHERE issuer = $1 AND subject = $2 RETURNING user_id`
+
+	var userId int64
+	if err := repository.dbPool.QueryRow(ctx, updateStatement, issuer, subject).Scan(&userId); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, domain.ErrUserNotFound
+		}
+		log.Errorf("error while finding user identity: %v", err)
+		return nil, err
+	}
+
+	var user domain.User
+	selectStatement := "SELECT " + selectUserColumns + " FROM cinebase_users WHERE id = $1"
+	err := repository.dbPool.QueryRow(ctx, selectStatement, userId).Scan(&user.Id, &user.Email, &user.Password, &user.Role, &user.EmailVerifiedAt, &user.MfaEnabled)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// ProvisionUser links identity to the account with the same email, or creates
+// an account with role when there is none. Linking requires the provider to
+// have verified the email, otherwise domain.ErrIdentityConflict is returned.
+func (repository *IdentityRepository) ProvisionUser(identity *domain.UserIdentity, emailVerified bool, role domain.Role) (*domain.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := repository.dbPool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var user domain.User
+	selectStatement := "SELECT " + selectUserColumns + " FROM cinebase_users WHERE LOWER(email) = LOWER($1) FOR UPDATE"
+	err = tx.QueryRow(ctx, selectStatement, identity.Email).Scan(&user.Id, &user.Email, &user.Password, &user.Role, &user.EmailVerifiedAt, &user.MfaEnabled)
+
+	switch {
+	case err == nil:
+		if !emailVerified {
+			return nil, domain.ErrIdentityConflict
+		}
+		// The provider vouches for the address, which verifies it here too.
+		updateStatement := `UPDATE cinebase_users SET email_verified_at = COALESCE(email_verified_at, NOW()), updated_at = NOW()
+			WHERE id = $1 RETURNING email_verified_at`
+		if err = tx.QueryRow(ctx, updateStatement, user.Id).Scan(&user.EmailVerifiedAt); err != nil {
+			return nil, err
+		}
+	case errors.Is(err, pgx.ErrNoRows):
+		// Provisioned accounts get an empty password, which matches no
+		// password, until the user sets one through a password reset.
+		insertStatement := `INSERT INTO cinebase_users (email, password, role, email_verified_at)
+			VALUES ($1, '', $2, CASE WHEN $3::boolean THEN NOW() END) RETURNING ` + selectUserColumns
+		err = tx.QueryRow(ctx, insertStatement, identity.Email, role, emailVerified).Scan(&user.Id, &user.Email, &user.Password, &user.Role, &user.EmailVerifiedAt, &user.MfaEnabled)
+		if err != nil {
+			log.Errorf("error while provisioning user: %v", err)
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	insertStatement := `INSERT INTO user_identities (user_id, issuer, subject, email) VALUES ($1, $2, $3, $4) RETURNING id`
+	err = tx.QueryRow(ctx, insertStatement, user.Id, identity.Issuer, identity.Subject, identity.Email).Scan(&identity.Id)
+	if err != nil {
+		log.Errorf("error while linking user identity: %v", err)
+		return nil, err
+	}
+	identity.UserId = user.Id
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
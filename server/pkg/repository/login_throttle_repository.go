@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"context"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/labstack/gommon/log"
+	"time"
+)
+
+type ILoginThrottleRepository interface {
+	CountAttempt(subject string, resetBefore time.Time, delays []time.Duration) (attempts int, blockedUntil *time.Time, err error)
+	RefundAttempt(subject string, attempts int) error
+	Clear(subject string) error
+}
+
+// LoginThrottleRepository counts failed logins per subject, such as an email
+// or a client IP.
+type LoginThrottleRepository struct {
+	dbPool *pgxpool.Pool
+}
+
+func NewLoginThrottleRepository(dbPool *pgxpool.Pool) ILoginThrottleRepository {
+	return &LoginThrottleRepository{dbPool}
+}
+
+// CountAttempt counts a login attempt for subject as failed before its
+// credentials are checked and blocks subject for delays[n-1] after its n-th
+// counted attempt, the last delay applying to every later one. Counting and
+// blocking happen in one statement, so concurrent attempts can't all slip
+// through before the block. An attempt made while subject is blocked isn't
+// counted and returns the block with attempts set to 0. Failures from before
+// resetBefore are forgotten.
+func (repository *LoginThrottleRepository) CountAttempt(subject string, resetBefore time.Time, delays []time.Duration) (int, *time.Time, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	delayMicroseconds := make([]int64, len(delays))
+	for i, delay := range delays {
+		delayMicroseconds[i] = delay.Microseconds()
+	}
+
+	upsertStatement := `INSERT INTO login_throttles AS throttle (subject, failures, last_failure_at, blocked_until)
+		VALUES ($1, 1, NOW(), NOW() + NULLIF(($3::BIGINT[])[1], 0) * INTERVAL '1 microsecond')
+		ON CONFLICT (subject) DO UPDATE SET
+			failures = CASE
+				WHEN throttle.blocked_until > NOW() THEN throttle.failures
+				WHEN throttle.last_failure_at < $2 THEN 1
+				ELSE throttle.failures + 1 END,
+			last_failure_at = CASE WHEN throttle.blocked_until > NOW() THEN throttle.last_failure_at ELSE NOW() END,
+			blocked_until = CASE
+				WHEN throttle.blocked_until > NOW() THEN throttle.blocked_until
+				ELSE NOW() + NULLIF(($3::BIGINT[])[LEAST(
+					CASE WHEN throttle.last_failure_at < $2 THEN 1 ELSE throttle.failures + 1 END,
+					CARDINALITY($3::BIGINT[]))], 0) * INTERVAL '1 microsecond' END
+		RETURNING failures, blocked_until, last_failure_at = NOW()`
+
+	var attempts int
+	var blockedUntil *time.Time
+	var counted bool
+	err := repository.dbPool.QueryRow(ctx, upsertStatement, subject, resetBefore, delayMicroseconds).Scan(&attempts, &blockedUntil, &counted)
+	if err != nil {
+		log.Errorf("error while counting login attempt: %v", err)
+		return 0, nil, err
+	}
+
+	// Subjects that neither failed recently nor are blocked need no row.
+	deleteStatement := `DELETE FROM login_throttles WHERE last_failure_at < $1 AND (blocked_until IS NULL OR blocked_until < NOW())`
+	if _, err = repository.dbPool.Exec(ctx, deleteStatement, resetBefore); err != nil {
+		log.Errorf("error while removing stale login throttles: %v", err)
+	}
+
+	if !counted {
+		return 0, blockedUntil, nil
+	}
+	return attempts, nil, nil
+}
+
+// RefundAttempt takes back the attempts-th attempt counted for subject once
+// it turned out not to fail. The block it set is lifted unless further
+// attempts were counted since, as the block is theirs then.
+func (repository *LoginThrottleRepository) RefundAttempt(subject string, attempts int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	updateStatement := `UPDATE login_throttles SET
+			failures = GREATEST(failures - 1, 0),
+			blocked_until = CASE WHEN failures = $2 THEN NULL ELSE blocked_until END
+		WHERE subject = $1`
+
+	if _, err := repository.dbPool.Exec(ctx, updateStatement, subject, attempts); err != nil {
+		log.Errorf("error while refunding login attempt: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// Clear forgets the failures of subject and lifts its block.
+func (repository *LoginThrottleRepository) Clear(subject string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	if _, err := repository.dbPool.Exec(ctx, `DELETE FROM login_throttles WHERE subject = $1`, subject); err != nil {
+		log.Errorf("error while clearing login throttle: %v", err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,195 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/erkindilekci/cinebase/server/pkg/domain"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/labstack/gommon/log"
+)
+
+type IMfaRepository interface {
+	GetTotp(userId int64) (*domain.Totp, error)
+	SetTotpSecret(userId int64, secret string) error
+	ConfirmTotp(userId int64, step int64, recoveryCodeHashes []string) error
+	UseTotpStep(userId int64, step int64) (bool, error)
+	UseRecoveryCode(userId int64, codeHash string) (bool, error)
+	ReplaceRecoveryCodes(userId int64, recoveryCodeHashes []string) error
+	DisableTotp(userId int64) error
+}
+
+type MfaRepository struct {
+	dbPool *pgxpool.Pool
+}
+
+func NewMfaRepository(dbPool *pgxpool.Pool) IMfaRepository {
+	return &MfaRepository{dbPool}
+}
+
+// GetTotp returns the TOTP enrollment of a user, or nil without one.
+func (repository *MfaRepository) GetTotp(userId int64) (*domain.Totp, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	selectStatement := `SELECT totp_secret, totp_confirmed_at, totp_last_step FROM cinebase_users WHERE id = $1`
+
+	var secret *string
+	var totp domain.Totp
+	err := repository.dbPool.QueryRow(ctx, selectStatement, userId).Scan(&secret, &totp.ConfirmedAt, &totp.LastStep)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, domain.ErrUserNotFound
+		}
+		return nil, err
+	}
+	if secret == nil {
+		return nil, nil
+	}
+
+	totp.Secret = *secret
+	return &totp, nil
+}
+
+// SetTotpSecret starts a new enrollment, replacing one that was never
+// confirmed. A confirmed enrollment has to be disabled first.
+func (repository *MfaRepository) SetTotpSecret(userId int64, secret string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	updateStatement := `UPDATE cinebase_users SET totp_secret = $2, totp_last_step = NULL, updated_at = NOW()
+		WHERE id = $1 AND totp_confirmed_at IS NULL`
+
+	commandTag, err := repository.dbPool.Exec(ctx, updateStatement, userId, secret)
+	if err != nil {
+		log.Errorf("error while storing TOTP secret: %v", err)
+		return err
+	}
+	if commandTag.RowsAffected() == 0 {
+		return domain.ErrMfaAlreadyEnabled
+	}
+
+	return nil
+}
+
+// ConfirmTotp enables the pending enrollment after its first code, at step,
+// was accepted and stores the user's recovery codes.
+func (repository *MfaRepository) ConfirmTotp(userId int64, step int64, recoveryCodeHashes []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := repository.dbPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	updateStatement := `UPDATE cinebase_users SET totp_confirmed_at = NOW(), totp_last_step = $2, updated_at = NOW()
+		WHERE id = $1 AND totp_secret IS NOT NULL AND totp_confirmed_at IS NULL`
+
+	commandTag, err := tx.Exec(ctx, updateStatement, userId, step)
+	if err != nil {
+		log.Errorf("error while confirming TOTP: %v", err)
+		return err
+	}
+	if commandTag.RowsAffected() == 0 {
+		return domain.ErrMfaAlreadyEnabled
+	}
+
+	if err = replaceRecoveryCodes(ctx, tx, userId, recoveryCodeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// UseTotpStep records that the code of step was used and reports whether it
+// hadn't been before, so each code works once.
+func (repository *MfaRepository) UseTotpStep(userId int64, step int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	updateStatement := `UPDATE cinebase_users SET totp_last_step = $2
+		WHERE id = $1 AND totp_confirmed_at IS NOT NULL AND (totp_last_step IS NULL OR totp_last_step < $2)`
+
+	commandTag, err := repository.dbPool.Exec(ctx, updateStatement, userId, step)
+	if err != nil {
+		log.Errorf("error while recording TOTP use: %v", err)
+		return false, err
+	}
+
+	return commandTag.RowsAffected() > 0, nil
+}
+
+// UseRecoveryCode spends the recovery code with codeHash and reports whether
+// it was still unused.
+func (repository *MfaRepository) UseRecoveryCode(userId int64, codeHash string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	updateStatement := `UPDATE mfa_recovery_codes SET used_at = NOW() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+
+	commandTag, err := repository.dbPool.Exec(ctx, updateStatement, userId, codeHash)
+	if err != nil {
+		log.Errorf("error while using recovery code: %v", err)
+		return false, err
+	}
+
+	return commandTag.RowsAffected() > 0, nil
+}
+
+func (repository *MfaRepository) ReplaceRecoveryCodes(userId int64, recoveryCodeHashes []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := repository.dbPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err = replaceRecoveryCodes(ctx, tx, userId, recoveryCodeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (repository *MfaRepository) DisableTotp(userId int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := repository.dbPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	updateStatement := `UPDATE cinebase_users SET totp_secret = NULL, totp_confirmed_at = NULL, totp_last_step = NULL, updated_at = NOW()
+		WHERE id = $1`
+
+	if _, err = tx.Exec(ctx, updateStatement, userId); err != nil {
+		log.Errorf("error while disabling TOTP: %v", err)
+		return err
+	}
+	if err = replaceRecoveryCodes(ctx, tx, userId, nil); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, userId int64, recoveryCodeHashes []string) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userId); err != nil {
+		log.Errorf("error while removing recovery codes: %v", err)
+		return err
+	}
+
+	insertStatement := `INSERT INTO mfa_recovery_codes (user_id, code_hash) SELECT $1, UNNEST($2::text[])`
+	if _, err := tx.Exec(ctx, insertStatement, userId, recoveryCodeHashes); err != nil {
+		log.Errorf("error while storing recovery codes: %v", err)
+		return err
+	}
+
+	return nil
+}
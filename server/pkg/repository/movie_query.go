@@ -0,0 +1,160 @@
+package repository
+
+import (
+	"fmt"
+	"github.com/erkindilekci/cinebase/server/pkg/domain"
+	"strconv"
+	"strings"
+)
+
+const movieColumns = `m.id, m.title, m.release_date, m.runtime, m.mpaa_rating, m.description, COALESCE(m.image, ''), m.created_at, m.updated_at`
+
+type sortColumn struct {
+	expression string
+	cast       string
+}
+
+// sortColumns maps each sortable field to the expression used in ORDER BY and
+// in keyset conditions, together with the type cursor values are cast to.
+var sortColumns = map[domain.MovieSortField]sortColumn{
+	domain.MovieSortByTitle:       {expression: "m.title", cast: "text"},
+	domain.MovieSortByReleaseDate: {expression: "m.release_date", cast: "date"},
+	domain.MovieSortByRuntime:     {expression: "m.runtime", cast: "integer"},
+	domain.MovieSortByCreatedAt:   {expression: "COALESCE(m.created_at, 'epoch'::timestamp)", cast: "timestamp"},
+}
+
+// movieQueryBuilder assembles a SELECT over movies from independent filter,
+// keyset and ordering clauses while keeping track of positional arguments.
+type movieQueryBuilder struct {
+	conditions []string
+	args       []interface{}
+	orderBy    string
+	limit      int
+}
+
+func newMovieQueryBuilder() *movieQueryBuilder {
+	return &movieQueryBuilder{}
+}
+
+// arg registers value as a query argument and returns its placeholder.
+func (builder *movieQueryBuilder) arg(value interface{}) string {
+	builder.args = append(builder.args, value)
+	return "$" + strconv.Itoa(len(builder.args))
+}
+
+func (builder *movieQueryBuilder) where(condition string) *movieQueryBuilder {
+	builder.conditions = append(builder.conditions, condition)
+	return builder
+}
+
+func (builder *movieQueryBuilder) filter(filter domain.MovieFilter) *movieQueryBuilder {
+	if filter.TitleContains != "" {
+		builder.where(fmt.Sprintf("m.title ILIKE '%%' || %s || '%%'", builder.arg(escapeLikePattern(filter.TitleContains))))
+	}
+	if len(filter.GenreIds) > 0 {
+		if filter.GenreMatchAll {
+			builder.where(fmt.Sprintf(
+				"m.id IN (SELECT movie_id FROM movies_genres WHERE genre_id = ANY(%s) GROUP BY movie_id HAVING COUNT(DISTINCT genre_id) = %s)",
+				builder.arg(filter.GenreIds), builder.arg(len(uniqueIds(filter.GenreIds)))))
+		} else {
+			builder.where(fmt.Sprintf("m.id IN (SELECT movie_id FROM movies_genres WHERE genre_id = ANY(%s))", builder.arg(filter.GenreIds)))
+		}
+	}
+	if len(filter.MPAARatings) > 0 {
+		builder.where(fmt.Sprintf("m.mpaa_rating = ANY(%s)", builder.arg(filter.MPAARatings)))
+	}
+	if filter.ReleaseYearFrom > 0 {
+		builder.where(fmt.Sprintf("m.release_date >= make_date(%s, 1, 1)", builder.arg(filter.ReleaseYearFrom)))
+	}
+	if filter.ReleaseYearTo > 0 {
+		builder.where(fmt.Sprintf("m.release_date < make_date(%s + 1, 1, 1)", builder.arg(filter.ReleaseYearTo)))
+	}
+	if filter.RuntimeMin > 0 {
+		builder.where(fmt.Sprintf("m.runtime >= %s", builder.arg(filter.RuntimeMin)))
+	}
+	if filter.RuntimeMax > 0 {
+		builder.where(fmt.Sprintf("m.runtime <= %s", builder.arg(filter.RuntimeMax)))
+	}
+	return builder
+}
+
+// keyset restricts the rows to those strictly after (or before) cursor in the
+// (sort value, id) ordering.
+func (builder *movieQueryBuilder) keyset(column sortColumn, cursor *domain.MovieCursor, after bool, descending bool) *movieQueryBuilder {
+	if cursor == nil {
+		return builder
+	}
+
+	operator := ">"
+	if after == descending {
+		operator = "<"
+	}
+
+	builder.where(fmt.Sprintf("(%s, m.id) %s (%s::%s, %s)",
+		column.expression, operator, builder.arg(cursor.SortValue), column.cast, builder.arg(cursor.Id)))
+	return builder
+}
+
+func (builder *movieQueryBuilder) order(column sortColumn, descending bool) *movieQueryBuilder {
+	direction := "ASC"
+	if descending {
+		direction = "DESC"
+	}
+	builder.orderBy = fmt.Sprintf("%s %s, m.id %s", column.expression, direction, direction)
+	return builder
+}
+
+func (builder *movieQueryBuilder) limitTo(limit int) *movieQueryBuilder {
+	builder.limit = limit
+	return builder
+}
+
+func (builder *movieQueryBuilder) whereClause() string {
+	if len(builder.conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(builder.conditions, " AND ")
+}
+
+func (builder *movieQueryBuilder) selectQuery() (string, []interface{}) {
+	query := "SELECT " + movieColumns + " FROM movies m" + builder.whereClause()
+	if builder.orderBy != "" {
+		query += " ORDER BY " + builder.orderBy
+	}
+	if builder.limit > 0 {
+		query += " LIMIT " + builder.arg(builder.limit)
+	}
+	return query, builder.args
+}
+
+func (builder *movieQueryBuilder) countQuery() (string, []interface{}) {
+	return "SELECT COUNT(*) FROM movies m" + builder.whereClause(), builder.args
+}
+
+// groupQuery counts the filtered movies per group. joins are added after the
+// movies table and columns must start with the grouping expressions.
+func (builder *movieQueryBuilder) groupQuery(columns string, joins string, groupBy string) (string, []interface{}) {
+	query := "SELECT " + columns + ", COUNT(*) FROM movies m" + joins + builder.whereClause() +
+		" GROUP BY " + groupBy + " ORDER BY " + groupBy
+	return query, builder.args
+}
+
+func sortColumnFor(sortField domain.MovieSortField) (sortColumn, error) {
+	column, ok := sortColumns[sortField]
+	if !ok {
+		return sortColumn{}, fmt.Errorf("unsupported sort field: %s", sortField)
+	}
+	return column, nil
+}
+
+func uniqueIds(ids []int64) []int64 {
+	seen := make(map[int64]bool, len(ids))
+	var unique []int64
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
@@ -4,18 +4,31 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"github.com/erkindilekci/cinebase/server/pkg/domain"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/labstack/gommon/log"
+	"slices"
 	"time"
 )
 
 type IMovieRepository interface {
 	GetAllMovies() ([]*domain.Movie, error)
 	GetMoviesByGenreId(genreId int64) ([]*domain.Movie, error)
+	SearchMoviesByTitle(titleContains string) ([]*domain.Movie, error)
+	SearchMovies(text string, limit int) ([]*domain.MovieSearchResult, error)
+	AutocompleteTitles(prefix string, limit int) ([]*domain.MovieSuggestion, error)
+	GetMoviesPage(pageQuery *domain.MoviePageQuery) (*domain.MoviePage, error)
+	CountMovies(filter domain.MovieFilter) (int64, error)
+	GetMovieFacets(filter domain.MovieFilter) (*domain.MovieFacets, error)
 	GetMovieById(id int64) (*domain.Movie, error)
 	GetMovieByIdEdit(id int64) (*domain.Movie, error)
 	GetAllGenres() ([]*domain.Genre, error)
+	GetGenreById(id int64) (*domain.Genre, error)
+	GetGenresByMovieId(movieId int64) ([]*domain.Genre, error)
+	GetGenresByMovieIds(movieIds []int64) (map[int64][]*domain.Genre, error)
+	GetMoviesByGenreIds(genreIds []int64) (map[int64][]*domain.Movie, error)
 	AddMovie(movie *domain.Movie) (*domain.Movie, error)
 	UpdateMovie(movie *domain.Movie) (*domain.Movie, error)
 	DeleteMovieById(id int64) error
@@ -69,6 +82,281 @@ func (repository *MovieRepository) GetMoviesByGenreId(genreId int64) ([]*domain.
 	return extractMoviesFromRows(movieRows)
 }
 
+func (repository *MovieRepository) SearchMoviesByTitle(titleContains string) ([]*domain.Movie, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	selectQuery := `SELECT id, title, release_date, runtime, mpaa_rating, description, COALESCE(image, ''), created_at, updated_at
+		FROM movies WHERE title ILIKE '%' || $1 || '%' ORDER BY title`
+
+	movieRows, err := repository.dbPool.Query(ctx, selectQuery, escapeLikePattern(titleContains))
+	if err != nil {
+		log.Errorf("error while searching movies by title: %v", err)
+		return nil, err
+	}
+	defer movieRows.Close()
+
+	return extractMoviesFromRows(movieRows)
+}
+
+func (repository *MovieRepository) SearchMovies(text string, limit int) ([]*domain.MovieSearchResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tsQuery := buildTsQuery(text)
+	if tsQuery == "" {
+		return []*domain.MovieSearchResult{}, nil
+	}
+
+	selectQuery := `
+		SELECT ` + movieColumns + `,
+			ts_rank_cd(m.search_vector, query) AS rank,
+			ts_headline('english', m.title, query, 'HighlightAll=true, StartSel=<mark>, StopSel=</mark>'),
+			ts_headline('english', m.description, query, 'StartSel=<mark>, StopSel=</mark>, MinWords=15, MaxWords=35, MaxFragments=2')
+		FROM movies m, to_tsquery('english', $1) query
+		WHERE m.search_vector @@ query
+		ORDER BY rank DESC, m.id
+		LIMIT $2`
+
+	resultRows, err := repository.dbPool.Query(ctx, selectQuery, tsQuery, limit)
+	if err != nil {
+		log.Errorf("error while searching movies: %v", err)
+		return nil, err
+	}
+	defer resultRows.Close()
+
+	results := []*domain.MovieSearchResult{}
+	for resultRows.Next() {
+		movie := domain.Movie{}
+		result := domain.MovieSearchResult{Movie: &movie}
+		err = resultRows.Scan(
+			&movie.Id,
+			&movie.Title,
+			&movie.ReleaseDate,
+			&movie.Runtime,
+			&movie.MPAARating,
+			&movie.Description,
+			&movie.Image,
+			&movie.CreatedAt,
+			&movie.UpdateAt,
+			&result.Rank,
+			&result.TitleHighlight,
+			&result.Snippet,
+		)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, &result)
+	}
+
+	return results, resultRows.Err()
+}
+
+func (repository *MovieRepository) AutocompleteTitles(prefix string, limit int) ([]*domain.MovieSuggestion, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	// Trigram word similarity tolerates typos; titles that start with the
+	// prefix, or have a word that does, are boosted above fuzzy matches.
+	selectQuery := `
+		SELECT id, title, COALESCE(image, '')
+		FROM movies
+		WHERE $1 <% title OR title ILIKE $2 || '%' OR title ILIKE '% ' || $2 || '%'
+		ORDER BY word_similarity($1, title)
+			+ CASE WHEN title ILIKE $2 || '%' THEN 1 ELSE 0 END
+			+ CASE WHEN title ILIKE '% ' || $2 || '%' THEN 0.5 ELSE 0 END DESC,
+			title
+		LIMIT $3`
+
+	suggestionRows, err := repository.dbPool.Query(ctx, selectQuery, prefix, escapeLikePattern(prefix), limit)
+	if err != nil {
+		log.Errorf("error while autocompleting movie titles: %v", err)
+		return nil, err
+	}
+	defer suggestionRows.Close()
+
+	suggestions := []*domain.MovieSuggestion{}
+	for suggestionRows.Next() {
+		suggestion := domain.MovieSuggestion{}
+		if err = suggestionRows.Scan(&suggestion.Id, &suggestion.Title, &suggestion.Image); err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, &suggestion)
+	}
+
+	return suggestions, suggestionRows.Err()
+}
+
+func (repository *MovieRepository) GetMoviesPage(pageQuery *domain.MoviePageQuery) (*domain.MoviePage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	column, err := sortColumnFor(pageQuery.SortField)
+	if err != nil {
+		return nil, err
+	}
+
+	// Backward pages are read in reverse order from the cursor and flipped
+	// afterwards; one extra row tells whether there is more in that direction.
+	selectQuery, args := newMovieQueryBuilder().
+		filter(pageQuery.Filter).
+		keyset(column, pageQuery.After, true, pageQuery.Descending).
+		keyset(column, pageQuery.Before, false, pageQuery.Descending).
+		order(column, pageQuery.Descending != pageQuery.Backward).
+		limitTo(pageQuery.Limit + 1).
+		selectQuery()
+
+	movieRows, err := repository.dbPool.Query(ctx, selectQuery, args...)
+	if err != nil {
+		log.Errorf("error while getting movies page: %v", err)
+		return nil, err
+	}
+	defer movieRows.Close()
+
+	movies, err := extractMoviesFromRows(movieRows)
+	if err != nil {
+		return nil, err
+	}
+
+	hasMore := len(movies) > pageQuery.Limit
+	if hasMore {
+		movies = movies[:pageQuery.Limit]
+	}
+
+	page := &domain.MoviePage{Movies: movies}
+	if pageQuery.Backward {
+		slices.Reverse(page.Movies)
+		page.HasPrevious = hasMore
+		page.HasNext = pageQuery.Before != nil
+	} else {
+		page.HasNext = hasMore
+		page.HasPrevious = pageQuery.After != nil
+	}
+
+	return page, nil
+}
+
+func (repository *MovieRepository) CountMovies(filter domain.MovieFilter) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	countQuery, args := newMovieQueryBuilder().filter(filter).countQuery()
+
+	var count int64
+	err := repository.dbPool.QueryRow(ctx, countQuery, args...).Scan(&count)
+	if err != nil {
+		log.Errorf("error while counting movies: %v", err)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// GetMovieFacets counts the movies per genre, rating, release decade and
+// runtime bucket. Each facet drops the filter's condition on its own dimension
+// so that it shows what selecting another value would yield. Genres matched
+// with GenreMatchAll are the exception: adding a genre narrows the results
+// there, so the genre facet keeps the full filter.
+func (repository *MovieRepository) GetMovieFacets(filter domain.MovieFilter) (*domain.MovieFacets, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	genreFilter := filter
+	if !filter.GenreMatchAll {
+		genreFilter.GenreIds = nil
+	}
+	mpaaRatingFilter := filter
+	mpaaRatingFilter.MPAARatings = nil
+	decadeFilter := filter
+	decadeFilter.ReleaseYearFrom, decadeFilter.ReleaseYearTo = 0, 0
+	runtimeFilter := filter
+	runtimeFilter.RuntimeMin, runtimeFilter.RuntimeMax = 0, 0
+
+	runtimeBoundaries := make([]int64, 0, len(domain.RuntimeBuckets)-1)
+	for _, bucket := range domain.RuntimeBuckets[1:] {
+		runtimeBoundaries = append(runtimeBoundaries, bucket.Min)
+	}
+
+	// The four aggregates are sent in a single batch to save round trips.
+	batch := &pgx.Batch{}
+	genreQuery, genreArgs := newMovieQueryBuilder().filter(genreFilter).groupQuery(
+		"g.id, g.genre", " JOIN movies_genres mg ON mg.movie_id = m.id JOIN genres g ON g.id = mg.genre_id", "g.genre, g.id")
+	batch.Queue(genreQuery, genreArgs...)
+	mpaaRatingQuery, mpaaRatingArgs := newMovieQueryBuilder().filter(mpaaRatingFilter).groupQuery("m.mpaa_rating", "", "m.mpaa_rating")
+	batch.Queue(mpaaRatingQuery, mpaaRatingArgs...)
+	decadeQuery, decadeArgs := newMovieQueryBuilder().filter(decadeFilter).groupQuery(
+		"(EXTRACT(YEAR FROM m.release_date)::integer / 10) * 10", "", "1")
+	batch.Queue(decadeQuery, decadeArgs...)
+	runtimeBuilder := newMovieQueryBuilder().filter(runtimeFilter)
+	runtimeQuery, runtimeArgs := runtimeBuilder.groupQuery(
+		fmt.Sprintf("width_bucket(m.runtime::bigint, %s::bigint[])", runtimeBuilder.arg(runtimeBoundaries)), "", "1")
+	batch.Queue(runtimeQuery, runtimeArgs...)
+
+	results := repository.dbPool.SendBatch(ctx, batch)
+	defer results.Close()
+
+	facets := &domain.MovieFacets{
+		Genres:         []*domain.GenreFacet{},
+		MPAARatings:    []*domain.MPAARatingFacet{},
+		Decades:        []*domain.DecadeFacet{},
+		RuntimeBuckets: []*domain.RuntimeFacet{},
+	}
+
+	err := scanFacetRows(results, func(rows pgx.Rows) error {
+		facet := domain.GenreFacet{}
+		if err := rows.Scan(&facet.Id, &facet.Genre, &facet.Count); err != nil {
+			return err
+		}
+		facets.Genres = append(facets.Genres, &facet)
+		return nil
+	})
+	if err == nil {
+		err = scanFacetRows(results, func(rows pgx.Rows) error {
+			facet := domain.MPAARatingFacet{}
+			if err := rows.Scan(&facet.MPAARating, &facet.Count); err != nil {
+				return err
+			}
+			facets.MPAARatings = append(facets.MPAARatings, &facet)
+			return nil
+		})
+	}
+	if err == nil {
+		err = scanFacetRows(results, func(rows pgx.Rows) error {
+			facet := domain.DecadeFacet{}
+			if err := rows.Scan(&facet.Decade, &facet.Count); err != nil {
+				return err
+			}
+			facets.Decades = append(facets.Decades, &facet)
+			return nil
+		})
+	}
+	if err == nil {
+		err = scanFacetRows(results, func(rows pgx.Rows) error {
+			// width_bucket numbers the ranges from 0 for runtimes below the
+			// first boundary, which lines up with the bucket index.
+			var bucketIndex int
+			var count int64
+			if err := rows.Scan(&bucketIndex, &count); err != nil {
+				return err
+			}
+			bucket := domain.RuntimeBuckets[bucketIndex]
+			facets.RuntimeBuckets = append(facets.RuntimeBuckets, &domain.RuntimeFacet{
+				Label: bucket.Label,
+				Min:   bucket.Min,
+				Max:   bucket.Max,
+				Count: count,
+			})
+			return nil
+		})
+	}
+	if err != nil {
+		log.Errorf("error while getting movie facets: %v", err)
+		return nil, err
+	}
+
+	return facets, nil
+}
+
 func (repository *MovieRepository) GetMovieById(id int64) (*domain.Movie, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
@@ -91,12 +379,15 @@ func (repository *MovieRepository) GetMovieById(id int64) (*domain.Movie, error)
 		&movie.UpdateAt,
 	)
 	if err != nil {
-		log.Errorf("error while getting movie by id: %d", id)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, domain.ErrMovieNotFound
+		}
+		log.Errorf("error while getting movie by id %d: %v", id, err)
 		return nil, err
 	}
 
 	selectGenreQuery := `
-		SELECT genre.id, genre.genre
+		SELECT genre.id, genre.genre, genre.slug
 		FROM movies_genres movie_genre
 		LEFT JOIN genres genre
 		ON movie_genre.genre_id = genre.id
@@ -138,12 +429,15 @@ func (repository *MovieRepository) GetMovieByIdEdit(id int64) (*domain.Movie, er
 		&movie.UpdateAt,
 	)
 	if err != nil {
-		log.Errorf("error while getting movie by id: %d", id)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, domain.ErrMovieNotFound
+		}
+		log.Errorf("error while getting movie by id %d: %v", id, err)
 		return nil, err
 	}
 
 	selectGenreQuery := `
-		SELECT genre.id, genre.genre
+		SELECT genre.id, genre.genre, genre.slug
 		FROM movies_genres movie_genre
 		LEFT JOIN genres genre
 		ON movie_genre.genre_id = genre.id
@@ -174,7 +468,7 @@ func (repository *MovieRepository) GetAllGenres() ([]*domain.Genre, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	selectQuery := `SELECT id, genre FROM genres ORDER BY id`
+	selectQuery := `SELECT id, genre, slug FROM genres ORDER BY id`
 
 	genreRows, err := repository.dbPool.Query(ctx, selectQuery)
 	if err != nil {
@@ -186,6 +480,122 @@ func (repository *MovieRepository) GetAllGenres() ([]*domain.Genre, error) {
 	return extractGenresFromRows(genreRows)
 }
 
+func (repository *MovieRepository) GetGenreById(id int64) (*domain.Genre, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	selectQuery := `SELECT id, genre, slug FROM genres WHERE id = $1`
+
+	var genre domain.Genre
+	err := repository.dbPool.QueryRow(ctx, selectQuery, id).Scan(&genre.Id, &genre.Genre, &genre.Slug)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, domain.ErrGenreNotFound
+		}
+		log.Errorf("error while getting genre by id %d: %v", id, err)
+		return nil, err
+	}
+
+	return &genre, nil
+}
+
+func (repository *MovieRepository) GetGenresByMovieId(movieId int64) ([]*domain.Genre, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	selectQuery := `
+		SELECT genre.id, genre.genre, genre.slug
+		FROM movies_genres movie_genre
+		JOIN genres genre
+		ON movie_genre.genre_id = genre.id
+		WHERE movie_genre.movie_id = $1
+		ORDER BY genre.genre`
+
+	genreRows, err := repository.dbPool.Query(ctx, selectQuery, movieId)
+	if err != nil {
+		log.Errorf("error while getting movie's genres: %v", err)
+		return nil, err
+	}
+	defer genreRows.Close()
+
+	return extractGenresFromRows(genreRows)
+}
+
+func (repository *MovieRepository) GetGenresByMovieIds(movieIds []int64) (map[int64][]*domain.Genre, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	selectQuery := `
+		SELECT movie_genre.movie_id, genre.id, genre.genre, genre.slug
+		FROM movies_genres movie_genre
+		JOIN genres genre
+		ON movie_genre.genre_id = genre.id
+		WHERE movie_genre.movie_id = ANY($1)
+		ORDER BY genre.genre`
+
+	genreRows, err := repository.dbPool.Query(ctx, selectQuery, movieIds)
+	if err != nil {
+		log.Errorf("error while getting genres of movies: %v", err)
+		return nil, err
+	}
+	defer genreRows.Close()
+
+	genresByMovieId := make(map[int64][]*domain.Genre)
+	for genreRows.Next() {
+		var movieId int64
+		genre := domain.Genre{}
+		if err = genreRows.Scan(&movieId, &genre.Id, &genre.Genre, &genre.Slug); err != nil {
+			return nil, err
+		}
+		genresByMovieId[movieId] = append(genresByMovieId[movieId], &genre)
+	}
+
+	return genresByMovieId, genreRows.Err()
+}
+
+func (repository *MovieRepository) GetMoviesByGenreIds(genreIds []int64) (map[int64][]*domain.Movie, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	selectQuery := `
+		SELECT mg.genre_id, m.id, m.title, m.release_date, m.runtime, m.mpaa_rating, m.description, COALESCE(m.image, ''), m.created_at, m.updated_at
+		FROM movies m
+		JOIN movies_genres mg ON m.id = mg.movie_id
+		WHERE mg.genre_id = ANY($1)
+		ORDER BY m.title`
+
+	movieRows, err := repository.dbPool.Query(ctx, selectQuery, genreIds)
+	if err != nil {
+		log.Errorf("error while getting movies of genres: %v", err)
+		return nil, err
+	}
+	defer movieRows.Close()
+
+	moviesByGenreId := make(map[int64][]*domain.Movie)
+	for movieRows.Next() {
+		var genreId int64
+		movie := domain.Movie{}
+		err = movieRows.Scan(
+			&genreId,
+			&movie.Id,
+			&movie.Title,
+			&movie.ReleaseDate,
+			&movie.Runtime,
+			&movie.MPAARating,
+			&movie.Description,
+			&movie.Image,
+			&movie.CreatedAt,
+			&movie.UpdateAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		moviesByGenreId[genreId] = append(moviesByGenreId[genreId], &movie)
+	}
+
+	return moviesByGenreId, movieRows.Err()
+}
+
 func (repository *MovieRepository) AddMovie(movie *domain.Movie) (*domain.Movie, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
@@ -208,7 +618,7 @@ func (repository *MovieRepository) AddMovie(movie *domain.Movie) (*domain.Movie,
 	}
 
 	for _, genreID := range movie.GenresIntArray {
-		_, err = tx.Exec(ctx, "INSERT INTO movies_genres (movie_id, genre_id) VALUES ($1, $2)", movie.Id, genreID)
+		_, err = tx.Exec(ctx, "INSERT INTO movies_genres (movie_id, genre_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", movie.Id, genreID)
 		if err != nil {
 			return nil, err
 		}
@@ -249,7 +659,7 @@ func (repository *MovieRepository) UpdateMovie(movie *domain.Movie) (*domain.Mov
 	}
 
 	for _, genreID := range movie.GenresIntArray {
-		_, err = tx.Exec(ctx, "INSERT INTO movies_genres (movie_id, genre_id) VALUES ($1, $2)", movie.Id, genreID)
+		_, err = tx.Exec(ctx, "INSERT INTO movies_genres (movie_id, genre_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", movie.Id, genreID)
 		if err != nil {
 			return nil, err
 		}
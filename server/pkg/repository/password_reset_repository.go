@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/erkindilekci/cinebase/server/pkg/domain"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/labstack/gommon/log"
+	"time"
+)
+
+type IPasswordResetRepository interface {
+	AddPasswordResetToken(resetToken *domain.PasswordResetToken, issuedBefore time.Time) (bool, error)
+	DeletePasswordResetToken(id int64) error
+	GetPasswordResetUserId(tokenHash string) (int64, error)
+	ResetPassword(tokenHash string, passwordHash string) (int64, error)
+}
+
+type PasswordResetRepository struct {
+	dbPool *pgxpool.Pool
+}
+
+func NewPasswordResetRepository(dbPool *pgxpool.Pool) IPasswordResetRepository {
+	return &PasswordResetRepository{dbPool}
+}
+
+// AddPasswordResetToken stores resetToken in place of the user's unused
+// ones, unless a token was issued to the user after issuedBefore. It reports
+// whether the token was stored; the user's row is locked meanwhile, so the
+// cooldown holds across concurrent requests.
+func (repository *PasswordResetRepository) AddPasswordResetToken(resetToken *domain.PasswordResetToken, issuedBefore time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := repository.dbPool.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	var recentlyIssued bool
+	selectStatement := `SELECT EXISTS (SELECT 1 FROM password_reset_tokens WHERE user_id = u.id AND created_at >= $2)
+		FROM cinebase_users u WHERE u.id = $1 FOR UPDATE`
+	if err = tx.QueryRow(ctx, selectStatement, resetToken.UserId, issuedBefore).Scan(&recentlyIssued); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, domain.ErrUserNotFound
+		}
+		log.Errorf("error while adding password reset token: %v", err)
+		return false, err
+	}
+	if recentlyIssued {
+		return false, nil
+	}
+
+	// Only the latest link works, and expired or used tokens of anyone are
+	// of no further use.
+	deleteStatement := `DELETE FROM password_reset_tokens WHERE (user_id = $1 AND used_at IS NULL) OR expires_at < NOW() OR used_at IS NOT NULL`
+	if _, err = tx.Exec(ctx, deleteStatement, resetToken.UserId); err != nil {
+		log.Errorf("error while removing old password reset tokens: %v", err)
+		return false, err
+	}
+
+	insertStatement := `INSERT INTO password_reset_tokens (user_id, token_hash, expires_at) VALUES ($1, $2, $3) RETURNING id`
+	err = tx.QueryRow(ctx, insertStatement, resetToken.UserId, resetToken.TokenHash, resetToken.ExpiresAt).Scan(&resetToken.Id)
+	if err != nil {
+		log.Errorf("error while adding password reset token: %v", err)
+		return false, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// GetPasswordResetUserId returns the user a token was issued to, or
+// domain.ErrInvalidResetToken for unknown, used or expired tokens.
+func (repository *PasswordResetRepository) GetPasswordResetUserId(tokenHash string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	selectStatement := `SELECT user_id FROM password_reset_tokens WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()`
+
+	var userId int64
+	if err := repository.dbPool.QueryRow(ctx, selectStatement, tokenHash).Scan(&userId); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, domain.ErrInvalidResetToken
+		}
+		log.Errorf("error while getting password reset token: %v", err)
+		return 0, err
+	}
+
+	return userId, nil
+}
+
+// DeletePasswordResetToken removes a token whose link couldn't be mailed, so
+// the user can ask for another one right away.
+func (repository *PasswordResetRepository) DeletePasswordResetToken(id int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	if _, err := repository.dbPool.Exec(ctx, `DELETE FROM password_reset_tokens WHERE id = $1`, id); err != nil {
+		log.Errorf("error while deleting password reset token: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// ResetPassword sets the password of the user the token with tokenHash was
+// issued to and returns the user's id. Following the mailed link proves the
+// email address, so it counts as verified from then on. All of the user's reset tokens are used
+// up, all of their sessions revoked and their API keys deleted, so whoever
+// knew the old password is locked out. domain.ErrInvalidResetToken is returned for unknown, used or
+// expired tokens.
+func (repository *PasswordResetRepository) ResetPassword(tokenHash string, passwordHash string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := repository.dbPool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	selectStatement := `SELECT id, user_id, token_hash, expires_at, used_at FROM password_reset_tokens WHERE token_hash = $1 FOR UPDATE`
+
+	var resetToken domain.PasswordResetToken
+	err = tx.QueryRow(ctx, selectStatement, tokenHash).Scan(
+		&resetToken.Id, &resetToken.UserId, &resetToken.TokenHash, &resetToken.ExpiresAt, &resetToken.UsedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, domain.ErrInvalidResetToken
+		}
+		return 0, err
+	}
+
+	if resetToken.UsedAt != nil || !resetToken.ExpiresAt.After(time.Now()) {
+		return 0, domain.ErrInvalidResetToken
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE cinebase_users
+		SET password = $1, email_verified_at = COALESCE(email_verified_at, NOW()), updated_at = NOW() WHERE id = $2`, passwordHash, resetToken.UserId)
+	if err != nil {
+		log.Errorf("error while resetting password: %v", err)
+		return 0, err
+	}
+
+	statements := append([]string{
+		`UPDATE password_reset_tokens SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL`,
+	}, revokeUserCredentialsStatements...)
+
+	for _, statement := range statements {
+		if _, err = tx.Exec(ctx, statement, resetToken.UserId); err != nil {
+			log.Errorf("error while resetting password: %v", err)
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	return resetToken.UserId, nil
+}
@@ -0,0 +1,228 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/erkindilekci/cinebase/server/pkg/domain"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/labstack/gommon/log"
+	"time"
+)
+
+type ITokenRepository interface {
+	AddRefreshToken(refreshToken *domain.RefreshToken) error
+	RotateRefreshToken(tokenHash string, replacement *domain.RefreshToken) (*domain.RefreshToken, error)
+	GetRefreshTokenByHash(tokenHash string) (*domain.RefreshToken, error)
+	RevokeRefreshTokenFamily(familyId string) error
+	RevokeAccessToken(jti string, expiresAt time.Time) error
+	IsAccessTokenRevoked(jti string) (bool, error)
+}
+
+type TokenRepository struct {
+	dbPool *pgxpool.Pool
+}
+
+func NewTokenRepository(dbPool *pgxpool.Pool) ITokenRepository {
+	return &TokenRepository{dbPool}
+}
+
+const selectRefreshTokenColumns = `id, user_id, family_id, token_hash, access_jti, access_expires_at, expires_at, used_at, revoked_at, mfa`
+
+// revokeFamilyStatements revoke every refresh token of a family together with
+// the access tokens issued alongside them.
+var revokeFamilyStatements = []string{
+	`INSERT INTO revoked_tokens (jti, expires_at)
+		SELECT access_jti, access_expires_at FROM refresh_tokens
+		WHERE family_id = $1 AND access_expires_at > NOW()
+		ON CONFLICT DO NOTHING`,
+	`UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL`,
+}
+
+// revokeUserSessionsStatements do the same for every family of a user.
+var revokeUserSessionsStatements = []string{
+	`INSERT INTO revoked_tokens (jti, expires_at)
+		SELECT access_jti, access_expires_at FROM refresh_tokens
+		WHERE user_id = $1 AND revoked_at IS NULL AND access_expires_at > NOW()
+		ON CONFLICT DO NOTHING`,
+	`UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`,
+}
+
+func (repository *TokenRepository) AddRefreshToken(refreshToken *domain.RefreshToken) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	insertStatement := `INSERT INTO refresh_tokens (user_id, family_id, token_hash, access_jti, access_expires_at, expires_at, mfa)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
+
+	err := repository.dbPool.QueryRow(ctx, insertStatement,
+		refreshToken.UserId, refreshToken.FamilyId, refreshToken.TokenHash,
+		refreshToken.AccessJti, refreshToken.AccessExpiresAt, refreshToken.ExpiresAt, refreshToken.Mfa,
+	).Scan(&refreshToken.Id)
+	if err != nil {
+		log.Errorf("error while adding refresh token: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// RotateRefreshToken marks the token with tokenHash as used and stores
+// replacement in its family. Presenting a token that was already used or
+// revoked is treated as theft: the whole family is revoked and
+// domain.ErrRefreshTokenReused returned. On success the rotated token is
+// returned.
+func (repository *TokenRepository) RotateRefreshToken(tokenHash string, replacement *domain.RefreshToken) (*domain.RefreshToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := repository.dbPool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	selectStatement := `SELECT ` + selectRefreshTokenColumns + ` FROM refresh_tokens WHERE token_hash = $1 FOR UPDATE`
+
+	current, err := scanRefreshToken(tx.QueryRow(ctx, selectStatement, tokenHash))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, domain.ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	if current.UsedAt != nil || current.RevokedAt != nil {
+		for _, statement := range revokeFamilyStatements {
+			if _, err = tx.Exec(ctx, statement, current.FamilyId); err != nil {
+				log.Errorf("error while revoking refresh token family: %v", err)
+				return nil, err
+			}
+		}
+		if err = tx.Commit(ctx); err != nil {
+			return nil, err
+		}
+		log.Warnf("refresh token reuse detected for user %d, revoked session %s", current.UserId, current.FamilyId)
+		return nil, domain.ErrRefreshTokenReused
+	}
+
+	if !current.ExpiresAt.After(time.Now()) {
+		return nil, domain.ErrInvalidRefreshToken
+	}
+
+	if _, err = tx.Exec(ctx, `UPDATE refresh_tokens SET used_at = NOW() WHERE id = $1`, current.Id); err != nil {
+		return nil, err
+	}
+
+	replacement.UserId = current.UserId
+	replacement.FamilyId = current.FamilyId
+	replacement.Mfa = current.Mfa
+
+	insertStatement := `INSERT INTO refresh_tokens (user_id, family_id, token_hash, access_jti, access_expires_at, expires_at, mfa)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
+
+	err = tx.QueryRow(ctx, insertStatement,
+		replacement.UserId, replacement.FamilyId, replacement.TokenHash,
+		replacement.AccessJti, replacement.AccessExpiresAt, replacement.ExpiresAt, replacement.Mfa,
+	).Scan(&replacement.Id)
+	if err != nil {
+		log.Errorf("error while storing rotated refresh token: %v", err)
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return current, nil
+}
+
+func (repository *TokenRepository) GetRefreshTokenByHash(tokenHash string) (*domain.RefreshToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	selectStatement := `SELECT ` + selectRefreshTokenColumns + ` FROM refresh_tokens WHERE token_hash = $1`
+
+	refreshToken, err := scanRefreshToken(repository.dbPool.QueryRow(ctx, selectStatement, tokenHash))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, domain.ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	return refreshToken, nil
+}
+
+func (repository *TokenRepository) RevokeRefreshTokenFamily(familyId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := repository.dbPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, statement := range revokeFamilyStatements {
+		if _, err = tx.Exec(ctx, statement, familyId); err != nil {
+			log.Errorf("error while revoking refresh token family: %v", err)
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (repository *TokenRepository) RevokeAccessToken(jti string, expiresAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	insertStatement := `INSERT INTO revoked_tokens (jti, expires_at) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+
+	if _, err := repository.dbPool.Exec(ctx, insertStatement, jti, expiresAt); err != nil {
+		log.Errorf("error while revoking access token: %v", err)
+		return err
+	}
+
+	// Revoked tokens only need to be remembered until they would expire anyway.
+	if _, err := repository.dbPool.Exec(ctx, `DELETE FROM revoked_tokens WHERE expires_at < NOW()`); err != nil {
+		log.Errorf("error while removing expired revoked tokens: %v", err)
+	}
+
+	return nil
+}
+
+func (repository *TokenRepository) IsAccessTokenRevoked(jti string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var revoked bool
+	err := repository.dbPool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)`, jti).Scan(&revoked)
+	if err != nil {
+		log.Errorf("error while checking access token revocation: %v", err)
+		return false, err
+	}
+
+	return revoked, nil
+}
+
+func scanRefreshToken(row pgx.Row) (*domain.RefreshToken, error) {
+	var refreshToken domain.RefreshToken
+	err := row.Scan(
+		&refreshToken.Id,
+		&refreshToken.UserId,
+		&refreshToken.FamilyId,
+		&refreshToken.TokenHash,
+		&refreshToken.AccessJti,
+		&refreshToken.AccessExpiresAt,
+		&refreshToken.ExpiresAt,
+		&refreshToken.UsedAt,
+		&refreshToken.RevokedAt,
+		&refreshToken.Mfa,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &refreshToken, nil
+}
@@ -3,15 +3,25 @@ package repository
 import (
 	"context"
 	"errors"
-	"fmt"
 	"github.com/erkindilekci/cinebase/server/pkg/domain"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/labstack/gommon/log"
+	"time"
 )
 
+const selectUserColumns = "id, email, password, role, email_verified_at, totp_confirmed_at IS NOT NULL"
+
 type IUserRepository interface {
 	GetUserByEmail(email string) (*domain.User, error)
+	GetUserById(id int64) (*domain.User, error)
 	SignUp(user *domain.User) error
+	UpdatePasswordHash(id int64, oldHash string, newHash string) error
+	UpdateUserRole(id int64, role domain.Role) (*domain.User, error)
+	PromoteFirstAdmin(email string) (bool, error)
+	MarkEmailVerified(id int64, email string) error
+	ClaimVerificationMail(id int64, sentBefore time.Time) (bool, error)
+	ReleaseVerificationMail(id int64) error
 }
 
 type UserRepository struct {
@@ -28,15 +38,32 @@ func (repository *UserRepository) GetUserByEmail(email string) (*domain.User, er
 
 	var user domain.User
 
-	selectStatement := "SELECT id, email, password FROM cinebase_users WHERE email = $1"
+	selectStatement := "SELECT " + selectUserColumns + " FROM cinebase_users WHERE email = $1"
 	userRow := repository.dbPool.QueryRow(ctx, selectStatement, email)
 
-	err := userRow.Scan(&user.Id, &user.Email, &user.Password)
-	if err != nil && err.Error() == "no rows in result set" {
-		return nil, errors.New("error while finding user")
+	err := userRow.Scan(&user.Id, &user.Email, &user.Password, &user.Role, &user.EmailVerifiedAt, &user.MfaEnabled)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, domain.ErrUserNotFound
+		}
+		return nil, err
 	}
 
+	return &user, nil
+}
+
+func (repository *UserRepository) GetUserById(id int64) (*domain.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var user domain.User
+
+	selectStatement := "SELECT " + selectUserColumns + " FROM cinebase_users WHERE id = $1"
+	err := repository.dbPool.QueryRow(ctx, selectStatement, id).Scan(&user.Id, &user.Email, &user.Password, &user.Role, &user.EmailVerifiedAt, &user.MfaEnabled)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, domain.ErrUserNotFound
+		}
 		return nil, err
 	}
 
@@ -47,14 +74,170 @@ func (repository *UserRepository) SignUp(user *domain.User) error {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	insertStatement := "INSERT INTO cinebase_users(email, password) VALUES ($1, $2)"
+	insertStatement := "INSERT INTO cinebase_users(email, password, role) VALUES ($1, $2, $3) RETURNING id"
 
-	addNewUser, err := repository.dbPool.Exec(ctx, insertStatement, user.Email, user.Password)
+	err := repository.dbPool.QueryRow(ctx, insertStatement, user.Email, user.Password, user.Role).Scan(&user.Id)
 	if err != nil {
+		if isUniqueViolation(err) {
+			return domain.ErrEmailTaken
+		}
 		log.Errorf("error while adding new user: %v", err)
 		return err
 	}
 
-	log.Info(fmt.Sprint("User added successfully: %v", addNewUser))
+	log.Infof("User added successfully: %d", user.Id)
+	return nil
+}
+
+// UpdatePasswordHash replaces the password hash of a user with a new hash of
+// the same password. It does nothing when the password was changed since
+// oldHash was read.
+func (repository *UserRepository) UpdatePasswordHash(id int64, oldHash string, newHash string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err := repository.dbPool.Exec(ctx, "UPDATE cinebase_users SET password = $3, updated_at = NOW() WHERE id = $1 AND password = $2", id, oldHash, newHash)
+	return err
+}
+
+// UpdateUserRole changes a user's role, revokes their sessions, whose tokens
+// still carry the old role, and deletes their API keys, which were created
+// under it. It refuses to demote the only remaining
+// admin so the application can't lock itself out.
+func (repository *UserRepository) UpdateUserRole(id int64, role domain.Role) (*domain.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := repository.dbPool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Locking the admins serializes concurrent demotions.
+	if _, err = tx.Exec(ctx, "SELECT id FROM cinebase_users WHERE role = 'admin' FOR UPDATE"); err != nil {
+		return nil, err
+	}
+
+	var previousRole domain.Role
+	err = tx.QueryRow(ctx, "SELECT role FROM cinebase_users WHERE id = $1 FOR UPDATE", id).Scan(&previousRole)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, domain.ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	var user domain.User
+	updateStatement := `UPDATE cinebase_users SET role = $1, updated_at = NOW() WHERE id = $2 RETURNING id, email, role`
+
+	err = tx.QueryRow(ctx, updateStatement, role, id).Scan(&user.Id, &user.Email, &user.Role)
+	if err != nil {
+		log.Errorf("error while updating user role: %v", err)
+		return nil, err
+	}
+
+	// Sessions carry the role in their claims, so they end with it, and so
+	// do the keys created under it.
+	if previousRole != role {
+		for _, statement := range revokeUserCredentialsStatements {
+			if _, err = tx.Exec(ctx, statement, id); err != nil {
+				log.Errorf("error while revoking credentials after a role change: %v", err)
+				return nil, err
+			}
+		}
+	}
+
+	var hasAdmin bool
+	err = tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM cinebase_users WHERE role = 'admin')").Scan(&hasAdmin)
+	if err != nil {
+		return nil, err
+	}
+	if !hasAdmin {
+		return nil, domain.ErrLastAdmin
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// PromoteFirstAdmin makes the user with the given email an admin, but only
+// once the email is verified and while there is no admin yet. It reports
+// whether the user was promoted.
+func (repository *UserRepository) PromoteFirstAdmin(email string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	updateStatement := `UPDATE cinebase_users SET role = 'admin', updated_at = NOW()
+		WHERE email = $1 AND email_verified_at IS NOT NULL
+		AND NOT EXISTS (SELECT 1 FROM cinebase_users WHERE role = 'admin')`
+
+	commandTag, err := repository.dbPool.Exec(ctx, updateStatement, email)
+	if err != nil {
+		log.Errorf("error while promoting the first admin: %v", err)
+		return false, err
+	}
+
+	return commandTag.RowsAffected() > 0, nil
+}
+
+// MarkEmailVerified records that the user owns email. It fails with
+// domain.ErrInvalidVerificationToken when the user has since changed their
+// email or no longer exists; verifying twice is harmless.
+func (repository *UserRepository) MarkEmailVerified(id int64, email string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	updateStatement := `UPDATE cinebase_users SET email_verified_at = COALESCE(email_verified_at, NOW()), updated_at = NOW()
+		WHERE id = $1 AND email = $2`
+
+	commandTag, err := repository.dbPool.Exec(ctx, updateStatement, id, email)
+	if err != nil {
+		log.Errorf("error while marking email verified: %v", err)
+		return err
+	}
+	if commandTag.RowsAffected() == 0 {
+		return domain.ErrInvalidVerificationToken
+	}
+
+	return nil
+}
+
+// ClaimVerificationMail records that a verification mail is being sent to an
+// unverified user, unless one was already sent after sentBefore. It reports
+// whether the mail may be sent, which makes the cooldown hold across
+// concurrent requests.
+func (repository *UserRepository) ClaimVerificationMail(id int64, sentBefore time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	updateStatement := `UPDATE cinebase_users SET verification_sent_at = NOW()
+		WHERE id = $1 AND email_verified_at IS NULL AND (verification_sent_at IS NULL OR verification_sent_at < $2)`
+
+	commandTag, err := repository.dbPool.Exec(ctx, updateStatement, id, sentBefore)
+	if err != nil {
+		log.Errorf("error while recording verification mail: %v", err)
+		return false, err
+	}
+
+	return commandTag.RowsAffected() > 0, nil
+}
+
+// ReleaseVerificationMail forgets the verification mail claimed for a user
+// when it couldn't be sent, so they can ask for another one right away.
+func (repository *UserRepository) ReleaseVerificationMail(id int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	updateStatement := "UPDATE cinebase_users SET verification_sent_at = NULL WHERE id = $1 AND email_verified_at IS NULL"
+
+	if _, err := repository.dbPool.Exec(ctx, updateStatement, id); err != nil {
+		log.Errorf("error while releasing verification mail: %v", err)
+		return err
+	}
+
 	return nil
 }
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/erkindilekci/cinebase/server/pkg/domain"
+	"github.com/erkindilekci/cinebase/server/pkg/repository"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/gommon/log"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	apiKeyPrefix = "cb_"
+	// apiKeyPrefixSize and apiKeySecretSize are in random bytes.
+	apiKeyPrefixSize = 6
+	apiKeySecretSize = 32
+	// apiKeyTouchInterval is how precisely the last use of a key is tracked.
+	apiKeyTouchInterval = time.Minute
+)
+
+type ApiKeyConfig struct {
+	// MaxPerUser bounds the number of keys a user can have.
+	MaxPerUser int
+}
+
+type IApiKeyService interface {
+	Create(userId int64, name string, scopes []domain.Scope, expiresAt *time.Time, mfa bool) (*domain.ApiKey, string, error)
+	List(userId int64) ([]*domain.ApiKey, error)
+	Revoke(userId int64, id int64) error
+	AuthenticateApiKey(key string) (*domain.Claims, error)
+}
+
+type ApiKeyService struct {
+	apiKeyRepository repository.IApiKeyRepository
+	config           ApiKeyConfig
+}
+
+func NewApiKeyService(apiKeyRepository repository.IApiKeyRepository, config ApiKeyConfig) IApiKeyService {
+	return &ApiKeyService{apiKeyRepository, config}
+}
+
+// Create generates a key for the user and returns it with its plain text,
+// which is only stored hashed and can't be shown again. mfa tells whether the
+// session creating it passed a second factor.
+func (service *ApiKeyService) Create(userId int64, name string, scopes []domain.Scope, expiresAt *time.Time, mfa bool) (*domain.ApiKey, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > 100 {
+		return nil, "", domain.ErrInvalidApiKeyName
+	}
+	if len(scopes) == 0 {
+		return nil, "", domain.ErrInvalidScope
+	}
+	for _, scope := range scopes {
+		if !scope.IsValid() {
+			return nil, "", domain.ErrInvalidScope
+		}
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, "", domain.ErrInvalidApiKeyExpiry
+	}
+
+	prefix, err := randomHex(apiKeyPrefixSize)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := randomToken(apiKeySecretSize)
+	if err != nil {
+		return nil, "", err
+	}
+	plainKey := apiKeyPrefix + prefix + "_" + secret
+
+	apiKey := &domain.ApiKey{
+		UserId:    userId,
+		Name:      name,
+		Prefix:    prefix,
+		KeyHash:   hashToken(plainKey),
+		Scopes:    scopes,
+		Mfa:       mfa,
+		ExpiresAt: expiresAt,
+	}
+	if err = service.apiKeyRepository.AddApiKey(apiKey, service.config.MaxPerUser); err != nil {
+		return nil, "", err
+	}
+
+	return apiKey, plainKey, nil
+}
+
+func (service *ApiKeyService) List(userId int64) ([]*domain.ApiKey, error) {
+	return service.apiKeyRepository.GetApiKeysByUser(userId)
+}
+
+func (service *ApiKeyService) Revoke(userId int64, id int64) error {
+	return service.apiKeyRepository.DeleteApiKey(userId, id)
+}
+
+// AuthenticateApiKey returns claims for the owner of key, with the owner's
+// current role and the key's scopes. Unknown, mismatching and expired keys
+// all fail with domain.ErrInvalidApiKey.
+func (service *ApiKeyService) AuthenticateApiKey(key string) (*domain.Claims, error) {
+	prefix, ok := parseApiKeyPrefix(key)
+	if !ok {
+		return nil, domain.ErrInvalidApiKey
+	}
+
+	apiKey, user, err := service.apiKeyRepository.GetApiKeyByPrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(apiKey.KeyHash), []byte(hashToken(key))) != 1 {
+		return nil, domain.ErrInvalidApiKey
+	}
+
+	now := time.Now()
+	if apiKey.IsExpired(now) {
+		return nil, domain.ErrInvalidApiKey
+	}
+
+	// A failure to track the use shouldn't fail the request.
+	if err = service.apiKeyRepository.TouchApiKey(apiKey.Id, now.Add(-apiKeyTouchInterval)); err != nil {
+		log.Errorf("error while recording API key use: %v", err)
+	}
+
+	authMethods := []string{domain.AuthMethodApiKey}
+	if apiKey.Mfa {
+		authMethods = append(authMethods, domain.AuthMethodOtp)
+	}
+
+	claims := &domain.Claims{
+		Email:         user.Email,
+		Role:          user.Role,
+		EmailVerified: user.IsEmailVerified(),
+		AuthMethods:   authMethods,
+		ApiKeyId:      apiKey.Id,
+		Scopes:        apiKey.Scopes,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject: fmt.Sprint(user.Id),
+		},
+	}
+
+	return claims, nil
+}
+
+// parseApiKeyPrefix returns the prefix of a key shaped like
+// cb_<prefix>_<secret>.
+func parseApiKeyPrefix(key string) (string, bool) {
+	rest, ok := strings.CutPrefix(key, apiKeyPrefix)
+	if !ok {
+		return "", false
+	}
+	prefix, secret, ok := strings.Cut(rest, "_")
+	if !ok || len(prefix) != hex.EncodedLen(apiKeyPrefixSize) || secret == "" {
+		return "", false
+	}
+	return prefix, true
+}
+
+func randomHex(size int) (string, error) {
+	buffer := make([]byte, size)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", errors.New("error while generating a random token")
+	}
+	return hex.EncodeToString(buffer), nil
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"fmt"
+	"github.com/erkindilekci/cinebase/server/pkg/domain"
+	"sync"
+)
+
+// autocompleteCache keeps the suggestions of recently typed prefixes in memory.
+// Entries are evicted oldest first once the cache is full, and the whole cache
+// is dropped whenever a movie is written so titles never go stale.
+type autocompleteCache struct {
+	mu      sync.RWMutex
+	size    int
+	entries map[string][]*domain.MovieSuggestion
+	order   []string
+	// generation is bumped on every invalidation so lookups that raced with a
+	// movie write don't put their outdated result back.
+	generation uint64
+}
+
+func newAutocompleteCache(size int) *autocompleteCache {
+	if size <= 0 {
+		return nil
+	}
+	return &autocompleteCache{size: size, entries: make(map[string][]*domain.MovieSuggestion)}
+}
+
+func autocompleteCacheKey(prefix string, limit int) string {
+	return fmt.Sprintf("%d:%s", limit, prefix)
+}
+
+func (cache *autocompleteCache) get(key string) ([]*domain.MovieSuggestion, uint64, bool) {
+	if cache == nil {
+		return nil, 0, false
+	}
+
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+
+	suggestions, ok := cache.entries[key]
+	return suggestions, cache.generation, ok
+}
+
+func (cache *autocompleteCache) put(key string, suggestions []*domain.MovieSuggestion, generation uint64) {
+	if cache == nil {
+		return
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if generation != cache.generation {
+		return
+	}
+
+	if _, ok := cache.entries[key]; ok {
+		cache.entries[key] = suggestions
+		return
+	}
+
+	if len(cache.order) >= cache.size {
+		oldest := cache.order[0]
+		cache.order = cache.order[1:]
+		delete(cache.entries, oldest)
+	}
+
+	cache.entries[key] = suggestions
+	cache.order = append(cache.order, key)
+}
+
+func (cache *autocompleteCache) invalidate() {
+	if cache == nil {
+		return
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.entries = make(map[string][]*domain.MovieSuggestion)
+	cache.order = nil
+	cache.generation++
+}
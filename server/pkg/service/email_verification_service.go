@@ -0,0 +1,169 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/erkindilekci/cinebase/server/pkg/commmon/mail"
+	"github.com/erkindilekci/cinebase/server/pkg/commmon/signing"
+	"github.com/erkindilekci/cinebase/server/pkg/domain"
+	"github.com/erkindilekci/cinebase/server/pkg/repository"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/gommon/log"
+	"strconv"
+	"time"
+)
+
+// verificationAudience keeps verification links and access tokens, which are
+// signed with the same keys, from being accepted in place of each other.
+const verificationAudience = "cinebase-email-verification"
+
+type EmailVerificationConfig struct {
+	Policy domain.VerificationPolicy
+	// TokenTTL is how long a verification link can be used.
+	TokenTTL time.Duration
+	// ResendCooldown is the minimum time between two verification mails.
+	ResendCooldown time.Duration
+	// VerifyURL is the client page the link points to; the token is appended
+	// as the token query parameter.
+	VerifyURL string
+	// Issuer is put in the iss claim of verification tokens.
+	Issuer string
+	// BootstrapAdminEmail is promoted to the first admin when it is verified
+	// while there is no admin yet.
+	BootstrapAdminEmail string
+}
+
+type IEmailVerificationService interface {
+	SendVerification(user *domain.User) error
+	Resend(email string) error
+	Verify(token string) error
+	CheckLogin(user *domain.User) error
+}
+
+type EmailVerificationService struct {
+	userRepository repository.IUserRepository
+	keySet         *signing.KeySet
+	mailQueue      *mail.Queue
+	config         EmailVerificationConfig
+}
+
+type verificationClaims struct {
+	Email string `json:"email"`
+	jwt.RegisteredClaims
+}
+
+func NewEmailVerificationService(userRepository repository.IUserRepository, keySet *signing.KeySet, mailQueue *mail.Queue, config EmailVerificationConfig) IEmailVerificationService {
+	if normalizedEmail, err := normalizeEmail(config.BootstrapAdminEmail); err == nil {
+		config.BootstrapAdminEmail = normalizedEmail
+	}
+	return &EmailVerificationService{userRepository, keySet, mailQueue, config}
+}
+
+// SendVerification mails user a link proving they own their email address,
+// unless they are verified already or the cooldown hasn't passed.
+func (service *EmailVerificationService) SendVerification(user *domain.User) error {
+	if user.IsEmailVerified() {
+		return nil
+	}
+
+	claimed, err := service.userRepository.ClaimVerificationMail(user.Id, time.Now().Add(-service.config.ResendCooldown))
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return nil
+	}
+
+	now := time.Now()
+	claims := &verificationClaims{
+		Email: user.Email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    service.config.Issuer,
+			Audience:  jwt.ClaimStrings{verificationAudience},
+			Subject:   fmt.Sprint(user.Id),
+			ExpiresAt: jwt.NewNumericDate(now.Add(service.config.TokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+
+	token, err := service.keySet.Sign(claims)
+	if err != nil {
+		return errors.New("error signing the verification token: " + err.Error())
+	}
+
+	message := mail.Message{
+		To:      user.Email,
+		Subject: "Verify your Cinebase email address",
+		Body: fmt.Sprintf("Welcome to Cinebase!\n\n"+
+			"Open this link within %s to verify your email address:\n%s\n\n"+
+			"If you didn't sign up, you can ignore this email.", service.config.TokenTTL, tokenLink(service.config.VerifyURL, token)),
+	}
+	service.mailQueue.Enqueue(message, func(error) {
+		// A mail that never arrived mustn't hold up the next one.
+		if err := service.userRepository.ReleaseVerificationMail(user.Id); err != nil {
+			log.Errorf("error while releasing the verification mail cooldown: %v", err)
+		}
+	})
+
+	return nil
+}
+
+// Resend sends a new verification link to email. Like a password reset request
+// it quietly does nothing for unknown or verified emails and during the
+// cooldown, so it can't be used to find out who has an account.
+func (service *EmailVerificationService) Resend(email string) error {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return err
+	}
+
+	user, err := service.userRepository.GetUserByEmail(email)
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	return service.SendVerification(user)
+}
+
+// Verify marks the email in a verification link as verified. The link only
+// works while the account still has that email.
+func (service *EmailVerificationService) Verify(token string) error {
+	claims := &verificationClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, service.keySet.Keyfunc,
+		jwt.WithValidMethods(service.keySet.Methods()),
+		jwt.WithIssuer(service.config.Issuer),
+		jwt.WithAudience(verificationAudience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return domain.ErrInvalidVerificationToken
+	}
+
+	userId, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil || claims.Email == "" {
+		return domain.ErrInvalidVerificationToken
+	}
+
+	if err = service.userRepository.MarkEmailVerified(userId, claims.Email); err != nil {
+		return err
+	}
+
+	// The email is verified either way; the promotion is retried at startup.
+	if claims.Email == service.config.BootstrapAdminEmail {
+		if err = promoteFirstAdmin(service.userRepository, claims.Email); err != nil {
+			log.Errorf("error while promoting the first admin: %v", err)
+		}
+	}
+	return nil
+}
+
+// CheckLogin refuses unverified users under the login policy.
+func (service *EmailVerificationService) CheckLogin(user *domain.User) error {
+	if service.config.Policy == domain.VerificationPolicyLogin && !user.IsEmailVerified() {
+		return domain.ErrEmailNotVerified
+	}
+	return nil
+}
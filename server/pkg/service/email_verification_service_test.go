@@ -0,0 +1,105 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/erkindilekci/cinebase/server/pkg/commmon/signing"
+	"github.com/erkindilekci/cinebase/server/pkg/domain"
+	"github.com/golang-jwt/jwt/v5"
+	"testing"
+	"time"
+)
+
+const testIssuer = "https://cinebase.test"
+
+func newTestEmailVerificationService(t *testing.T, userRepository *fakeUserRepository, mailer *recordingMailer, bootstrapAdminEmail string) (IEmailVerificationService, *signing.KeySet) {
+	t.Helper()
+
+	keySet, err := signing.NewEphemeralKeySet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := EmailVerificationConfig{
+		Policy:              domain.VerificationPolicyWrite,
+		TokenTTL:            time.Hour,
+		ResendCooldown:      time.Minute,
+		VerifyURL:           "http://client.test/verify-email",
+		Issuer:              testIssuer,
+		BootstrapAdminEmail: bootstrapAdminEmail,
+	}
+	return NewEmailVerificationService(userRepository, keySet, newTestMailQueue(t, mailer), config), keySet
+}
+
+func verificationToken(t *testing.T, keySet *signing.KeySet, user *domain.User) string {
+	t.Helper()
+
+	now := time.Now()
+	token, err := keySet.Sign(&verificationClaims{
+		Email: user.Email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    testIssuer,
+			Subject:   fmt.Sprint(user.Id),
+			Audience:  jwt.ClaimStrings{verificationAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestVerifyingTheBootstrapEmailPromotesTheFirstAdmin(t *testing.T) {
+	bootstrap := &domain.User{Id: 1, Email: "owner@example.com", Role: domain.RoleViewer}
+	other := &domain.User{Id: 2, Email: "someone@example.com", Role: domain.RoleViewer}
+	userRepository := newFakeUserRepository(bootstrap, other)
+	verificationService, keySet := newTestEmailVerificationService(t, userRepository, &recordingMailer{}, " Owner@Example.com ")
+
+	// An unverified bootstrap account isn't promoted at startup.
+	if err := promoteFirstAdmin(userRepository, "owner@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if role := userRepository.user(1).Role; role != domain.RoleViewer {
+		t.Fatalf("unverified bootstrap account has role %s, want viewer", role)
+	}
+
+	if err := verificationService.Verify(verificationToken(t, keySet, other)); err != nil {
+		t.Fatal(err)
+	}
+	if role := userRepository.user(2).Role; role != domain.RoleViewer {
+		t.Errorf("verifying another account made it %s, want viewer", role)
+	}
+
+	if err := verificationService.Verify(verificationToken(t, keySet, bootstrap)); err != nil {
+		t.Fatal(err)
+	}
+	if role := userRepository.user(1).Role; role != domain.RoleAdmin {
+		t.Errorf("verified bootstrap account has role %s, want admin", role)
+	}
+}
+
+func TestFailedVerificationMailReleasesTheCooldown(t *testing.T) {
+	user := &domain.User{Id: 1, Email: "jane@example.com", Role: domain.RoleViewer}
+	userRepository := newFakeUserRepository(user)
+	mailer := &recordingMailer{err: errors.New("connection refused")}
+	keySet, err := signing.NewEphemeralKeySet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mailQueue := newTestMailQueue(t, mailer)
+	config := EmailVerificationConfig{TokenTTL: time.Hour, ResendCooldown: time.Hour, VerifyURL: "http://client.test/verify-email", Issuer: testIssuer}
+	verificationService := NewEmailVerificationService(userRepository, keySet, mailQueue, config)
+
+	if err := verificationService.SendVerification(user); err != nil {
+		t.Fatal(err)
+	}
+	drainMail(t, mailQueue)
+
+	if claimed, _ := userRepository.ClaimVerificationMail(user.Id, time.Now().Add(-time.Hour)); !claimed {
+		t.Error("the cooldown of a mail that failed to send still holds")
+	}
+	if claimed, _ := userRepository.ClaimVerificationMail(user.Id, time.Now().Add(-time.Hour)); claimed {
+		t.Error("the cooldown doesn't hold after a claimed mail")
+	}
+}
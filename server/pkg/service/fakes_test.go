@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"github.com/erkindilekci/cinebase/server/pkg/commmon/mail"
+	"github.com/erkindilekci/cinebase/server/pkg/domain"
+	"github.com/erkindilekci/cinebase/server/pkg/repository"
+	"net/url"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeUserRepository keeps users in memory. Methods the tests don't need
+// panic through the nil embedded interface.
+type fakeUserRepository struct {
+	repository.IUserRepository
+
+	mu                 sync.Mutex
+	users              map[int64]*domain.User
+	verificationSentAt map[int64]time.Time
+}
+
+func newFakeUserRepository(users ...*domain.User) *fakeUserRepository {
+	userRepository := &fakeUserRepository{users: make(map[int64]*domain.User), verificationSentAt: make(map[int64]time.Time)}
+	for _, user := range users {
+		userRepository.users[user.Id] = user
+	}
+	return userRepository
+}
+
+func (userRepository *fakeUserRepository) user(id int64) domain.User {
+	userRepository.mu.Lock()
+	defer userRepository.mu.Unlock()
+	return *userRepository.users[id]
+}
+
+func (userRepository *fakeUserRepository) GetUserById(id int64) (*domain.User, error) {
+	userRepository.mu.Lock()
+	defer userRepository.mu.Unlock()
+
+	user, ok := userRepository.users[id]
+	if !ok {
+		return nil, domain.ErrUserNotFound
+	}
+	found := *user
+	return &found, nil
+}
+
+func (userRepository *fakeUserRepository) GetUserByEmail(email string) (*domain.User, error) {
+	userRepository.mu.Lock()
+	defer userRepository.mu.Unlock()
+
+	for _, user := range userRepository.users {
+		if user.Email == email {
+			found := *user
+			return &found, nil
+		}
+	}
+	return nil, domain.ErrUserNotFound
+}
+
+func (userRepository *fakeUserRepository) MarkEmailVerified(id int64, email string) error {
+	userRepository.mu.Lock()
+	defer userRepository.mu.Unlock()
+
+	user, ok := userRepository.users[id]
+	if !ok || user.Email != email {
+		return domain.ErrInvalidVerificationToken
+	}
+	if user.EmailVerifiedAt == nil {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+	return nil
+}
+
+func (userRepository *fakeUserRepository) UpdateUserRole(id int64, role domain.Role) (*domain.User, error) {
+	userRepository.mu.Lock()
+	defer userRepository.mu.Unlock()
+
+	user, ok := userRepository.users[id]
+	if !ok {
+		return nil, domain.ErrUserNotFound
+	}
+	user.Role = role
+	updated := *user
+	return &updated, nil
+}
+
+func (userRepository *fakeUserRepository) PromoteFirstAdmin(email string) (bool, error) {
+	userRepository.mu.Lock()
+	defer userRepository.mu.Unlock()
+
+	var candidate *domain.User
+	for _, user := range userRepository.users {
+		if user.Role == domain.RoleAdmin {
+			return false, nil
+		}
+		if user.Email == email && user.IsEmailVerified() {
+			candidate = user
+		}
+	}
+	if candidate == nil {
+		return false, nil
+	}
+	candidate.Role = domain.RoleAdmin
+	return true, nil
+}
+
+func (userRepository *fakeUserRepository) ClaimVerificationMail(id int64, sentBefore time.Time) (bool, error) {
+	userRepository.mu.Lock()
+	defer userRepository.mu.Unlock()
+
+	user, ok := userRepository.users[id]
+	if !ok || user.IsEmailVerified() {
+		return false, nil
+	}
+	if sentAt, sent := userRepository.verificationSentAt[id]; sent && !sentAt.Before(sentBefore) {
+		return false, nil
+	}
+	userRepository.verificationSentAt[id] = time.Now()
+	return true, nil
+}
+
+func (userRepository *fakeUserRepository) ReleaseVerificationMail(id int64) error {
+	userRepository.mu.Lock()
+	defer userRepository.mu.Unlock()
+
+	delete(userRepository.verificationSentAt, id)
+	return nil
+}
+
+// recordingMailer keeps the messages it is asked to send, and fails them all
+// while err is set.
+type recordingMailer struct {
+	mu       sync.Mutex
+	messages []mail.Message
+	err      error
+}
+
+func (mailer *recordingMailer) Send(_ context.Context, message mail.Message) error {
+	mailer.mu.Lock()
+	defer mailer.mu.Unlock()
+
+	if mailer.err != nil {
+		return mailer.err
+	}
+	mailer.messages = append(mailer.messages, message)
+	return nil
+}
+
+func (mailer *recordingMailer) sent() []mail.Message {
+	mailer.mu.Lock()
+	defer mailer.mu.Unlock()
+	return append([]mail.Message(nil), mailer.messages...)
+}
+
+// newTestMailQueue returns a queue sending through mailer that is drained
+// when the test ends.
+func newTestMailQueue(t *testing.T, mailer mail.Mailer) *mail.Queue {
+	t.Helper()
+
+	mailQueue := mail.NewQueue(mailer, 1, 10, time.Second)
+	t.Cleanup(func() { mailQueue.Close(context.Background()) })
+	return mailQueue
+}
+
+// drainMail waits until everything queued on mailQueue has been handled.
+func drainMail(t *testing.T, mailQueue *mail.Queue) {
+	t.Helper()
+
+	if err := mailQueue.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitForMail waits until mailer has sent count messages and returns them.
+func waitForMail(t *testing.T, mailer *recordingMailer, count int) []mail.Message {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		messages := mailer.sent()
+		if len(messages) >= count {
+			return messages
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d messages were sent, want %d", len(messages), count)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+var linkTokenPattern = regexp.MustCompile(`[?&]token=([^&\s]+)`)
+
+// linkToken returns the token of the link in a mailed message.
+func linkToken(t *testing.T, message mail.Message) string {
+	t.Helper()
+
+	match := linkTokenPattern.FindStringSubmatch(message.Body)
+	if match == nil {
+		t.Fatalf("no link with a token in %q", message.Body)
+	}
+	token, err := url.QueryUnescape(match[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
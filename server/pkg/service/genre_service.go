@@ -0,0 +1,104 @@
+package service
+
+import (
+	"fmt"
+	"github.com/erkindilekci/cinebase/server/pkg/domain"
+	"github.com/erkindilekci/cinebase/server/pkg/repository"
+	"golang.org/x/text/unicode/norm"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const maxGenreNameLength = 255
+
+type IGenreService interface {
+	AddGenre(name string) (*domain.Genre, error)
+	RenameGenre(id int64, name string) (*domain.Genre, error)
+	MergeGenres(sourceId int64, targetId int64) (*domain.Genre, error)
+	DeleteGenre(id int64, reassignToId int64) error
+}
+
+type GenreService struct {
+	genreRepository repository.IGenreRepository
+}
+
+func NewGenreService(genreRepository repository.IGenreRepository) IGenreService {
+	return &GenreService{genreRepository}
+}
+
+func (service *GenreService) AddGenre(name string) (*domain.Genre, error) {
+	genre, err := newGenre(name)
+	if err != nil {
+		return nil, err
+	}
+	return service.genreRepository.AddGenre(genre)
+}
+
+func (service *GenreService) RenameGenre(id int64, name string) (*domain.Genre, error) {
+	genre, err := newGenre(name)
+	if err != nil {
+		return nil, err
+	}
+	genre.Id = id
+	return service.genreRepository.UpdateGenre(genre)
+}
+
+func (service *GenreService) MergeGenres(sourceId int64, targetId int64) (*domain.Genre, error) {
+	if sourceId == targetId {
+		return nil, fmt.Errorf("%w: a genre can't be merged into itself", domain.ErrInvalidGenre)
+	}
+	return service.genreRepository.MergeGenres(sourceId, targetId)
+}
+
+// DeleteGenre deletes a genre. Its movies are moved to the reassignToId genre
+// first when one is given, otherwise the genre must not have any movies left.
+func (service *GenreService) DeleteGenre(id int64, reassignToId int64) error {
+	if reassignToId > 0 {
+		_, err := service.MergeGenres(id, reassignToId)
+		return err
+	}
+	return service.genreRepository.DeleteGenreById(id)
+}
+
+func newGenre(name string) (*domain.Genre, error) {
+	name = strings.Join(strings.Fields(name), " ")
+	if name == "" {
+		return nil, fmt.Errorf("%w: genre name can't be empty", domain.ErrInvalidGenre)
+	}
+	if utf8.RuneCountInString(name) > maxGenreNameLength {
+		return nil, fmt.Errorf("%w: genre name can't be longer than 255 characters", domain.ErrInvalidGenre)
+	}
+
+	slug := slugify(name)
+	if slug == "" {
+		return nil, fmt.Errorf("%w: genre name must contain at least one latin letter or digit", domain.ErrInvalidGenre)
+	}
+
+	return &domain.Genre{Genre: name, Slug: slug}, nil
+}
+
+// slugify turns a genre name into its URL form, e.g. "Sci-Fi & Fantasy"
+// becomes "sci-fi-fantasy". Accents are stripped and every other run of
+// characters that aren't ASCII letters or digits becomes a single dash.
+func slugify(name string) string {
+	var slug strings.Builder
+	pendingDash := false
+
+	for _, r := range norm.NFKD.String(strings.ToLower(name)) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			continue
+		case (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9'):
+			if pendingDash && slug.Len() > 0 {
+				slug.WriteByte('-')
+			}
+			pendingDash = false
+			slug.WriteRune(r)
+		default:
+			pendingDash = true
+		}
+	}
+
+	return slug.String()
+}
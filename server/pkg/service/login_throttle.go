@@ -0,0 +1,149 @@
+package service
+
+import (
+	"errors"
+	"github.com/erkindilekci/cinebase/server/pkg/domain"
+	"github.com/erkindilekci/cinebase/server/pkg/repository"
+	"strings"
+	"time"
+)
+
+// ThrottleRule describes how failed logins of one subject are slowed down.
+// The first FreeAttempts failures cost nothing, every further one blocks the
+// subject for BaseDelay, doubled each time up to MaxDelay. Reaching
+// LockoutThreshold failures locks the subject for LockoutDuration.
+type ThrottleRule struct {
+	FreeAttempts     int
+	BaseDelay        time.Duration
+	MaxDelay         time.Duration
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+}
+
+type LoginThrottleConfig struct {
+	// Account applies per email, whether or not it belongs to an account, so
+	// lockouts don't tell which emails exist.
+	Account ThrottleRule
+	// IP applies per client address and should be more lenient, as many
+	// users may share one.
+	IP ThrottleRule
+	// ResetAfter is how long after the last failure the count starts over.
+	ResetAfter time.Duration
+}
+
+// LoginThrottle tracks failed logins per email and per client IP.
+type LoginThrottle struct {
+	loginThrottleRepository repository.ILoginThrottleRepository
+	config                  LoginThrottleConfig
+	accountDelays           []time.Duration
+	ipDelays                []time.Duration
+}
+
+func NewLoginThrottle(loginThrottleRepository repository.ILoginThrottleRepository, config LoginThrottleConfig) *LoginThrottle {
+	return &LoginThrottle{loginThrottleRepository, config, config.Account.delays(), config.IP.delays()}
+}
+
+// LoginAttempt is an attempt counted by LoginThrottle.Attempt. It counts as
+// failed unless it is refunded.
+type LoginAttempt struct {
+	throttle *LoginThrottle
+	// counted maps the subjects the attempt was counted for to its number
+	// among their attempts.
+	counted map[string]int
+}
+
+// Attempt counts a login attempt for email from ip before its credentials
+// are checked, so concurrent guesses can't all get past the throttle. While
+// email or ip is blocked it returns a *domain.TooManyAttemptsError and
+// nothing is counted. The attempt must be refunded if it doesn't fail.
+func (throttle *LoginThrottle) Attempt(email, ip string) (*LoginAttempt, error) {
+	resetBefore := time.Now().Add(-throttle.config.ResetAfter)
+	attempt := &LoginAttempt{throttle: throttle, counted: make(map[string]int)}
+
+	var blockedUntil *time.Time
+	subjects := map[string][]time.Duration{
+		accountSubject(email): throttle.accountDelays,
+		ipSubject(ip):         throttle.ipDelays,
+	}
+	for subject, delays := range subjects {
+		attempts, subjectBlockedUntil, err := throttle.loginThrottleRepository.CountAttempt(subject, resetBefore, delays)
+		if err != nil {
+			return nil, errors.Join(err, attempt.Refund())
+		}
+		if subjectBlockedUntil != nil {
+			if blockedUntil == nil || subjectBlockedUntil.After(*blockedUntil) {
+				blockedUntil = subjectBlockedUntil
+			}
+			continue
+		}
+		attempt.counted[subject] = attempts
+	}
+
+	if blockedUntil != nil {
+		if err := attempt.Refund(); err != nil {
+			return nil, err
+		}
+		return nil, &domain.TooManyAttemptsError{RetryAfter: time.Until(*blockedUntil)}
+	}
+	return attempt, nil
+}
+
+// Refund takes back an attempt that didn't fail, such as one with the right
+// credentials or one that failed for reasons other than wrong credentials.
+func (attempt *LoginAttempt) Refund() error {
+	var errs []error
+	for subject, attempts := range attempt.counted {
+		errs = append(errs, attempt.throttle.loginThrottleRepository.RefundAttempt(subject, attempts))
+	}
+	attempt.counted = nil
+	return errors.Join(errs...)
+}
+
+// Reset forgets the failures for email, after a successful login or when an
+// admin unlocks the account. Failures from the IP are kept.
+func (throttle *LoginThrottle) Reset(email string) error {
+	return throttle.loginThrottleRepository.Clear(accountSubject(email))
+}
+
+// delays lists how long a subject is blocked after each failure, the n-th
+// entry for the n-th failure, up to the failure from which on it stays the
+// same.
+func (rule ThrottleRule) delays() []time.Duration {
+	var delays []time.Duration
+	for failures := 1; ; failures++ {
+		delay := rule.delay(failures)
+		delays = append(delays, delay)
+
+		if rule.LockoutThreshold > 0 {
+			if failures >= rule.LockoutThreshold {
+				return delays
+			}
+		} else if failures > rule.FreeAttempts && (delay >= rule.MaxDelay || delay <= 0) {
+			return delays
+		}
+	}
+}
+
+// delay is how long a subject is blocked after its failures-th failure.
+func (rule ThrottleRule) delay(failures int) time.Duration {
+	if rule.LockoutThreshold > 0 && failures >= rule.LockoutThreshold {
+		return rule.LockoutDuration
+	}
+	if failures <= rule.FreeAttempts {
+		return 0
+	}
+
+	delay := rule.BaseDelay
+	for i := rule.FreeAttempts + 1; i < failures && delay < rule.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, rule.MaxDelay)
+}
+
+func accountSubject(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipSubject(ip string) string {
+	return "ip:" + ip
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"errors"
+	"github.com/erkindilekci/cinebase/server/pkg/domain"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeThrottle struct {
+	failures      int
+	lastFailureAt time.Time
+	blockedUntil  *time.Time
+}
+
+// fakeLoginThrottleRepository counts attempts under a lock, like the single
+// upsert of the SQL repository.
+type fakeLoginThrottleRepository struct {
+	mu        sync.Mutex
+	throttles map[string]*fakeThrottle
+}
+
+func newFakeLoginThrottleRepository() *fakeLoginThrottleRepository {
+	return &fakeLoginThrottleRepository{throttles: make(map[string]*fakeThrottle)}
+}
+
+func (throttleRepository *fakeLoginThrottleRepository) CountAttempt(subject string, resetBefore time.Time, delays []time.Duration) (int, *time.Time, error) {
+	throttleRepository.mu.Lock()
+	defer throttleRepository.mu.Unlock()
+
+	now := time.Now()
+	throttle, ok := throttleRepository.throttles[subject]
+	if !ok {
+		throttle = &fakeThrottle{}
+		throttleRepository.throttles[subject] = throttle
+	}
+	if throttle.blockedUntil != nil && throttle.blockedUntil.After(now) {
+		blockedUntil := *throttle.blockedUntil
+		return 0, &blockedUntil, nil
+	}
+
+	if throttle.lastFailureAt.Before(resetBefore) {
+		throttle.failures = 0
+	}
+	throttle.failures++
+	throttle.lastFailureAt = now
+	throttle.blockedUntil = nil
+	if len(delays) > 0 {
+		if delay := delays[min(throttle.failures, len(delays))-1]; delay > 0 {
+			blockedUntil := now.Add(delay)
+			throttle.blockedUntil = &blockedUntil
+		}
+	}
+	return throttle.failures, nil, nil
+}
+
+func (throttleRepository *fakeLoginThrottleRepository) RefundAttempt(subject string, attempts int) error {
+	throttleRepository.mu.Lock()
+	defer throttleRepository.mu.Unlock()
+
+	if throttle, ok := throttleRepository.throttles[subject]; ok {
+		if throttle.failures == attempts {
+			throttle.blockedUntil = nil
+		}
+		throttle.failures = max(throttle.failures-1, 0)
+	}
+	return nil
+}
+
+func (throttleRepository *fakeLoginThrottleRepository) Clear(subject string) error {
+	throttleRepository.mu.Lock()
+	defer throttleRepository.mu.Unlock()
+
+	delete(throttleRepository.throttles, subject)
+	return nil
+}
+
+func newTestLoginThrottle() *LoginThrottle {
+	return NewLoginThrottle(newFakeLoginThrottleRepository(), LoginThrottleConfig{
+		Account:    ThrottleRule{FreeAttempts: 0, BaseDelay: time.Minute, MaxDelay: time.Hour},
+		IP:         ThrottleRule{FreeAttempts: 100, BaseDelay: time.Minute, MaxDelay: time.Hour},
+		ResetAfter: time.Hour,
+	})
+}
+
+func TestConcurrentLoginAttemptsAreCountedBeforeTheyAreChecked(t *testing.T) {
+	throttle := newTestLoginThrottle()
+
+	var allowed, refused int
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := throttle.Attempt("jane@example.com", "192.0.2.1")
+
+			mu.Lock()
+			defer mu.Unlock()
+			var tooMany *domain.TooManyAttemptsError
+			switch {
+			case err == nil:
+				allowed++
+			case errors.As(err, &tooMany):
+				refused++
+			default:
+				t.Errorf("Attempt() = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// With no free attempts the first one blocks all the others.
+	if allowed != 1 || refused != 19 {
+		t.Errorf("%d attempts allowed and %d refused, want 1 and 19", allowed, refused)
+	}
+}
+
+func TestRefundedLoginAttemptLiftsItsBlock(t *testing.T) {
+	throttle := newTestLoginThrottle()
+
+	attempt, err := throttle.Attempt("jane@example.com", "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = attempt.Refund(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = throttle.Attempt("jane@example.com", "192.0.2.1"); err != nil {
+		t.Errorf("attempt after a refunded one = %v, want it allowed", err)
+	}
+	if _, err = throttle.Attempt("jane@example.com", "192.0.2.1"); err == nil {
+		t.Error("attempt after a failed one was allowed, want it blocked")
+	}
+}
+
+func TestThrottleRuleDelays(t *testing.T) {
+	tests := []struct {
+		rule ThrottleRule
+		want []time.Duration
+	}{
+		{
+			ThrottleRule{FreeAttempts: 2, BaseDelay: time.Second, MaxDelay: 5 * time.Second},
+			[]time.Duration{0, 0, time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second},
+		},
+		{
+			ThrottleRule{FreeAttempts: 1, BaseDelay: time.Second, MaxDelay: time.Hour, LockoutThreshold: 4, LockoutDuration: 15 * time.Minute},
+			[]time.Duration{0, time.Second, 2 * time.Second, 15 * time.Minute},
+		},
+		{
+			ThrottleRule{FreeAttempts: 1},
+			[]time.Duration{0, 0},
+		},
+	}
+
+	for _, test := range tests {
+		if got := test.rule.delays(); !slices.Equal(got, test.want) {
+			t.Errorf("%+v.delays() = %v, want %v", test.rule, got, test.want)
+		}
+	}
+}
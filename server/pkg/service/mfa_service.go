@@ -0,0 +1,301 @@
+package service
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"github.com/erkindilekci/cinebase/server/pkg/commmon/signing"
+	"github.com/erkindilekci/cinebase/server/pkg/commmon/totp"
+	"github.com/erkindilekci/cinebase/server/pkg/domain"
+	"github.com/erkindilekci/cinebase/server/pkg/repository"
+	"github.com/golang-jwt/jwt/v5"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// mfaAudience keeps MFA challenges from being accepted as access tokens
+	// and the other way round.
+	mfaAudience = "cinebase-mfa"
+	// totpSkew accepts codes one period early or late.
+	totpSkew           = 1
+	recoveryCodeCount  = 10
+	recoveryCodeGroups = 4
+	// recoveryCodeAlphabet leaves out characters that are easily confused.
+	recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+)
+
+type MfaConfig struct {
+	// TotpIssuer names the application in authenticator apps.
+	TotpIssuer string
+	// ChallengeTTL is how long the second login step can be completed.
+	ChallengeTTL time.Duration
+	// RequiredForPrivilegedRoles denies accounts whose role grants any
+	// permission their permissions until they log in with a second factor.
+	RequiredForPrivilegedRoles bool
+	// Issuer is put in the iss claim of challenge tokens.
+	Issuer string
+}
+
+type IMfaService interface {
+	Enroll(userId int64) (*domain.TotpEnrollment, error)
+	Confirm(userId int64, code string) ([]string, error)
+	Disable(userId int64, code, ip string) error
+	RegenerateRecoveryCodes(userId int64, code, ip string) ([]string, error)
+	NewChallenge(user *domain.User) (*domain.LoginResult, error)
+	CompleteLogin(mfaToken, code, ip string) (*domain.TokenPair, error)
+}
+
+type MfaService struct {
+	mfaRepository  repository.IMfaRepository
+	userRepository repository.IUserRepository
+	tokenService   ITokenService
+	loginThrottle  *LoginThrottle
+	keySet         *signing.KeySet
+	config         MfaConfig
+}
+
+type mfaChallengeClaims struct {
+	jwt.RegisteredClaims
+}
+
+func NewMfaService(mfaRepository repository.IMfaRepository, userRepository repository.IUserRepository, tokenService ITokenService, loginThrottle *LoginThrottle, keySet *signing.KeySet, config MfaConfig) IMfaService {
+	return &MfaService{mfaRepository, userRepository, tokenService, loginThrottle, keySet, config}
+}
+
+// Enroll generates a TOTP secret for the user. It only takes effect once a
+// code generated from it is confirmed.
+func (service *MfaService) Enroll(userId int64) (*domain.TotpEnrollment, error) {
+	user, err := service.userRepository.GetUserById(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, errors.New("error while generating the TOTP secret")
+	}
+	if err = service.mfaRepository.SetTotpSecret(userId, secret); err != nil {
+		return nil, err
+	}
+
+	return &domain.TotpEnrollment{
+		Secret: secret,
+		URI:    totp.URI(service.config.TotpIssuer, user.Email, secret),
+	}, nil
+}
+
+// Confirm enables TOTP with the first code from the authenticator app and
+// returns the recovery codes. They are only stored hashed and can't be shown
+// again.
+func (service *MfaService) Confirm(userId int64, code string) ([]string, error) {
+	enrollment, err := service.mfaRepository.GetTotp(userId)
+	if err != nil {
+		return nil, err
+	}
+	if enrollment == nil {
+		return nil, domain.ErrMfaNotEnrolled
+	}
+	if enrollment.ConfirmedAt != nil {
+		return nil, domain.ErrMfaAlreadyEnabled
+	}
+
+	step, ok := totp.Validate(enrollment.Secret, code, time.Now(), totpSkew)
+	if !ok {
+		return nil, domain.ErrInvalidMfaCode
+	}
+
+	recoveryCodes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err = service.mfaRepository.ConfirmTotp(userId, step, hashes); err != nil {
+		return nil, err
+	}
+
+	return recoveryCodes, nil
+}
+
+// Disable turns TOTP off after checking a current code or recovery code.
+func (service *MfaService) Disable(userId int64, code, ip string) error {
+	user, err := service.userRepository.GetUserById(userId)
+	if err != nil {
+		return err
+	}
+	if err = service.checkCode(user, code, ip); err != nil {
+		return err
+	}
+	return service.mfaRepository.DisableTotp(userId)
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after checking a
+// current code or recovery code.
+func (service *MfaService) RegenerateRecoveryCodes(userId int64, code, ip string) ([]string, error) {
+	user, err := service.userRepository.GetUserById(userId)
+	if err != nil {
+		return nil, err
+	}
+	if err = service.checkCode(user, code, ip); err != nil {
+		return nil, err
+	}
+
+	recoveryCodes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err = service.mfaRepository.ReplaceRecoveryCodes(userId, hashes); err != nil {
+		return nil, err
+	}
+
+	return recoveryCodes, nil
+}
+
+// NewChallenge starts the second login step for a user whose password was
+// correct. The challenge token proves the first step, not access.
+func (service *MfaService) NewChallenge(user *domain.User) (*domain.LoginResult, error) {
+	now := time.Now()
+	claims := &mfaChallengeClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    service.config.Issuer,
+			Audience:  jwt.ClaimStrings{mfaAudience},
+			Subject:   fmt.Sprint(user.Id),
+			ExpiresAt: jwt.NewNumericDate(now.Add(service.config.ChallengeTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+
+	mfaToken, err := service.keySet.Sign(claims)
+	if err != nil {
+		return nil, errors.New("error signing the MFA challenge: " + err.Error())
+	}
+
+	return &domain.LoginResult{MfaToken: mfaToken, MfaExpiresIn: service.config.ChallengeTTL}, nil
+}
+
+// CompleteLogin finishes a login with the challenge token and a TOTP or
+// recovery code.
+func (service *MfaService) CompleteLogin(mfaToken, code, ip string) (*domain.TokenPair, error) {
+	claims := &mfaChallengeClaims{}
+	_, err := jwt.ParseWithClaims(mfaToken, claims, service.keySet.Keyfunc,
+		jwt.WithValidMethods(service.keySet.Methods()),
+		jwt.WithIssuer(service.config.Issuer),
+		jwt.WithAudience(mfaAudience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, domain.ErrInvalidMfaToken
+	}
+
+	userId, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		return nil, domain.ErrInvalidMfaToken
+	}
+	user, err := service.userRepository.GetUserById(userId)
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return nil, domain.ErrInvalidMfaToken
+		}
+		return nil, err
+	}
+
+	if err = service.checkCode(user, code, ip); err != nil {
+		return nil, err
+	}
+
+	if err = service.loginThrottle.Reset(user.Email); err != nil {
+		return nil, err
+	}
+
+	return service.tokenService.IssueTokens(user, true)
+}
+
+// checkCode verifies a code sent from ip for user. Wrong codes count as failed
+// logins, so guessing them is throttled like guessing passwords, including
+// with a stolen access token.
+func (service *MfaService) checkCode(user *domain.User, code, ip string) error {
+	attempt, err := service.loginThrottle.Attempt(user.Email, ip)
+	if err != nil {
+		return err
+	}
+
+	err = service.verify(user.Id, code)
+	if !errors.Is(err, domain.ErrInvalidMfaCode) {
+		if refundErr := attempt.Refund(); refundErr != nil {
+			return errors.Join(err, refundErr)
+		}
+	}
+	return err
+}
+
+// verify accepts a TOTP code that wasn't used before, or else an unused
+// recovery code, which is then spent.
+func (service *MfaService) verify(userId int64, code string) error {
+	enrollment, err := service.mfaRepository.GetTotp(userId)
+	if err != nil {
+		return err
+	}
+	if enrollment == nil || enrollment.ConfirmedAt == nil {
+		return domain.ErrMfaNotEnrolled
+	}
+
+	if step, ok := totp.Validate(enrollment.Secret, code, time.Now(), totpSkew); ok {
+		fresh, err := service.mfaRepository.UseTotpStep(userId, step)
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			return domain.ErrInvalidMfaCode
+		}
+		return nil
+	}
+
+	used, err := service.mfaRepository.UseRecoveryCode(userId, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return domain.ErrInvalidMfaCode
+	}
+	return nil
+}
+
+// newRecoveryCodes returns fresh recovery codes such as
+// "k7dm-x2qp-hn4f-9tbr" together with their hashes. 16 characters from a
+// 31 letter alphabet are well beyond guessing, so sha256 suffices.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+
+	for i := range codes {
+		var code strings.Builder
+		for j := 0; j < recoveryCodeGroups*4; j++ {
+			if j > 0 && j%4 == 0 {
+				code.WriteByte('-')
+			}
+			index, err := rand.Int(rand.Reader, big.NewInt(int64(len(recoveryCodeAlphabet))))
+			if err != nil {
+				return nil, nil, errors.New("error while generating recovery codes")
+			}
+			code.WriteByte(recoveryCodeAlphabet[index.Int64()])
+		}
+
+		codes[i] = code.String()
+		hashes[i] = hashToken(normalizeRecoveryCode(codes[i]))
+	}
+
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode makes typing a recovery code forgiving of case,
+// spaces and dashes.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, code)
+}
@@ -10,26 +10,47 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"strings"
 	"time"
 )
 
 type IMovieService interface {
 	GetAllMovies() ([]*domain.Movie, error)
 	GetMoviesByGenreId(genreId int64) ([]*domain.Movie, error)
+	SearchMoviesByTitle(titleContains string) ([]*domain.Movie, error)
+	Search(text string, limit int) ([]*domain.MovieSearchResult, error)
+	Autocomplete(prefix string, limit int) ([]*domain.MovieSuggestion, error)
+	GetMoviesPage(pageQuery *domain.MoviePageQuery) (*domain.MoviePage, error)
+	CountMovies(filter domain.MovieFilter) (int64, error)
+	GetMovieFacets(filter domain.MovieFilter) (*domain.MovieFacets, error)
 	GetMovieById(id int64) (*domain.Movie, error)
 	GetMovieByIdEdit(id int64) (*domain.Movie, error)
 	GetAllGenres() ([]*domain.Genre, error)
+	GetGenreById(id int64) (*domain.Genre, error)
+	GetGenresByMovieId(movieId int64) ([]*domain.Genre, error)
+	GetGenresByMovieIds(movieIds []int64) (map[int64][]*domain.Genre, error)
+	GetMoviesByGenreIds(genreIds []int64) (map[int64][]*domain.Movie, error)
 	AddMovie(movieReq request.AddMovieRequest) (*domain.Movie, error)
 	UpdateMovie(id int64, movieReq request.AddMovieRequest) (*domain.Movie, error)
 	DeleteMovie(id int64) error
 }
 
+const (
+	defaultPageSize         = 20
+	maxPageSize             = 100
+	defaultAutocompleteSize = 8
+	maxAutocompleteSize     = 20
+)
+
 type MovieService struct {
-	movieRepository repository.IMovieRepository
+	movieRepository   repository.IMovieRepository
+	autocompleteCache *autocompleteCache
 }
 
-func NewMovieService(movieRepository repository.IMovieRepository) IMovieService {
-	return &MovieService{movieRepository}
+// NewMovieService creates the movie service; autocompleteCacheSize bounds the
+// number of cached title prefixes, 0 disables the cache.
+func NewMovieService(movieRepository repository.IMovieRepository, autocompleteCacheSize int) IMovieService {
+	return &MovieService{movieRepository, newAutocompleteCache(autocompleteCacheSize)}
 }
 
 func (service *MovieService) GetAllMovies() ([]*domain.Movie, error) {
@@ -40,6 +61,68 @@ func (service *MovieService) GetMoviesByGenreId(genreId int64) ([]*domain.Movie,
 	return service.movieRepository.GetMoviesByGenreId(genreId)
 }
 
+func (service *MovieService) SearchMoviesByTitle(titleContains string) ([]*domain.Movie, error) {
+	return service.movieRepository.SearchMoviesByTitle(titleContains)
+}
+
+func (service *MovieService) Search(text string, limit int) ([]*domain.MovieSearchResult, error) {
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+	return service.movieRepository.SearchMovies(text, limit)
+}
+
+func (service *MovieService) Autocomplete(prefix string, limit int) ([]*domain.MovieSuggestion, error) {
+	prefix = strings.ToLower(strings.Join(strings.Fields(prefix), " "))
+	if prefix == "" {
+		return []*domain.MovieSuggestion{}, nil
+	}
+	if limit <= 0 {
+		limit = defaultAutocompleteSize
+	}
+	if limit > maxAutocompleteSize {
+		limit = maxAutocompleteSize
+	}
+
+	cacheKey := autocompleteCacheKey(prefix, limit)
+	suggestions, generation, ok := service.autocompleteCache.get(cacheKey)
+	if ok {
+		return suggestions, nil
+	}
+
+	suggestions, err := service.movieRepository.AutocompleteTitles(prefix, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	service.autocompleteCache.put(cacheKey, suggestions, generation)
+	return suggestions, nil
+}
+
+func (service *MovieService) GetMoviesPage(pageQuery *domain.MoviePageQuery) (*domain.MoviePage, error) {
+	if pageQuery.SortField == "" {
+		pageQuery.SortField = domain.MovieSortByTitle
+	}
+	if pageQuery.Limit <= 0 {
+		pageQuery.Limit = defaultPageSize
+	}
+	if pageQuery.Limit > maxPageSize {
+		pageQuery.Limit = maxPageSize
+	}
+	return service.movieRepository.GetMoviesPage(pageQuery)
+}
+
+func (service *MovieService) CountMovies(filter domain.MovieFilter) (int64, error) {
+	return service.movieRepository.CountMovies(filter)
+}
+
+func (service *MovieService) GetMovieFacets(filter domain.MovieFilter) (*domain.MovieFacets, error) {
+	return service.movieRepository.GetMovieFacets(filter)
+}
+
 func (service *MovieService) GetMovieById(id int64) (*domain.Movie, error) {
 	return service.movieRepository.GetMovieById(id)
 }
@@ -52,6 +135,22 @@ func (service *MovieService) GetAllGenres() ([]*domain.Genre, error) {
 	return service.movieRepository.GetAllGenres()
 }
 
+func (service *MovieService) GetGenreById(id int64) (*domain.Genre, error) {
+	return service.movieRepository.GetGenreById(id)
+}
+
+func (service *MovieService) GetGenresByMovieId(movieId int64) ([]*domain.Genre, error) {
+	return service.movieRepository.GetGenresByMovieId(movieId)
+}
+
+func (service *MovieService) GetGenresByMovieIds(movieIds []int64) (map[int64][]*domain.Genre, error) {
+	return service.movieRepository.GetGenresByMovieIds(movieIds)
+}
+
+func (service *MovieService) GetMoviesByGenreIds(genreIds []int64) (map[int64][]*domain.Movie, error) {
+	return service.movieRepository.GetMoviesByGenreIds(genreIds)
+}
+
 func (service *MovieService) AddMovie(movieReq request.AddMovieRequest) (*domain.Movie, error) {
 	releaseDate, err := time.Parse("2006-01-02", movieReq.ReleaseDate)
 	if err != nil {
@@ -77,7 +176,13 @@ func (service *MovieService) AddMovie(movieReq request.AddMovieRequest) (*domain
 	}
 	movie.GenresIntArray = genres
 
-	return service.movieRepository.AddMovie(movie)
+	newMovie, err := service.movieRepository.AddMovie(movie)
+	if err != nil {
+		return nil, err
+	}
+
+	service.autocompleteCache.invalidate()
+	return newMovie, nil
 }
 
 func (service *MovieService) UpdateMovie(id int64, movieReq request.AddMovieRequest) (*domain.Movie, error) {
@@ -102,7 +207,13 @@ func (service *MovieService) UpdateMovie(id int64, movieReq request.AddMovieRequ
 	}
 	movie.GenresIntArray = genres
 
-	return service.movieRepository.UpdateMovie(movie)
+	updatedMovie, err := service.movieRepository.UpdateMovie(movie)
+	if err != nil {
+		return nil, err
+	}
+
+	service.autocompleteCache.invalidate()
+	return updatedMovie, nil
 }
 
 func getMoviePosterWithMovieTitle(title string) string {
@@ -147,5 +258,11 @@ func getMoviePosterWithMovieTitle(title string) string {
 }
 
 func (service *MovieService) DeleteMovie(id int64) error {
-	return service.movieRepository.DeleteMovieById(id)
+	err := service.movieRepository.DeleteMovieById(id)
+	if err != nil {
+		return err
+	}
+
+	service.autocompleteCache.invalidate()
+	return nil
 }
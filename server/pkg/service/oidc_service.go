@@ -0,0 +1,223 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/erkindilekci/cinebase/server/pkg/commmon/oidc"
+	"github.com/erkindilekci/cinebase/server/pkg/commmon/signing"
+	"github.com/erkindilekci/cinebase/server/pkg/domain"
+	"github.com/erkindilekci/cinebase/server/pkg/repository"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/gommon/log"
+	"slices"
+	"time"
+)
+
+// oidcStateAudience keeps login state cookies from being accepted as any
+// other token signed with the same keys.
+const oidcStateAudience = "cinebase-oidc-state"
+
+// roleRanks orders roles, so a user in several mapped groups gets the
+// highest of their roles.
+var roleRanks = map[domain.Role]int{
+	domain.RoleViewer: 0,
+	domain.RoleEditor: 1,
+	domain.RoleAdmin:  2,
+}
+
+type OidcConfig struct {
+	Provider oidc.Config
+	// RoleClaim names the ID token claim, such as groups, whose values are
+	// looked up in RoleMapping. When it is set the provider decides the role
+	// of its users on every login; otherwise roles are managed here.
+	RoleClaim   string
+	RoleMapping map[string]domain.Role
+	// StateTTL is how long a started login can be completed.
+	StateTTL time.Duration
+	// Issuer is put in the iss claim of state tokens.
+	Issuer string
+}
+
+type IOidcService interface {
+	BeginLogin(ctx context.Context) (authURL string, stateToken string, err error)
+	CompleteLogin(ctx context.Context, stateToken, state, code string) (*domain.LoginResult, error)
+}
+
+type OidcService struct {
+	provider                 *oidc.Provider
+	identityRepository       repository.IIdentityRepository
+	userRepository           repository.IUserRepository
+	tokenService             ITokenService
+	emailVerificationService IEmailVerificationService
+	mfaService               IMfaService
+	keySet                   *signing.KeySet
+	config                   OidcConfig
+}
+
+// oidcStateClaims carries what the callback has to check across the
+// redirect to the provider. It is kept in a cookie of the user's browser,
+// so a login can only be completed where it was started.
+type oidcStateClaims struct {
+	State        string `json:"state"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+	jwt.RegisteredClaims
+}
+
+func NewOidcService(provider *oidc.Provider, identityRepository repository.IIdentityRepository, userRepository repository.IUserRepository, tokenService ITokenService, emailVerificationService IEmailVerificationService, mfaService IMfaService, keySet *signing.KeySet, config OidcConfig) (IOidcService, error) {
+	for value, role := range config.RoleMapping {
+		if !role.IsValid() {
+			return nil, fmt.Errorf("%s is mapped to %q: %w", value, role, domain.ErrInvalidRole)
+		}
+	}
+	return &OidcService{provider, identityRepository, userRepository, tokenService, emailVerificationService, mfaService, keySet, config}, nil
+}
+
+// BeginLogin returns the provider URL to send the user to, and the state
+// token the callback needs to complete the login.
+func (service *OidcService) BeginLogin(ctx context.Context) (string, string, error) {
+	state, err := oidc.RandomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := oidc.RandomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	codeVerifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		return "", "", err
+	}
+
+	authURL, err := service.provider.AuthCodeURL(ctx, state, nonce, codeVerifier)
+	if err != nil {
+		return "", "", err
+	}
+
+	now := time.Now()
+	claims := &oidcStateClaims{
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    service.config.Issuer,
+			Audience:  jwt.ClaimStrings{oidcStateAudience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(service.config.StateTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+
+	stateToken, err := service.keySet.Sign(claims)
+	if err != nil {
+		return "", "", errors.New("error signing the login state: " + err.Error())
+	}
+
+	return authURL, stateToken, nil
+}
+
+// CompleteLogin handles the provider's callback with state and code. Unknown
+// users are provisioned, or linked to the account with their email when the
+// provider verified it. Users with TOTP enabled get an MFA challenge unless
+// the provider reports it used more than one factor.
+func (service *OidcService) CompleteLogin(ctx context.Context, stateToken, state, code string) (*domain.LoginResult, error) {
+	claims := &oidcStateClaims{}
+	_, err := jwt.ParseWithClaims(stateToken, claims, service.keySet.Keyfunc,
+		jwt.WithValidMethods(service.keySet.Methods()),
+		jwt.WithIssuer(service.config.Issuer),
+		jwt.WithAudience(oidcStateAudience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(claims.State), []byte(state)) != 1 {
+		return nil, fmt.Errorf("%w: invalid or expired login state", domain.ErrSingleSignOnFailed)
+	}
+
+	rawIDToken, err := service.provider.Exchange(ctx, code, claims.CodeVerifier)
+	if err != nil {
+		log.Errorf("error while redeeming the authorization code: %v", err)
+		return nil, domain.ErrSingleSignOnFailed
+	}
+	idToken, err := service.provider.VerifyIDToken(ctx, rawIDToken, claims.Nonce)
+	if err != nil {
+		log.Errorf("error while verifying the ID token: %v", err)
+		return nil, domain.ErrSingleSignOnFailed
+	}
+	if idToken.Email == "" {
+		return nil, fmt.Errorf("%w: the provider didn't share an email", domain.ErrSingleSignOnFailed)
+	}
+	if idToken.Email, err = normalizeEmail(idToken.Email); err != nil {
+		return nil, fmt.Errorf("%w: the provider shared an invalid email", domain.ErrSingleSignOnFailed)
+	}
+
+	user, err := service.findOrProvisionUser(idToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = service.emailVerificationService.CheckLogin(user); err != nil {
+		return nil, err
+	}
+
+	mfa := slices.Contains(idToken.AuthMethods, "mfa") || slices.Contains(idToken.AuthMethods, domain.AuthMethodOtp)
+	if user.MfaEnabled && !mfa {
+		return service.mfaService.NewChallenge(user)
+	}
+
+	tokenPair, err := service.tokenService.IssueTokens(user, mfa)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.LoginResult{Tokens: tokenPair}, nil
+}
+
+func (service *OidcService) findOrProvisionUser(idToken *oidc.IDToken) (*domain.User, error) {
+	role := service.mapRole(idToken)
+
+	user, err := service.identityRepository.GetUserByIdentity(idToken.Issuer, idToken.Subject)
+	if errors.Is(err, domain.ErrUserNotFound) {
+		identity := &domain.UserIdentity{Issuer: idToken.Issuer, Subject: idToken.Subject, Email: idToken.Email}
+		user, err = service.identityRepository.ProvisionUser(identity, idToken.EmailVerified, role)
+		if err != nil {
+			return nil, err
+		}
+		// Accounts the provider vouched for are verified already.
+		if !user.IsEmailVerified() {
+			if mailErr := service.emailVerificationService.SendVerification(user); mailErr != nil {
+				log.Errorf("error while sending the verification mail: %v", mailErr)
+			}
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	if service.config.RoleClaim == "" || user.Role == role {
+		return user, nil
+	}
+
+	if _, err = service.userRepository.UpdateUserRole(user.Id, role); err != nil {
+		if errors.Is(err, domain.ErrLastAdmin) {
+			log.Warnf("keeping %s admin although the provider maps them to %s, as they are the last admin", user.Email, role)
+			return user, nil
+		}
+		return nil, err
+	}
+	user.Role = role
+	return user, nil
+}
+
+// mapRole returns the highest role the values of the role claim are mapped
+// to, viewer when none is.
+func (service *OidcService) mapRole(idToken *oidc.IDToken) domain.Role {
+	role := domain.RoleViewer
+	if service.config.RoleClaim == "" {
+		return role
+	}
+
+	for _, value := range oidc.StringList(idToken.Claims[service.config.RoleClaim]) {
+		if mapped, ok := service.config.RoleMapping[value]; ok && roleRanks[mapped] > roleRanks[role] {
+			role = mapped
+		}
+	}
+	return role
+}
@@ -0,0 +1,306 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/erkindilekci/cinebase/server/pkg/commmon/oidc"
+	"github.com/erkindilekci/cinebase/server/pkg/commmon/oidc/oidctest"
+	"github.com/erkindilekci/cinebase/server/pkg/commmon/signing"
+	"github.com/erkindilekci/cinebase/server/pkg/domain"
+	"github.com/golang-jwt/jwt/v5"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeIdentityRepository links identities to the users of a
+// fakeUserRepository by the rules of the SQL repository.
+type fakeIdentityRepository struct {
+	userRepository *fakeUserRepository
+
+	mu         sync.Mutex
+	identities map[string]int64
+}
+
+func (identityRepository *fakeIdentityRepository) GetUserByIdentity(issuer, subject string) (*domain.User, error) {
+	identityRepository.mu.Lock()
+	userId, ok := identityRepository.identities[issuer+" "+subject]
+	identityRepository.mu.Unlock()
+
+	if !ok {
+		return nil, domain.ErrUserNotFound
+	}
+	user := identityRepository.userRepository.user(userId)
+	return &user, nil
+}
+
+func (identityRepository *fakeIdentityRepository) ProvisionUser(identity *domain.UserIdentity, emailVerified bool, role domain.Role) (*domain.User, error) {
+	userRepository := identityRepository.userRepository
+	userRepository.mu.Lock()
+
+	var user *domain.User
+	for _, existing := range userRepository.users {
+		if strings.EqualFold(existing.Email, identity.Email) {
+			user = existing
+		}
+	}
+
+	now := time.Now()
+	switch {
+	case user != nil && !emailVerified:
+		userRepository.mu.Unlock()
+		return nil, domain.ErrIdentityConflict
+	case user != nil:
+		if user.EmailVerifiedAt == nil {
+			user.EmailVerifiedAt = &now
+		}
+	default:
+		user = &domain.User{Id: int64(len(userRepository.users) + 1), Email: identity.Email, Role: role}
+		if emailVerified {
+			user.EmailVerifiedAt = &now
+		}
+		userRepository.users[user.Id] = user
+	}
+	provisioned := *user
+	userRepository.mu.Unlock()
+
+	identityRepository.mu.Lock()
+	defer identityRepository.mu.Unlock()
+	identityRepository.identities[identity.Issuer+" "+identity.Subject] = user.Id
+	return &provisioned, nil
+}
+
+// fakeTokenService issues tokens naming the user they are for.
+type fakeTokenService struct {
+	ITokenService
+}
+
+func (fakeTokenService) IssueTokens(user *domain.User, mfa bool) (*domain.TokenPair, error) {
+	return &domain.TokenPair{AccessToken: fmt.Sprintf("access-%d-%t", user.Id, mfa)}, nil
+}
+
+// recordingVerificationService records who verification mails are sent to.
+type recordingVerificationService struct {
+	IEmailVerificationService
+
+	mu   sync.Mutex
+	sent []int64
+}
+
+func (verificationService *recordingVerificationService) SendVerification(user *domain.User) error {
+	verificationService.mu.Lock()
+	defer verificationService.mu.Unlock()
+
+	verificationService.sent = append(verificationService.sent, user.Id)
+	return nil
+}
+
+func (verificationService *recordingVerificationService) CheckLogin(*domain.User) error {
+	return nil
+}
+
+type fakeMfaService struct {
+	IMfaService
+}
+
+func (fakeMfaService) NewChallenge(*domain.User) (*domain.LoginResult, error) {
+	return &domain.LoginResult{MfaToken: "challenge"}, nil
+}
+
+type oidcTestSetup struct {
+	mockProvider        *oidctest.Provider
+	keySet              *signing.KeySet
+	oidcService         IOidcService
+	userRepository      *fakeUserRepository
+	verificationService *recordingVerificationService
+}
+
+func newOidcTestSetup(t *testing.T, roleClaim string, users ...*domain.User) *oidcTestSetup {
+	t.Helper()
+
+	keySet, err := signing.NewEphemeralKeySet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mockProvider := oidctest.NewProvider(t, "cinebase")
+	userRepository := newFakeUserRepository(users...)
+	identityRepository := &fakeIdentityRepository{userRepository: userRepository, identities: make(map[string]int64)}
+	verificationService := &recordingVerificationService{}
+	config := OidcConfig{
+		Provider:  mockProvider.Config("http://api.test/oidc/callback"),
+		RoleClaim: roleClaim,
+		RoleMapping: map[string]domain.Role{
+			"cinebase-editors": domain.RoleEditor,
+			"cinebase-admins":  domain.RoleAdmin,
+		},
+		StateTTL: time.Minute,
+		Issuer:   testIssuer,
+	}
+
+	oidcService, err := NewOidcService(oidc.NewProvider(config.Provider, nil), identityRepository, userRepository,
+		fakeTokenService{}, verificationService, fakeMfaService{}, keySet, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &oidcTestSetup{mockProvider, keySet, oidcService, userRepository, verificationService}
+}
+
+// login runs a whole login in which the provider puts claims in the ID token.
+func (setup *oidcTestSetup) login(t *testing.T, claims jwt.MapClaims) (*domain.LoginResult, error) {
+	t.Helper()
+
+	ctx := context.Background()
+	authURL, stateToken, err := setup.oidcService.BeginLogin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, code := setup.mockProvider.Authorize(t, authURL, claims)
+	return setup.oidcService.CompleteLogin(ctx, stateToken, state, code)
+}
+
+func TestOidcLoginProvisionsUnknownUsers(t *testing.T) {
+	setup := newOidcTestSetup(t, "")
+
+	claims := jwt.MapClaims{"sub": "jane", "email": "Jane@Example.com", "email_verified": false}
+	result, err := setup.login(t, claims)
+	if err != nil {
+		t.Fatalf("CompleteLogin() = %v", err)
+	}
+	if result.Tokens == nil || result.Tokens.AccessToken != "access-1-false" {
+		t.Fatalf("got %+v, want tokens for the provisioned user 1", result)
+	}
+
+	user := setup.userRepository.user(1)
+	if user.Email != "jane@example.com" || user.Role != domain.RoleViewer || user.IsEmailVerified() {
+		t.Errorf("provisioned %+v, want an unverified viewer jane@example.com", user)
+	}
+	if len(setup.verificationService.sent) != 1 {
+		t.Errorf("%d verification mails sent to the unverified user, want 1", len(setup.verificationService.sent))
+	}
+
+	// The identity is linked now, so logging in again finds the same user.
+	if result, err = setup.login(t, claims); err != nil || result.Tokens.AccessToken != "access-1-false" {
+		t.Errorf("second login got %+v, %v, want tokens for user 1", result, err)
+	}
+	if len(setup.userRepository.users) != 1 {
+		t.Errorf("%d users after logging in twice, want 1", len(setup.userRepository.users))
+	}
+}
+
+func TestOidcLoginSendsNoVerificationMailForVerifiedEmails(t *testing.T) {
+	setup := newOidcTestSetup(t, "")
+
+	if _, err := setup.login(t, jwt.MapClaims{"sub": "jane", "email": "jane@example.com", "email_verified": true}); err != nil {
+		t.Fatal(err)
+	}
+	if setup.userRepository.user(1).EmailVerifiedAt == nil {
+		t.Error("the email the provider verified isn't verified")
+	}
+	if len(setup.verificationService.sent) != 0 {
+		t.Errorf("%d verification mails sent for a verified email, want none", len(setup.verificationService.sent))
+	}
+}
+
+func TestOidcLoginLinksExistingAccountsOnlyForVerifiedEmails(t *testing.T) {
+	existing := &domain.User{Id: 1, Email: "jane@example.com", Password: "hash", Role: domain.RoleEditor}
+	setup := newOidcTestSetup(t, "", existing)
+
+	_, err := setup.login(t, jwt.MapClaims{"sub": "jane", "email": "jane@example.com", "email_verified": false})
+	if !errors.Is(err, domain.ErrIdentityConflict) {
+		t.Fatalf("login with an unverified email of an existing account = %v, want ErrIdentityConflict", err)
+	}
+
+	result, err := setup.login(t, jwt.MapClaims{"sub": "jane", "email": "jane@example.com", "email_verified": "true"})
+	if err != nil {
+		t.Fatalf("login with a verified email = %v", err)
+	}
+	if result.Tokens.AccessToken != "access-1-false" {
+		t.Errorf("got %s, want tokens for the existing user 1", result.Tokens.AccessToken)
+	}
+	if user := setup.userRepository.user(1); user.Role != domain.RoleEditor || !user.IsEmailVerified() {
+		t.Errorf("linked user is %+v, want the verified editor", user)
+	}
+}
+
+func TestOidcLoginMapsTheRoleClaim(t *testing.T) {
+	setup := newOidcTestSetup(t, "groups")
+
+	claims := jwt.MapClaims{"sub": "jane", "email": "jane@example.com", "email_verified": true,
+		"groups": []string{"staff", "cinebase-editors", "cinebase-admins"}}
+	if _, err := setup.login(t, claims); err != nil {
+		t.Fatal(err)
+	}
+	if role := setup.userRepository.user(1).Role; role != domain.RoleAdmin {
+		t.Errorf("provisioned with role %s, want the highest mapped role admin", role)
+	}
+
+	// The provider decides the role on every login.
+	claims["groups"] = "cinebase-editors"
+	if _, err := setup.login(t, claims); err != nil {
+		t.Fatal(err)
+	}
+	if role := setup.userRepository.user(1).Role; role != domain.RoleEditor {
+		t.Errorf("role after the groups changed is %s, want editor", role)
+	}
+
+	delete(claims, "groups")
+	if _, err := setup.login(t, claims); err != nil {
+		t.Fatal(err)
+	}
+	if role := setup.userRepository.user(1).Role; role != domain.RoleViewer {
+		t.Errorf("role without mapped groups is %s, want viewer", role)
+	}
+}
+
+func TestOidcLoginRefusesTamperedState(t *testing.T) {
+	setup := newOidcTestSetup(t, "")
+	ctx := context.Background()
+
+	authURL, stateToken, err := setup.oidcService.BeginLogin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, code := setup.mockProvider.Authorize(t, authURL, jwt.MapClaims{"sub": "jane", "email": "jane@example.com"})
+
+	if _, err = setup.oidcService.CompleteLogin(ctx, stateToken, "another state", code); !errors.Is(err, domain.ErrSingleSignOnFailed) {
+		t.Errorf("CompleteLogin() with another state = %v, want ErrSingleSignOnFailed", err)
+	}
+
+	claims := &oidcStateClaims{}
+	if _, _, err = jwt.NewParser().ParseUnverified(stateToken, claims); err != nil {
+		t.Fatal(err)
+	}
+	forge := func(change func(claims *oidcStateClaims)) string {
+		forged := *claims
+		change(&forged)
+		token, err := setup.keySet.Sign(&forged)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	// The provider only redeems the code with the verifier of its challenge.
+	otherVerifier := forge(func(claims *oidcStateClaims) { claims.CodeVerifier += "x" })
+	if _, err = setup.oidcService.CompleteLogin(ctx, otherVerifier, claims.State, code); !errors.Is(err, domain.ErrSingleSignOnFailed) {
+		t.Errorf("CompleteLogin() with another code verifier = %v, want ErrSingleSignOnFailed", err)
+	}
+
+	// The ID token has to carry the nonce of the login.
+	_, code = setup.mockProvider.Authorize(t, authURL, jwt.MapClaims{"sub": "jane", "email": "jane@example.com"})
+	otherNonce := forge(func(claims *oidcStateClaims) { claims.Nonce += "x" })
+	if _, err = setup.oidcService.CompleteLogin(ctx, otherNonce, claims.State, code); !errors.Is(err, domain.ErrSingleSignOnFailed) {
+		t.Errorf("CompleteLogin() with another nonce = %v, want ErrSingleSignOnFailed", err)
+	}
+
+	_, code = setup.mockProvider.Authorize(t, authURL, jwt.MapClaims{"sub": "jane", "email": "jane@example.com"})
+	if _, err = setup.oidcService.CompleteLogin(ctx, stateToken, claims.State, code); err != nil {
+		t.Errorf("CompleteLogin() with the untampered state = %v", err)
+	}
+	if len(setup.userRepository.users) != 1 {
+		t.Errorf("%d users after one successful login, want 1", len(setup.userRepository.users))
+	}
+}
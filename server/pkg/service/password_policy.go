@@ -0,0 +1,88 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/erkindilekci/cinebase/server/pkg/commmon/breach"
+	"github.com/erkindilekci/cinebase/server/pkg/commmon/strength"
+	"github.com/erkindilekci/cinebase/server/pkg/domain"
+	"unicode/utf8"
+)
+
+// maxPasswordBytes is the most bcrypt uses of a password.
+const maxPasswordBytes = 72
+
+type PasswordPolicyConfig struct {
+	// MinLength is in characters.
+	MinLength int
+	// MaxLength is in bytes and can't exceed what bcrypt hashes.
+	MaxLength int
+	// MinStrength is the lowest strength score from 0 to 4 accepted.
+	MinStrength int
+	// BreachedHashFile optionally names a sorted Pwned Passwords SHA-1 file
+	// whose passwords are refused.
+	BreachedHashFile string
+}
+
+// PasswordPolicy decides which passwords can be chosen when signing up or
+// resetting a password.
+type PasswordPolicy struct {
+	config   PasswordPolicyConfig
+	breached breach.RangeSource
+}
+
+func NewPasswordPolicy(config PasswordPolicyConfig) (*PasswordPolicy, error) {
+	if config.MaxLength <= 0 || config.MaxLength > maxPasswordBytes {
+		return nil, fmt.Errorf("the maximum password length must be between 1 and %d bytes", maxPasswordBytes)
+	}
+	if config.MinLength < 1 || config.MinLength > config.MaxLength {
+		return nil, errors.New("the minimum password length must be between 1 and the maximum")
+	}
+	if config.MinStrength < 0 || config.MinStrength > 4 {
+		return nil, errors.New("the minimum password strength must be between 0 and 4")
+	}
+
+	policy := &PasswordPolicy{config: config}
+	if config.BreachedHashFile != "" {
+		hashFile, err := breach.OpenHashFile(config.BreachedHashFile)
+		if err != nil {
+			return nil, err
+		}
+		policy.breached = hashFile
+	}
+	return policy, nil
+}
+
+// Validate checks password against the policy. userInputs, such as the
+// user's email, make passwords built from them count as weak. Refused
+// passwords fail with domain.ErrInvalidPassword.
+func (policy *PasswordPolicy) Validate(password string, userInputs ...string) error {
+	if password == "" {
+		return fmt.Errorf("%w: password can't be empty", domain.ErrInvalidPassword)
+	}
+	if utf8.RuneCountInString(password) < policy.config.MinLength {
+		return fmt.Errorf("%w: password must have at least %d characters", domain.ErrInvalidPassword, policy.config.MinLength)
+	}
+	if len(password) > policy.config.MaxLength {
+		return fmt.Errorf("%w: password can't be longer than %d bytes", domain.ErrInvalidPassword, policy.config.MaxLength)
+	}
+
+	if result := strength.Estimate(password, userInputs...); result.Score < policy.config.MinStrength {
+		if result.Warning == "" {
+			return fmt.Errorf("%w: password is too easy to guess", domain.ErrInvalidPassword)
+		}
+		return fmt.Errorf("%w: password is too easy to guess, %s", domain.ErrInvalidPassword, result.Warning)
+	}
+
+	if policy.breached != nil {
+		count, err := breach.Count(policy.breached, password)
+		if err != nil {
+			return errors.New("error while checking for breached passwords: " + err.Error())
+		}
+		if count > 0 {
+			return fmt.Errorf("%w: password appeared in a data breach, choose another one", domain.ErrInvalidPassword)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/erkindilekci/cinebase/server/pkg/commmon/hashing"
+	"github.com/erkindilekci/cinebase/server/pkg/commmon/mail"
+	"github.com/erkindilekci/cinebase/server/pkg/domain"
+	"github.com/erkindilekci/cinebase/server/pkg/repository"
+	"github.com/labstack/gommon/log"
+	"time"
+)
+
+type PasswordResetConfig struct {
+	// TokenTTL is how long a mailed reset link can be used.
+	TokenTTL time.Duration
+	// RequestCooldown is the minimum time between two reset mails to a user.
+	RequestCooldown time.Duration
+	// ResetURL is the client page the link points to; the token is appended
+	// as the token query parameter.
+	ResetURL string
+}
+
+type IPasswordResetService interface {
+	RequestReset(email string) error
+	ResetPassword(token, password string) error
+}
+
+type PasswordResetService struct {
+	passwordResetRepository repository.IPasswordResetRepository
+	userRepository          repository.IUserRepository
+	mailQueue               *mail.Queue
+	passwordPolicy          *PasswordPolicy
+	passwordHasher          *hashing.Hasher
+	config                  PasswordResetConfig
+}
+
+func NewPasswordResetService(passwordResetRepository repository.IPasswordResetRepository, userRepository repository.IUserRepository, mailQueue *mail.Queue, passwordPolicy *PasswordPolicy, passwordHasher *hashing.Hasher, config PasswordResetConfig) IPasswordResetService {
+	return &PasswordResetService{passwordResetRepository, userRepository, mailQueue, passwordPolicy, passwordHasher, config}
+}
+
+// RequestReset mails a reset link to email if it belongs to an account and
+// no link was mailed to it during the cooldown. An unknown email or a request
+// during the cooldown isn't an error, so the endpoint can't be used to find
+// out who has an account; the mail is queued for the same reason.
+func (service *PasswordResetService) RequestReset(email string) error {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return err
+	}
+
+	user, err := service.userRepository.GetUserByEmail(email)
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		return err
+	}
+
+	resetToken := &domain.PasswordResetToken{
+		UserId:    user.Id,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(service.config.TokenTTL),
+	}
+	stored, err := service.passwordResetRepository.AddPasswordResetToken(resetToken, time.Now().Add(-service.config.RequestCooldown))
+	if err != nil {
+		return errors.New("error while storing the password reset token")
+	}
+	if !stored {
+		return nil
+	}
+
+	message := mail.Message{
+		To:      user.Email,
+		Subject: "Reset your Cinebase password",
+		Body: fmt.Sprintf("Someone asked to reset the password of your Cinebase account.\n\n"+
+			"Open this link within %s to choose a new password:\n%s\n\n"+
+			"If it wasn't you, you can ignore this email.", service.config.TokenTTL, tokenLink(service.config.ResetURL, token)),
+	}
+	service.mailQueue.Enqueue(message, func(error) {
+		// A link that never arrived mustn't hold up the next one.
+		if err := service.passwordResetRepository.DeletePasswordResetToken(resetToken.Id); err != nil {
+			log.Errorf("error while releasing the password reset cooldown: %v", err)
+		}
+	})
+
+	return nil
+}
+
+// ResetPassword sets a new password with a token from a reset link. The token
+// can't be used again, every session of the account is revoked and its API
+// keys are deleted.
+func (service *PasswordResetService) ResetPassword(token, password string) error {
+	if token == "" {
+		return domain.ErrInvalidResetToken
+	}
+	userId, err := service.passwordResetRepository.GetPasswordResetUserId(hashToken(token))
+	if err != nil {
+		return err
+	}
+	user, err := service.userRepository.GetUserById(userId)
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return domain.ErrInvalidResetToken
+		}
+		return err
+	}
+	if err = service.passwordPolicy.Validate(password, user.Email); err != nil {
+		return err
+	}
+
+	passwordHash, err := service.passwordHasher.Hash(password)
+	if err != nil {
+		return errors.New("error while creating password hash")
+	}
+
+	userId, err = service.passwordResetRepository.ResetPassword(hashToken(token), passwordHash)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Password of user %d was reset, all sessions and API keys revoked", userId)
+	return nil
+}
@@ -0,0 +1,279 @@
+package service
+
+import (
+	"errors"
+	"github.com/erkindilekci/cinebase/server/pkg/commmon/hashing"
+	"github.com/erkindilekci/cinebase/server/pkg/domain"
+	"github.com/erkindilekci/cinebase/server/pkg/repository"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakePasswordResetRepository keeps reset tokens in memory with the same
+// cooldown, single-use and expiry rules as the SQL repository.
+type fakePasswordResetRepository struct {
+	repository.IPasswordResetRepository
+
+	mu        sync.Mutex
+	nextId    int64
+	tokens    []*domain.PasswordResetToken
+	issuedAt  map[int64]time.Time
+	passwords map[int64]string
+}
+
+func newFakePasswordResetRepository() *fakePasswordResetRepository {
+	return &fakePasswordResetRepository{issuedAt: make(map[int64]time.Time), passwords: make(map[int64]string)}
+}
+
+func (resetRepository *fakePasswordResetRepository) AddPasswordResetToken(resetToken *domain.PasswordResetToken, issuedBefore time.Time) (bool, error) {
+	resetRepository.mu.Lock()
+	defer resetRepository.mu.Unlock()
+
+	var kept []*domain.PasswordResetToken
+	for _, other := range resetRepository.tokens {
+		if other.UserId != resetToken.UserId {
+			kept = append(kept, other)
+			continue
+		}
+		if !resetRepository.issuedAt[other.Id].Before(issuedBefore) {
+			return false, nil
+		}
+		if other.UsedAt != nil {
+			kept = append(kept, other)
+		}
+	}
+
+	resetRepository.nextId++
+	resetToken.Id = resetRepository.nextId
+	stored := *resetToken
+	resetRepository.tokens = append(kept, &stored)
+	resetRepository.issuedAt[stored.Id] = time.Now()
+	return true, nil
+}
+
+func (resetRepository *fakePasswordResetRepository) GetPasswordResetUserId(tokenHash string) (int64, error) {
+	resetRepository.mu.Lock()
+	defer resetRepository.mu.Unlock()
+
+	for _, resetToken := range resetRepository.tokens {
+		if resetToken.TokenHash == tokenHash && resetToken.UsedAt == nil && resetToken.ExpiresAt.After(time.Now()) {
+			return resetToken.UserId, nil
+		}
+	}
+	return 0, domain.ErrInvalidResetToken
+}
+
+func (resetRepository *fakePasswordResetRepository) DeletePasswordResetToken(id int64) error {
+	resetRepository.mu.Lock()
+	defer resetRepository.mu.Unlock()
+
+	for i, resetToken := range resetRepository.tokens {
+		if resetToken.Id == id {
+			resetRepository.tokens = append(resetRepository.tokens[:i], resetRepository.tokens[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (resetRepository *fakePasswordResetRepository) tokenCount() int {
+	resetRepository.mu.Lock()
+	defer resetRepository.mu.Unlock()
+	return len(resetRepository.tokens)
+}
+
+func (resetRepository *fakePasswordResetRepository) ResetPassword(tokenHash string, passwordHash string) (int64, error) {
+	resetRepository.mu.Lock()
+	defer resetRepository.mu.Unlock()
+
+	for _, resetToken := range resetRepository.tokens {
+		if resetToken.TokenHash != tokenHash {
+			continue
+		}
+		if resetToken.UsedAt != nil || !resetToken.ExpiresAt.After(time.Now()) {
+			return 0, domain.ErrInvalidResetToken
+		}
+
+		now := time.Now()
+		for _, other := range resetRepository.tokens {
+			if other.UserId == resetToken.UserId && other.UsedAt == nil {
+				other.UsedAt = &now
+			}
+		}
+		resetRepository.passwords[resetToken.UserId] = passwordHash
+		return resetToken.UserId, nil
+	}
+	return 0, domain.ErrInvalidResetToken
+}
+
+// backdate moves the issue time of all tokens by age into the past.
+func (resetRepository *fakePasswordResetRepository) backdate(age time.Duration) {
+	resetRepository.mu.Lock()
+	defer resetRepository.mu.Unlock()
+
+	for id, issuedAt := range resetRepository.issuedAt {
+		resetRepository.issuedAt[id] = issuedAt.Add(-age)
+	}
+}
+
+func (resetRepository *fakePasswordResetRepository) expireAll() {
+	resetRepository.mu.Lock()
+	defer resetRepository.mu.Unlock()
+
+	for _, resetToken := range resetRepository.tokens {
+		resetToken.ExpiresAt = time.Now().Add(-time.Second)
+	}
+}
+
+func newTestPasswordResetService(t *testing.T, resetRepository *fakePasswordResetRepository, userRepository *fakeUserRepository, mailer *recordingMailer) IPasswordResetService {
+	t.Helper()
+
+	passwordPolicy, err := NewPasswordPolicy(PasswordPolicyConfig{MinLength: 8, MaxLength: 72, MinStrength: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bcrypt, err := hashing.NewBcrypt(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := PasswordResetConfig{TokenTTL: time.Hour, RequestCooldown: time.Minute, ResetURL: "http://client.test/reset-password"}
+	return NewPasswordResetService(resetRepository, userRepository, newTestMailQueue(t, mailer), passwordPolicy, hashing.NewHasher(bcrypt), config)
+}
+
+const newPassword = "correct horse battery staple"
+
+func TestMailedResetTokenWorksOnce(t *testing.T) {
+	resetRepository := newFakePasswordResetRepository()
+	mailer := &recordingMailer{}
+	userRepository := newFakeUserRepository(&domain.User{Id: 1, Email: "jane@example.com"})
+	resetService := newTestPasswordResetService(t, resetRepository, userRepository, mailer)
+
+	if err := resetService.RequestReset(" Jane@Example.com "); err != nil {
+		t.Fatal(err)
+	}
+	messages := waitForMail(t, mailer, 1)
+	if messages[0].To != "jane@example.com" {
+		t.Errorf("reset mail sent to %q, want jane@example.com", messages[0].To)
+	}
+	token := linkToken(t, messages[0])
+
+	if err := resetService.ResetPassword(token, newPassword); err != nil {
+		t.Fatalf("first ResetPassword() = %v", err)
+	}
+	if resetRepository.passwords[1] == "" {
+		t.Error("password of user 1 wasn't changed")
+	}
+	if err := resetService.ResetPassword(token, newPassword); err != domain.ErrInvalidResetToken {
+		t.Errorf("second ResetPassword() = %v, want ErrInvalidResetToken", err)
+	}
+}
+
+func TestExpiredResetTokenIsRefused(t *testing.T) {
+	resetRepository := newFakePasswordResetRepository()
+	mailer := &recordingMailer{}
+	userRepository := newFakeUserRepository(&domain.User{Id: 1, Email: "jane@example.com"})
+	resetService := newTestPasswordResetService(t, resetRepository, userRepository, mailer)
+
+	if err := resetService.RequestReset("jane@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	token := linkToken(t, waitForMail(t, mailer, 1)[0])
+	resetRepository.expireAll()
+
+	if err := resetService.ResetPassword(token, newPassword); err != domain.ErrInvalidResetToken {
+		t.Errorf("ResetPassword() = %v, want ErrInvalidResetToken", err)
+	}
+	if err := resetService.ResetPassword("not-a-token", newPassword); err != domain.ErrInvalidResetToken {
+		t.Errorf("ResetPassword() with an unknown token = %v, want ErrInvalidResetToken", err)
+	}
+}
+
+func TestResetForUnknownEmailSendsNothing(t *testing.T) {
+	resetRepository := newFakePasswordResetRepository()
+	mailer := &recordingMailer{}
+	resetService := newTestPasswordResetService(t, resetRepository, newFakeUserRepository(), mailer)
+
+	if err := resetService.RequestReset("nobody@example.com"); err != nil {
+		t.Errorf("RequestReset() = %v, want no error for an unknown email", err)
+	}
+	if messages := mailer.sent(); len(messages) != 0 {
+		t.Errorf("%d messages sent for an unknown email, want none", len(messages))
+	}
+	if len(resetRepository.tokens) != 0 {
+		t.Errorf("%d reset tokens stored for an unknown email, want none", len(resetRepository.tokens))
+	}
+}
+
+func TestResetRequestsAreRateLimitedAndOnlyTheLatestLinkWorks(t *testing.T) {
+	resetRepository := newFakePasswordResetRepository()
+	mailer := &recordingMailer{}
+	userRepository := newFakeUserRepository(&domain.User{Id: 1, Email: "jane@example.com"})
+	resetService := newTestPasswordResetService(t, resetRepository, userRepository, mailer)
+
+	if err := resetService.RequestReset("jane@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	firstToken := linkToken(t, waitForMail(t, mailer, 1)[0])
+
+	if err := resetService.RequestReset("jane@example.com"); err != nil {
+		t.Errorf("RequestReset() during the cooldown = %v, want no error", err)
+	}
+	if count := resetRepository.tokenCount(); count != 1 {
+		t.Errorf("%d reset tokens stored during the cooldown, want 1", count)
+	}
+
+	resetRepository.backdate(2 * time.Minute)
+	if err := resetService.RequestReset("jane@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	messages := waitForMail(t, mailer, 2)
+	if len(messages) != 2 {
+		t.Fatalf("%d reset mails sent, want one per cooldown", len(messages))
+	}
+	secondToken := linkToken(t, messages[1])
+
+	if err := resetService.ResetPassword(firstToken, newPassword); err != domain.ErrInvalidResetToken {
+		t.Errorf("ResetPassword() with the replaced link = %v, want ErrInvalidResetToken", err)
+	}
+	if err := resetService.ResetPassword(secondToken, newPassword); err != nil {
+		t.Errorf("ResetPassword() with the latest link = %v", err)
+	}
+}
+
+func TestUndeliveredResetMailReleasesTheCooldown(t *testing.T) {
+	resetRepository := newFakePasswordResetRepository()
+	mailer := &recordingMailer{err: errors.New("mail server down")}
+	userRepository := newFakeUserRepository(&domain.User{Id: 1, Email: "jane@example.com"})
+	resetService := newTestPasswordResetService(t, resetRepository, userRepository, mailer)
+
+	if err := resetService.RequestReset("jane@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for resetRepository.tokenCount() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the token of an undelivered reset mail was kept")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestResetRefusesAPasswordBuiltFromTheEmail(t *testing.T) {
+	resetRepository := newFakePasswordResetRepository()
+	mailer := &recordingMailer{}
+	userRepository := newFakeUserRepository(&domain.User{Id: 1, Email: "jane@example.com"})
+	resetService := newTestPasswordResetService(t, resetRepository, userRepository, mailer)
+
+	if err := resetService.RequestReset("jane@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	token := linkToken(t, waitForMail(t, mailer, 1)[0])
+
+	if err := resetService.ResetPassword(token, "janeexample"); !errors.Is(err, domain.ErrInvalidPassword) {
+		t.Errorf("ResetPassword() = %v, want ErrInvalidPassword", err)
+	}
+	if err := resetService.ResetPassword(token, newPassword); err != nil {
+		t.Errorf("ResetPassword() after a refused password = %v, want the token to still work", err)
+	}
+}
@@ -0,0 +1,215 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/erkindilekci/cinebase/server/pkg/commmon/signing"
+	"github.com/erkindilekci/cinebase/server/pkg/domain"
+	"github.com/erkindilekci/cinebase/server/pkg/repository"
+	"github.com/golang-jwt/jwt/v5"
+	"net/url"
+	"time"
+)
+
+type TokenConfig struct {
+	// AccessTokenTTL is how long a signed access token is accepted.
+	AccessTokenTTL time.Duration
+	// RefreshTokenTTL is how long a refresh token can be exchanged, counted
+	// from the moment it was issued.
+	RefreshTokenTTL time.Duration
+	// Issuer and Audience are put in the iss and aud claims of access tokens.
+	Issuer   string
+	Audience string
+}
+
+type ITokenService interface {
+	IssueTokens(user *domain.User, mfa bool) (*domain.TokenPair, error)
+	Refresh(refreshToken string) (*domain.TokenPair, error)
+	Logout(claims *domain.Claims, refreshToken string) error
+	IsTokenRevoked(jti string) (bool, error)
+}
+
+type TokenService struct {
+	tokenRepository repository.ITokenRepository
+	userRepository  repository.IUserRepository
+	keySet          *signing.KeySet
+	config          TokenConfig
+}
+
+func NewTokenService(tokenRepository repository.ITokenRepository, userRepository repository.IUserRepository, keySet *signing.KeySet, config TokenConfig) ITokenService {
+	return &TokenService{tokenRepository, userRepository, keySet, config}
+}
+
+// IssueTokens starts a new session for user with a fresh refresh token family.
+// mfa tells whether the user passed a second factor, which holds for the whole
+// session.
+func (service *TokenService) IssueTokens(user *domain.User, mfa bool) (*domain.TokenPair, error) {
+	familyId, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenPair, refreshToken, err := service.newTokenPair(user, familyId, mfa)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken.UserId = user.Id
+	refreshToken.FamilyId = familyId
+	refreshToken.Mfa = mfa
+	if err = service.tokenRepository.AddRefreshToken(refreshToken); err != nil {
+		return nil, errors.New("error while storing the refresh token")
+	}
+
+	return tokenPair, nil
+}
+
+// Refresh exchanges a refresh token for a new token pair. The presented token
+// is rotated and can't be used again; the user is reloaded so role changes
+// take effect.
+func (service *TokenService) Refresh(refreshToken string) (*domain.TokenPair, error) {
+	if refreshToken == "" {
+		return nil, domain.ErrInvalidRefreshToken
+	}
+
+	current, err := service.tokenRepository.GetRefreshTokenByHash(hashToken(refreshToken))
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := service.userRepository.GetUserById(current.UserId)
+	if err != nil {
+		return nil, domain.ErrInvalidRefreshToken
+	}
+
+	tokenPair, replacement, err := service.newTokenPair(user, current.FamilyId, current.Mfa)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = service.tokenRepository.RotateRefreshToken(current.TokenHash, replacement); err != nil {
+		return nil, err
+	}
+
+	return tokenPair, nil
+}
+
+// Logout revokes the session of the access token described by claims and the
+// one refreshToken belongs to. Either may be missing.
+func (service *TokenService) Logout(claims *domain.Claims, refreshToken string) error {
+	if refreshToken != "" {
+		current, err := service.tokenRepository.GetRefreshTokenByHash(hashToken(refreshToken))
+		if err != nil {
+			return err
+		}
+		if err = service.tokenRepository.RevokeRefreshTokenFamily(current.FamilyId); err != nil {
+			return err
+		}
+	}
+
+	if claims != nil {
+		if claims.SessionId != "" {
+			if err := service.tokenRepository.RevokeRefreshTokenFamily(claims.SessionId); err != nil {
+				return err
+			}
+		}
+		if claims.ID != "" && claims.ExpiresAt != nil {
+			return service.tokenRepository.RevokeAccessToken(claims.ID, claims.ExpiresAt.Time)
+		}
+	}
+
+	return nil
+}
+
+func (service *TokenService) IsTokenRevoked(jti string) (bool, error) {
+	return service.tokenRepository.IsAccessTokenRevoked(jti)
+}
+
+// newTokenPair signs an access token for user and generates the refresh token
+// issued with it. The returned RefreshToken still lacks its user and family.
+func (service *TokenService) newTokenPair(user *domain.User, familyId string, mfa bool) (*domain.TokenPair, *domain.RefreshToken, error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	accessExpiresAt := now.Add(service.config.AccessTokenTTL)
+
+	authMethods := []string{domain.AuthMethodPassword}
+	if mfa {
+		authMethods = append(authMethods, domain.AuthMethodOtp)
+	}
+
+	claims := &domain.Claims{
+		Email:         user.Email,
+		Role:          user.Role,
+		SessionId:     familyId,
+		EmailVerified: user.IsEmailVerified(),
+		AuthMethods:   authMethods,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Issuer:    service.config.Issuer,
+			Audience:  jwt.ClaimStrings{service.config.Audience},
+			Subject:   fmt.Sprint(user.Id),
+			ExpiresAt: jwt.NewNumericDate(accessExpiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+
+	accessToken, err := service.keySet.Sign(claims)
+	if err != nil {
+		return nil, nil, errors.New("error signing the token: " + err.Error())
+	}
+
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tokenPair := &domain.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    service.config.AccessTokenTTL,
+	}
+	storedToken := &domain.RefreshToken{
+		TokenHash:       hashToken(refreshToken),
+		AccessJti:       jti,
+		AccessExpiresAt: accessExpiresAt,
+		ExpiresAt:       now.Add(service.config.RefreshTokenTTL),
+	}
+
+	return tokenPair, storedToken, nil
+}
+
+// randomToken returns size random bytes encoded as unpadded base64url.
+func randomToken(size int) (string, error) {
+	buffer := make([]byte, size)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", errors.New("error while generating a random token")
+	}
+	return base64.RawURLEncoding.EncodeToString(buffer), nil
+}
+
+// hashToken is how opaque tokens are stored, so a database leak doesn't
+// expose usable tokens. They carry enough entropy that a plain sha256 will do.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// tokenLink adds token as the token query parameter of the client page baseURL.
+func tokenLink(baseURL string, token string) string {
+	link, err := url.Parse(baseURL)
+	if err != nil {
+		return baseURL + "?token=" + url.QueryEscape(token)
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+	return link.String()
+}
@@ -3,94 +3,239 @@ package service
 import (
 	"errors"
 	"fmt"
-	"os"
-	"time"
+	"net/mail"
+	"strings"
+	"sync"
 
+	"github.com/erkindilekci/cinebase/server/pkg/commmon/hashing"
 	"github.com/erkindilekci/cinebase/server/pkg/domain"
 	"github.com/erkindilekci/cinebase/server/pkg/repository"
 	"github.com/erkindilekci/cinebase/server/pkg/service/dto"
-	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/labstack/gommon/log"
 )
 
 type IUserService interface {
-	Login(email, password string) (string, error)
+	Login(email, password, ip string) (*domain.LoginResult, error)
 	SignUp(user *dto.UserCreate) error
+	ChangeRole(id int64, role domain.Role) (*domain.User, error)
+	UnlockAccount(id int64) error
+	BootstrapAdmin() error
 }
 
 type UserService struct {
-	userRepository repository.IUserRepository
+	userRepository           repository.IUserRepository
+	tokenService             ITokenService
+	emailVerificationService IEmailVerificationService
+	loginThrottle            *LoginThrottle
+	mfaService               IMfaService
+	passwordPolicy           *PasswordPolicy
+	passwordHasher           *hashing.Hasher
+	// dummyPasswordHash is checked against when the email is unknown, so such
+	// logins take as long as those with a wrong password.
+	dummyPasswordHash func() string
+	// bootstrapAdminEmail is the account that becomes admin while no admin
+	// exists yet, either at startup or when it signs up.
+	bootstrapAdminEmail string
 }
 
-func NewUserService(userRepository repository.IUserRepository) IUserService {
-	return &UserService{userRepository}
+func NewUserService(userRepository repository.IUserRepository, tokenService ITokenService, emailVerificationService IEmailVerificationService, loginThrottle *LoginThrottle, mfaService IMfaService, passwordPolicy *PasswordPolicy, passwordHasher *hashing.Hasher, bootstrapAdminEmail string) IUserService {
+	if normalizedEmail, err := normalizeEmail(bootstrapAdminEmail); err == nil {
+		bootstrapAdminEmail = normalizedEmail
+	}
+	dummyPasswordHash := sync.OnceValue(func() string {
+		hash, err := passwordHasher.Hash("cinebase-dummy-password")
+		if err != nil {
+			panic(err)
+		}
+		return hash
+	})
+	return &UserService{userRepository, tokenService, emailVerificationService, loginThrottle, mfaService, passwordPolicy, passwordHasher, dummyPasswordHash, bootstrapAdminEmail}
 }
 
-func (service *UserService) Login(email, password string) (string, error) {
-	jwtKey := os.Getenv("JWT_KEY")
+// Login checks the credentials of a login attempt from ip. Unknown emails and
+// wrong passwords both fail with domain.ErrInvalidCredentials, and repeated
+// failures block further attempts with a *domain.TooManyAttemptsError. Users
+// with two-factor authentication get an MFA challenge instead of tokens.
+func (service *UserService) Login(email, password, ip string) (*domain.LoginResult, error) {
+	// A malformed email is looked up anyway, so it fails like unknown ones.
+	if normalizedEmail, err := normalizeEmail(email); err == nil {
+		email = normalizedEmail
+	}
 
-	user, err := service.userRepository.GetUserByEmail(email)
+	// The attempt counts as failed until the password turns out right.
+	attempt, err := service.loginThrottle.Attempt(email, ip)
 	if err != nil {
-		return "", errors.New("no user found with the email: " + email)
+		return nil, err
 	}
 
-	matches, err := user.PasswordMatches(password)
-	if err != nil || !matches {
-		return "", errors.New("invalid password")
+	user, err := service.userRepository.GetUserByEmail(email)
+	if err != nil && !errors.Is(err, domain.ErrUserNotFound) {
+		if refundErr := attempt.Refund(); refundErr != nil {
+			log.Errorf("error while refunding a login attempt: %v", refundErr)
+		}
+		return nil, err
+	}
+	// Accounts without a password, like those from single sign-on, can't log
+	// in with one either.
+	hasPassword := user != nil && user.Password != ""
+	passwordHash := service.dummyPasswordHash()
+	if hasPassword {
+		passwordHash = user.Password
 	}
 
-	expirationTime := time.Now().Add(24 * time.Hour)
-	claims := &domain.Claims{
-		Email: user.Email,
-		RegisteredClaims: jwt.RegisteredClaims{
-			Issuer:    "example.com",
-			Audience:  jwt.ClaimStrings{"example.com"},
-			Subject:   fmt.Sprint(user.Id),
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
+	matches, rehash, err := service.passwordHasher.Verify(passwordHash, password)
+	if err != nil || !matches || !hasPassword {
+		if err != nil {
+			log.Errorf("error while verifying a password: %v", err)
+		}
+		return nil, domain.ErrInvalidCredentials
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(jwtKey))
-	if err != nil {
-		return "", errors.New("error signing the token: " + err.Error())
+	if rehash {
+		service.upgradePasswordHash(user, password)
+	}
+
+	if err = attempt.Refund(); err != nil {
+		log.Errorf("error while refunding a login attempt: %v", err)
+	}
+	if err = service.loginThrottle.Reset(email); err != nil {
+		log.Errorf("error while resetting failed logins: %v", err)
+	}
+
+	if err = service.emailVerificationService.CheckLogin(user); err != nil {
+		return nil, err
 	}
 
-	return tokenString, nil
+	if user.MfaEnabled {
+		return service.mfaService.NewChallenge(user)
+	}
+
+	tokenPair, err := service.tokenService.IssueTokens(user, false)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.LoginResult{Tokens: tokenPair}, nil
 }
 
+// SignUp creates a viewer account. Invalid input fails with
+// domain.ErrInvalidEmail or domain.ErrInvalidPassword and a taken email with
+// domain.ErrEmailTaken.
 func (service *UserService) SignUp(userCreate *dto.UserCreate) error {
-	err := validateUserCreate(userCreate)
+	err := service.validateUserCreate(userCreate)
 	if err != nil {
 		return err
 	}
 
 	user := userCreateToUser(userCreate)
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	user.Password, err = service.passwordHasher.Hash(user.Password)
 	if err != nil {
 		return errors.New("error while creating password hash")
 	}
 
-	user.Password = string(hashedPassword)
+	err = service.userRepository.SignUp(user)
+	if err != nil {
+		return err
+	}
 
-	return service.userRepository.SignUp(user)
+	// The account exists either way; a lost mail can be sent again. A
+	// bootstrap admin is only promoted once the mail proves they own the email.
+	if err = service.emailVerificationService.SendVerification(user); err != nil {
+		log.Errorf("error while sending the verification mail: %v", err)
+	}
+	return nil
 }
 
-func validateUserCreate(u *dto.UserCreate) error {
-	if u.Email == "" {
-		return errors.New("email can't be empty")
+func (service *UserService) ChangeRole(id int64, role domain.Role) (*domain.User, error) {
+	if !role.IsValid() {
+		return nil, domain.ErrInvalidRole
 	}
-	if u.Password == "" {
-		return errors.New("category can't be empty")
+	return service.userRepository.UpdateUserRole(id, role)
+}
+
+// UnlockAccount lifts a login lockout of the user before it runs out.
+func (service *UserService) UnlockAccount(id int64) error {
+	user, err := service.userRepository.GetUserById(id)
+	if err != nil {
+		return err
+	}
+	return service.loginThrottle.Reset(user.Email)
+}
+
+// BootstrapAdmin promotes the configured bootstrap account to admin if the
+// application has no admin yet and the account's email is verified; otherwise
+// verifying the email promotes it. Afterwards roles are managed through the API.
+func (service *UserService) BootstrapAdmin() error {
+	return promoteFirstAdmin(service.userRepository, service.bootstrapAdminEmail)
+}
+
+func promoteFirstAdmin(userRepository repository.IUserRepository, email string) error {
+	if email == "" {
+		return nil
+	}
+
+	promoted, err := userRepository.PromoteFirstAdmin(email)
+	if err != nil {
+		return err
+	}
+	if promoted {
+		log.Infof("Promoted %s to be the first admin", email)
 	}
 	return nil
 }
 
+// validateUserCreate normalizes the email of u and checks it and the
+// password, which mustn't be guessable from the email.
+func (service *UserService) validateUserCreate(u *dto.UserCreate) error {
+	email, err := normalizeEmail(u.Email)
+	if err != nil {
+		return err
+	}
+	u.Email = email
+
+	return service.passwordPolicy.Validate(u.Password, email)
+}
+
+// normalizeEmail trims and lower-cases email and checks that it is a bare
+// RFC 5322 address that fits the limits of RFC 5321.
+func normalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return "", fmt.Errorf("%w: email can't be empty", domain.ErrInvalidEmail)
+	}
+
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Name != "" || address.Address != email {
+		return "", fmt.Errorf("%w: %q is not an email address", domain.ErrInvalidEmail, email)
+	}
+
+	localPart := email[:strings.LastIndex(email, "@")]
+	if len(localPart) > 64 || len(email) > 254 {
+		return "", fmt.Errorf("%w: email is too long", domain.ErrInvalidEmail)
+	}
+
+	return email, nil
+}
+
+// upgradePasswordHash replaces the hash of user's password, which was made
+// with an outdated algorithm or settings. The login succeeds either way.
+func (service *UserService) upgradePasswordHash(user *domain.User, password string) {
+	passwordHash, err := service.passwordHasher.Hash(password)
+	if err != nil {
+		log.Errorf("error while rehashing a password: %v", err)
+		return
+	}
+	if err = service.userRepository.UpdatePasswordHash(user.Id, user.Password, passwordHash); err != nil {
+		log.Errorf("error while storing a rehashed password: %v", err)
+		return
+	}
+	user.Password = passwordHash
+}
+
 func userCreateToUser(userCreate *dto.UserCreate) *domain.User {
 	return &domain.User{
 		Email:    userCreate.Email,
 		Password: userCreate.Password,
+		Role:     domain.RoleViewer,
 	}
 }